@@ -2,13 +2,21 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"http-server/config"
+	"http-server/events"
+	"http-server/graph"
 	"http-server/handlers"
+	"http-server/jobs"
 	"http-server/middleware"
+	"http-server/migrations"
+	"http-server/realtime"
+	"http-server/scheduler"
 	"http-server/services"
 	"http-server/storage"
 	"http-server/utils"
+	"http-server/webhooks"
 	"net/http"
 	"os"
 	"os/signal"
@@ -17,6 +25,7 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
 
 	_ "http-server/docs" // docs is generated by Swag CLI, you have to import it.
 
@@ -29,6 +38,9 @@ import (
 // @host			localhost:8080
 // @BasePath		/
 func main() {
+	migrateOnStart := flag.Bool("migrate-on-start", false, "apply pending database migrations before starting the server")
+	flag.Parse()
+
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -36,15 +48,71 @@ func main() {
 	}
 
 	// Initialize logger
-	utils.InitLogger(cfg.LogLevel)
+	if err := utils.InitLogger(cfg.LogLevel, &cfg.Log); err != nil {
+		panic(fmt.Sprintf("failed to initialize logger: %v", err))
+	}
+	defer func() { _ = utils.CloseLogger() }()
 
-	// Initialize database
-	db, err := storage.InitDB(&cfg.Database)
-	if err != nil {
-		utils.Logger.Error("Failed to initialize database", "error", err)
+	// Initialize storage
+	var userRepo storage.UserRepository
+	var outboxRepo storage.OutboxRepository
+	var webhookRepo storage.WebhookRepository
+	var txManager storage.TxManager
+	switch cfg.Database.Driver {
+	case "memory":
+		utils.Logger.Warn("Using in-memory storage, data is lost on restart")
+		userRepo = storage.NewMemoryUserRepository()
+		outboxRepo = storage.NewMemoryOutboxRepository()
+		webhookRepo = storage.NewMemoryWebhookRepository()
+		txManager = storage.NewNoopTxManager()
+	case "sqlite":
+		if *migrateOnStart {
+			if err := migrations.Run(&cfg.Database); err != nil {
+				utils.Logger.Error("Failed to run migrations", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		db, err := storage.OpenSQLite(&cfg.Database)
+		if err != nil {
+			utils.Logger.Error("Failed to initialize database", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		userRepo = storage.NewSQLiteUserRepository(db)
+		outboxRepo = storage.NewSQLiteOutboxRepository(db)
+		webhookRepo = storage.NewSQLiteWebhookRepository(db)
+		txManager = storage.NewSQLiteTxManager(db)
+	case "", "postgres":
+		// Apply migrations; concurrent replicas serialise on the migration lock
+		if *migrateOnStart {
+			if err := migrations.Run(&cfg.Database); err != nil {
+				utils.Logger.Error("Failed to run migrations", "error", err)
+				os.Exit(1)
+			}
+		}
+
+		db, err := storage.InitDB(&cfg.Database)
+		if err != nil {
+			utils.Logger.Error("Failed to initialize database", "error", err)
+			os.Exit(1)
+		}
+		defer db.Close()
+		for _, collector := range db.PoolStatsCollectors() {
+			prometheus.MustRegister(collector)
+		}
+		userRepo = storage.NewUserRepository(db)
+		outboxRepo = storage.NewOutboxRepository(db)
+		webhookRepo = storage.NewWebhookRepository(db)
+		txManager, err = storage.NewTxManager(db, &cfg.Database.Tx)
+		if err != nil {
+			utils.Logger.Error("Failed to initialize transactions", "error", err)
+			os.Exit(1)
+		}
+	default:
+		utils.Logger.Error("Unknown database driver", "driver", cfg.Database.Driver)
 		os.Exit(1)
 	}
-	defer db.Close()
 
 	// Initialize Redis client
 	redisClient, err := storage.NewRedisClient(&cfg.Redis)
@@ -52,53 +120,142 @@ func main() {
 		utils.Logger.Error("Failed to initialize Redis client", "error", err)
 		os.Exit(1)
 	}
-	defer redisClient.Client.Close()
+	defer redisClient.Close()
+
+	// Create the job queue
+	jobQueue := jobs.NewQueue(redisClient, &cfg.Jobs)
+
+	// Create user service and handlers
+	userService := services.NewUserService(userRepo, outboxRepo, txManager, redisClient)
+	userHandler := handlers.NewUserHandler(userService, jobQueue)
+	jobHandler := handlers.NewJobHandler(jobQueue)
+	webhookHandler := handlers.NewWebhookHandler(services.NewWebhookService(webhookRepo))
+	webhookDispatcher := webhooks.NewDispatcher(webhookRepo, jobQueue, &cfg.Webhooks)
+	graphServer, err := graph.NewServer(userService, &cfg.GraphQL)
+	if err != nil {
+		utils.Logger.Error("Failed to build GraphQL schema", "error", err)
+		os.Exit(1)
+	}
+	graphQLHandler := handlers.NewGraphQLHandler(graphServer, cfg.GraphQL.Playground, cfg.Database.ReadYourWritesWindow)
+
+	// Run background jobs once every handler is registered
+	jobPool := jobs.NewPool(jobQueue, cfg.Jobs.Workers)
+	jobPool.Start()
 
-	// Create user repository, service, and handler
-	userRepo := storage.NewUserRepository(db)
-	userService := services.NewUserService(userRepo, redisClient)
-	userHandler := handlers.NewUserHandler(userService)
+	// Publish the user events written to the outbox
+	eventBroker := events.NewBroker(redisClient, &cfg.Events)
+	userEventsHandler := handlers.NewUserEventsHandler(eventBroker, &cfg.Events)
+	eventRelay := events.NewRelay(outboxRepo, txManager, &cfg.Events,
+		events.NewRedisStreamSink(redisClient, cfg.Events.Stream, cfg.Events.StreamMaxLen),
+		eventBroker,
+		webhookDispatcher)
+	eventRelay.Start()
+
+	// Push events to WebSocket clients
+	realtimeHub := realtime.NewHub(eventBroker, &cfg.WebSocket)
+	realtimeHub.Start()
+	webSocketHandler := handlers.NewWebSocketHandler(realtimeHub)
+
+	// Run periodic tasks, each on a single instance at a time
+	taskScheduler := scheduler.New(redisClient, &cfg.Scheduler)
+	taskScheduler.Register("purge_deleted_users", services.PurgeDeletedUsersTask(userService, cfg.Users.DeletedRetention))
+	taskScheduler.Register("warm_user_cache", services.WarmUserCacheTask(userService))
+	taskScheduler.Register("purge_sent_events", events.PurgeSentEventsTask(outboxRepo, cfg.Events.Retention))
+	if err := taskScheduler.Start(); err != nil {
+		utils.Logger.Error("Failed to start scheduler", "error", err)
+		os.Exit(1)
+	}
+	schedulerHandler := handlers.NewSchedulerHandler(taskScheduler)
 
 	// Create router
 	r := chi.NewRouter()
 
 	// ===== Middleware =====
 	r.Use(chiMiddleware.RequestID)
-	r.Use(middleware.LoggerMiddleware)
+	r.Use(middleware.LoggerMiddleware(cfg.Log.AccessFormat))
 	r.Use(middleware.MetricsMiddleware)
+	// GraphQL posts queries too, so its handler pins on mutations only
+	r.Use(middleware.ReadYourWrites(cfg.Database.ReadYourWritesWindow, "/graphql"))
 	r.Use(chiMiddleware.Recoverer)
 	r.Use(middleware.CorsMiddleware())
 	r.Use(middleware.RateLimiterMiddleware())
-	r.Use(chiMiddleware.AllowContentType("application/json", "text/plain"))
-	r.Use(chiMiddleware.Timeout(60 * time.Second))
 
-	// ===== Static files ====
-	staticDir := http.Dir("resources/static")
-	r.Handle("/ui/*", http.StripPrefix("/ui/", http.FileServer(staticDir)))
+	// ===== Streaming routes =====
+	// Long-lived connections, outside of the request timeout
+	r.With(middleware.BasicAuth).Get("/users/events", userEventsHandler.StreamUserEventsHandler)
+	r.With(middleware.BasicAuth).Get("/ws", webSocketHandler.ConnectHandler)
 
-	// ===== Redirects ====
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		http.Redirect(w, r, "/ui/", http.StatusFound) // Use http.StatusFound for a temporary redirect (302)
-	})
+	// Every other route gets a body type check and the request timeout
+	r.Group(func(r chi.Router) {
+		r.Use(chiMiddleware.AllowContentType("application/json", "text/plain", handlers.ContentTypeCSV, handlers.ContentTypeNDJSON))
+		r.Use(chiMiddleware.Timeout(60 * time.Second))
+
+		// ===== Static files ====
+		staticDir := http.Dir("resources/static")
+		r.Handle("/ui/*", http.StripPrefix("/ui/", http.FileServer(staticDir)))
+
+		// ===== Redirects ====
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, "/ui/", http.StatusFound) // Use http.StatusFound for a temporary redirect (302)
+		})
+
+		// ===== Routes =====
+		r.Get("/health", handlers.HealthCheckHandler)
+		r.Handle("/metrics", handlers.MetricsHandler())
+
+		// Swagger UI
+		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL("/swagger/doc.json")))
+
+		r.Route("/users", func(r chi.Router) {
+			r.Use(middleware.BasicAuth)
+			// Imports are streamed, so their body is not buffered for
+			// idempotency
+			r.Post("/import", userHandler.ImportUsersHandler)
 
-	// ===== Routes =====
-	r.Get("/health", handlers.HealthCheckHandler)
-	r.Handle("/metrics", handlers.MetricsHandler())
+			r.Group(func(r chi.Router) {
+				r.Use(middleware.Idempotency(redisClient, cfg.Idempotency.TTL, cfg.Idempotency.MaxBodyBytes))
+				r.Get("/", userHandler.GetUsersHandler)
+				r.Post("/", userHandler.CreateUserHandler)
+				r.Get("/export", userHandler.ExportUsersHandler)
+				r.Get("/{id}", userHandler.GetUserHandler)
+				r.Put("/{id}", userHandler.UpdateUserHandler)
+				r.Delete("/{id}", userHandler.DeleteUserHandler)
+				r.Post("/{id}/restore", userHandler.RestoreUserHandler)
+			})
+		})
 
-	// Swagger UI
-	r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL("/swagger/doc.json")))
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(middleware.BasicAuth)
+			r.Use(middleware.Idempotency(redisClient, cfg.Idempotency.TTL, cfg.Idempotency.MaxBodyBytes))
+			r.Get("/", webhookHandler.GetWebhooksHandler)
+			r.Post("/", webhookHandler.CreateWebhookHandler)
+			r.Get("/{id}", webhookHandler.GetWebhookHandler)
+			r.Put("/{id}", webhookHandler.UpdateWebhookHandler)
+			r.Delete("/{id}", webhookHandler.DeleteWebhookHandler)
+			r.Get("/{id}/deliveries", webhookHandler.GetDeliveriesHandler)
+		})
 
-	r.Route("/users", func(r chi.Router) {
-		r.Use(middleware.BasicAuth)
-		r.Get("/", userHandler.GetUsersHandler)
-		r.Post("/", userHandler.CreateUserHandler)
-		r.Get("/{id}", userHandler.GetUserHandler)
-		r.Delete("/{id}", userHandler.DeleteUserHandler)
+		r.Route("/graphql", func(r chi.Router) {
+			r.Use(middleware.BasicAuth)
+			r.Get("/", graphQLHandler.PlaygroundHandler)
+			r.Post("/", graphQLHandler.QueryHandler)
+		})
+
+		r.Route("/jobs", func(r chi.Router) {
+			r.Use(middleware.BasicAuth)
+			r.Get("/{id}", jobHandler.GetJobHandler)
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.BasicAuth)
+			r.Get("/scheduler/tasks", schedulerHandler.GetTasksHandler)
+		})
 	})
 
 	// Start server
 	serverAddr := fmt.Sprintf(":%d", cfg.Server.Port)
 	server := &http.Server{Addr: serverAddr, Handler: r}
+	server.RegisterOnShutdown(userEventsHandler.Shutdown)
 
 	// Listen for OS signals to perform a graceful shutdown
 	stop := make(chan os.Signal, 1)
@@ -122,6 +279,30 @@ func main() {
 		utils.Logger.Error("Server graceful shutdown failed", "error", err)
 		os.Exit(1)
 	}
+	// The server does not track WebSocket connections
+	if err := realtimeHub.Stop(ctx); err != nil {
+		utils.Logger.Warn("WebSocket connections did not close in time", "error", err)
+	}
+	if err := eventBroker.Close(); err != nil {
+		utils.Logger.Warn("Failed to close the event subscription", "error", err)
+	}
+
+	// Let running tasks and jobs finish; unfinished jobs are retried by another instance
+	drainTimeout := cfg.Jobs.DrainTimeout
+	if drainTimeout <= 0 {
+		drainTimeout = 20 * time.Second
+	}
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancelDrain()
+	if err := taskScheduler.Stop(drainCtx); err != nil {
+		utils.Logger.Warn("Scheduled tasks did not finish in time", "error", err)
+	}
+	if err := jobPool.Shutdown(drainCtx); err != nil {
+		utils.Logger.Warn("Running jobs did not finish in time", "error", err)
+	}
+	if err := eventRelay.Stop(drainCtx); err != nil {
+		utils.Logger.Warn("Event relay did not finish in time", "error", err)
+	}
 
 	utils.Logger.Info("Server gracefully stopped")
 }
@@ -1,21 +1,275 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"text/tabwriter"
+	"time"
 
 	"http-server/config"
 	"http-server/migrations"
+	"http-server/seeds"
+	"http-server/storage"
+	"http-server/utils"
 )
 
+const usage = `Usage: migrate [flags] [command] [args]
+
+Flags:
+  --dir DIR       Load migrations from DIR/DIALECT instead of the ones embedded in the binary
+  --dry-run       Print the SQL that up, down, goto, redo and force would run, without touching the database
+  --timestamp     Use a timestamp instead of the next sequential version for create
+  --all           Lint every PostgreSQL migration instead of only the pending ones (no database needed)
+  --env ENV       Load seeds from seeds/ENV (default: $APP_ENV or "development")
+  --fake N        Also seed N random users
+
+Commands:
+  up [N]          Apply the next N pending migrations (all by default)
+  down [N]        Roll back the last N applied migrations (1 by default)
+  goto VERSION    Migrate up or down to VERSION
+  status          List applied and pending migrations
+  redo            Roll back and re-apply the last migration
+  force VERSION   Mark VERSION as applied and clear the dirty flag, without running SQL
+  create NAME     Create the next up/down migration pair of every dialect in --dir (default "migrations")
+  lint            Flag risky statements in pending PostgreSQL migrations
+  seed            Load the fixtures in seeds/ENV into the database (idempotent)
+
+Running migrate without a command is the same as "migrate up".
+`
+
 func main() {
+	dir := flag.String("dir", "", "load migrations from this directory instead of the embedded ones")
+	dryRun := flag.Bool("dry-run", false, "print the SQL that would be applied without running it")
+	timestamp := flag.Bool("timestamp", false, "use a timestamp version for create")
+	all := flag.Bool("all", false, "lint every migration instead of only the pending ones")
+	env := flag.String("env", "", "environment whose seeds are loaded")
+	fake := flag.Int("fake", 0, "number of random users to seed")
+	flag.Usage = func() { fmt.Fprint(flag.CommandLine.Output(), usage) }
+	flag.Parse()
+
+	command, args := "up", flag.Args()
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	// Commands that do not need a database connection
+	switch command {
+	case "create":
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		createDir := *dir
+		if createDir == "" {
+			createDir = "migrations"
+		}
+		files, err := migrations.Create(createDir, args[0], *timestamp)
+		if err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		for _, file := range files {
+			log.Printf("Created %s", file)
+		}
+		return
+	case "lint":
+		if *all {
+			migs, err := migrations.Load(migrations.DialectPostgres, *dir)
+			if err != nil {
+				log.Fatalf("Failed to load migrations: %v", err)
+			}
+			lint(migs)
+			return
+		}
+	}
+
+	if command == "seed" {
+		if err := seed(*env, *fake); err != nil {
+			log.Fatalf("Failed to seed database: %v", err)
+		}
+		return
+	}
+
+	var run func(m *migrations.Migrator) error
+	switch command {
+	case "up":
+		n := optionalCount(args, 0)
+		run = func(m *migrations.Migrator) error { return m.Up(n) }
+	case "down":
+		n := optionalCount(args, 1)
+		run = func(m *migrations.Migrator) error { return m.Down(n) }
+	case "goto":
+		version := requiredVersion(args)
+		run = func(m *migrations.Migrator) error { return m.Goto(version) }
+	case "status":
+		run = printStatus
+	case "redo":
+		run = (*migrations.Migrator).Redo
+	case "force":
+		version := requiredVersion(args)
+		run = func(m *migrations.Migrator) error { return m.Force(version) }
+	case "lint":
+		run = func(m *migrations.Migrator) error {
+			if m.Dialect() != migrations.DialectPostgres {
+				return fmt.Errorf("lint only checks %s migrations", migrations.DialectPostgres)
+			}
+			pending, err := m.Pending()
+			if err != nil {
+				return err
+			}
+			lint(pending)
+			return nil
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	if *dir != "" {
+		cfg.Database.Migrations.Dir = *dir
+	}
 
-	if err := migrations.Run(&cfg.Database); err != nil {
+	m, err := migrations.New(&cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to initialize migrations: %v", err)
+	}
+	defer m.Close()
+
+	if *dryRun {
+		m.SetDryRun(os.Stdout)
+	}
+
+	if err := run(m); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
-	log.Println("Migrations applied successfully")
+	if command != "status" && command != "lint" && !*dryRun {
+		log.Println("Migrations applied successfully")
+	}
+}
+
+func optionalCount(args []string, def int) int {
+	if len(args) == 0 {
+		return def
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		log.Fatalf("Invalid migration count %q", args[0])
+	}
+	return n
+}
+
+func requiredVersion(args []string) int64 {
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	version, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil || version < 0 {
+		log.Fatalf("Invalid migration version %q", args[0])
+	}
+	return version
+}
+
+func printStatus(m *migrations.Migrator) error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", "-"
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Format(time.RFC3339)
+		}
+		if s.Dirty {
+			state = "dirty"
+		}
+		if s.Modified {
+			state += " (modified)"
+		}
+		if s.Missing {
+			state += " (missing file)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", s.Version, s.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
+
+// seed loads the fixtures of env, plus fake random users, through the
+// repository layer.
+func seed(env string, fake int) error {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	if err := utils.InitLogger(cfg.LogLevel, &cfg.Log); err != nil {
+		return fmt.Errorf("failed to initialize logger: %w", err)
+	}
+	if env == "" {
+		env = os.Getenv("APP_ENV")
+	}
+	if env == "" {
+		env = "development"
+	}
+	var repo storage.UserRepository
+	switch cfg.Database.Driver {
+	case "memory":
+		return fmt.Errorf("the memory driver does not persist seeds")
+	case "sqlite":
+		db, err := storage.OpenSQLite(&cfg.Database)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		repo = storage.NewSQLiteUserRepository(db)
+	default:
+		db, err := storage.InitDB(&cfg.Database)
+		if err != nil {
+			return err
+		}
+		defer db.Close()
+		repo = storage.NewUserRepository(db)
+	}
+	ctx := context.Background()
+
+	dir := filepath.Join("seeds", env)
+	results, err := seeds.Run(ctx, dir, repo)
+	if err != nil {
+		return err
+	}
+	for table, r := range results {
+		log.Printf("Seeded %s from %s: %d created, %d already present", table, dir, r.Created, r.Skipped)
+	}
+
+	if fake > 0 {
+		r, err := seeds.SeedUsers(ctx, repo, seeds.FakeUsers(fake))
+		if err != nil {
+			return err
+		}
+		log.Printf("Seeded %d fake users (%d already present)", r.Created, r.Skipped)
+	}
+	return nil
+}
+
+// lint prints the issues found in migs and exits with status 1 if there are any.
+func lint(migs []migrations.Migration) {
+	issues := migrations.Lint(migs)
+	for _, issue := range issues {
+		fmt.Printf("%s: [%s] %s\n", issue.Source, issue.Rule, issue.Message)
+	}
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+	log.Printf("No issues found in %d migration(s)", len(migs))
 }
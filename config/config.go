@@ -2,17 +2,30 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	Redis    RedisConfig
-	LogLevel string `mapstructure:"log_level"`
+	Server      ServerConfig
+	Database    DatabaseConfig
+	Redis       RedisConfig
+	Users       UsersConfig
+	Idempotency IdempotencyConfig
+	Jobs        JobsConfig
+	Scheduler   SchedulerConfig
+	Events      EventsConfig
+	Webhooks    WebhooksConfig
+	WebSocket   WebSocketConfig
+	GraphQL     GraphQLConfig
+	Log         LogConfig
+	LogLevel    string `mapstructure:"log_level"`
 }
 
 type ServerConfig struct {
@@ -20,11 +33,284 @@ type ServerConfig struct {
 }
 
 type DatabaseConfig struct {
+	// Driver is "postgres" (default), "sqlite" for a single-node file
+	// database, or "memory" to keep users in process memory, which needs no
+	// database and loses all data on restart.
+	Driver   string
 	Host     string
 	Port     int
 	User     string
 	Password string
 	DBName   string `mapstructure:"db_name"`
+	// SSLMode is a libpq sslmode ("disable", "require", "verify-full", ...).
+	// It defaults to "disable".
+	SSLMode         string `mapstructure:"ssl_mode"`
+	SSLRootCert     string `mapstructure:"ssl_root_cert"`
+	ApplicationName string `mapstructure:"application_name"`
+	// StatementTimeout aborts statements running longer than this. Zero
+	// keeps the server default.
+	StatementTimeout time.Duration `mapstructure:"statement_timeout"`
+	Pool             PoolConfig
+	// Replicas are connection strings of read replicas. Reads are spread
+	// across healthy replicas; writes always go to the primary.
+	Replicas                 []string
+	ReplicaHealthCheckPeriod time.Duration `mapstructure:"replica_health_check_period"`
+	// ReadYourWritesWindow pins a client's reads to the primary for this long
+	// after it writes. Zero disables pinning.
+	ReadYourWritesWindow time.Duration `mapstructure:"read_your_writes_window"`
+	Migrations           MigrationsConfig
+	SQLite               SQLiteConfig
+	Tx                   TxConfig
+}
+
+type TxConfig struct {
+	// IsolationLevel is "read committed" (default), "repeatable read" or
+	// "serializable".
+	IsolationLevel string `mapstructure:"isolation_level"`
+	// MaxRetries bounds how often a transaction aborted by a serialization
+	// failure is retried. It defaults to 3.
+	MaxRetries int `mapstructure:"max_retries"`
+}
+
+type SQLiteConfig struct {
+	// Path of the database file, created if missing.
+	Path string
+	// BusyTimeout is how long a write waits for a lock held by another
+	// connection. It defaults to 5s.
+	BusyTimeout time.Duration `mapstructure:"busy_timeout"`
+}
+
+type MigrationsConfig struct {
+	// LockTimeout bounds how long a migration run waits for the advisory
+	// lock held by a concurrent run. Zero waits indefinitely.
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+	// Dir loads migrations from a directory instead of the files embedded
+	// in the binary.
+	Dir string
+	// ChecksumMode is "fail" (default), "warn" or "ignore" and controls what
+	// happens when an applied migration file has been edited.
+	ChecksumMode string `mapstructure:"checksum_mode"`
+}
+
+type PoolConfig struct {
+	// Zero values keep the pgxpool defaults.
+	MaxConns          int32         `mapstructure:"max_conns"`
+	MinConns          int32         `mapstructure:"min_conns"`
+	MaxConnLifetime   time.Duration `mapstructure:"max_conn_lifetime"`
+	MaxConnIdleTime   time.Duration `mapstructure:"max_conn_idle_time"`
+	HealthCheckPeriod time.Duration `mapstructure:"health_check_period"`
+}
+
+// ConnString returns the PostgreSQL connection URL for the database.
+func (c *DatabaseConfig) ConnString() string {
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	params := url.Values{}
+	params.Set("sslmode", sslMode)
+	if c.SSLRootCert != "" {
+		params.Set("sslrootcert", c.SSLRootCert)
+	}
+	if c.ApplicationName != "" {
+		params.Set("application_name", c.ApplicationName)
+	}
+	if c.StatementTimeout > 0 {
+		params.Set("statement_timeout", strconv.FormatInt(c.StatementTimeout.Milliseconds(), 10))
+	}
+
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:     "/" + c.DBName,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// SQLiteDSN returns the connection string of the SQLite database, with
+// write-ahead logging and foreign keys enabled.
+func (c *DatabaseConfig) SQLiteDSN() string {
+	busyTimeout := c.SQLite.BusyTimeout
+	if busyTimeout <= 0 {
+		busyTimeout = 5 * time.Second
+	}
+	params := url.Values{}
+	params.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", busyTimeout.Milliseconds()))
+	params.Add("_pragma", "journal_mode(WAL)")
+	params.Add("_pragma", "foreign_keys(1)")
+	return "file:" + c.SQLite.Path + "?" + params.Encode()
+}
+
+type LogConfig struct {
+	// AccessFormat is either "json" (default) or "combined" for the
+	// Apache/NCSA combined log format.
+	AccessFormat string `mapstructure:"access_format"`
+	Sinks        []LogSinkConfig
+	Sampling     LogSamplingConfig
+	Redact       RedactConfig
+}
+
+type LogSinkConfig struct {
+	// Type is "stdout" (default) or "file".
+	Type string
+	// Format is "json" (default) or "text".
+	Format string
+	// Path, MaxSizeMB, MaxAgeDays, MaxBackups and Compress configure the
+	// rotation of "file" sinks.
+	Path       string
+	MaxSizeMB  int `mapstructure:"max_size_mb"`
+	MaxAgeDays int `mapstructure:"max_age_days"`
+	MaxBackups int `mapstructure:"max_backups"`
+	Compress   bool
+}
+
+type LogSamplingConfig struct {
+	Enabled bool
+	// First records per level and message are logged each second, then only
+	// every Thereafter-th one. Errors are never sampled.
+	First      int
+	Thereafter int
+}
+
+type RedactConfig struct {
+	// Keys are attribute keys whose values are always redacted.
+	Keys []string
+	// Patterns are builtin names ("jwt", "email") or regular expressions
+	// redacted wherever they appear in log messages and values.
+	Patterns []string
+	// Mode is "mask" (default), "hash" to replace values with a keyed hash
+	// so they can still be correlated, or "off". Hash mode requires HashKey.
+	Mode    string
+	HashKey string `mapstructure:"hash_key"`
+}
+
+type UsersConfig struct {
+	// DeletedRetention is how long soft-deleted users can be restored before
+	// they are purged by the purge_deleted_users task. Zero keeps them
+	// forever.
+	DeletedRetention time.Duration `mapstructure:"deleted_retention"`
+}
+
+type IdempotencyConfig struct {
+	// TTL is how long responses are kept for replay to retries carrying the
+	// same Idempotency-Key. It defaults to 24h.
+	TTL time.Duration
+	// MaxBodyBytes bounds the body of requests carrying an Idempotency-Key,
+	// which is read into memory to fingerprint it. It defaults to 1 MiB.
+	MaxBodyBytes int64 `mapstructure:"max_body_bytes"`
+}
+
+type JobsConfig struct {
+	// Workers is the number of jobs run concurrently by each instance. It
+	// defaults to 4.
+	Workers int
+	// VisibilityTimeout is how long a job may run before it is considered
+	// lost and handed to another worker. It defaults to 5m.
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout"`
+	// MaxAttempts is how many times a job is run before it is moved to the
+	// dead-letter list. It defaults to 5.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// BackoffBase is the delay before the first retry. It doubles with
+	// every attempt, up to BackoffMax. They default to 1s and 10m.
+	BackoffBase time.Duration `mapstructure:"backoff_base"`
+	BackoffMax  time.Duration `mapstructure:"backoff_max"`
+	// PollInterval is how often idle workers check for due jobs. It
+	// defaults to 1s.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// Retention is how long finished jobs can be looked up. It defaults
+	// to 24h.
+	Retention time.Duration
+	// DrainTimeout is how long a graceful shutdown waits for running jobs
+	// to finish. It defaults to 20s.
+	DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+}
+
+type SchedulerConfig struct {
+	// Lease is how long an instance holds the lock of a task run without
+	// renewing it. Instances' clocks must differ by less than Lease, and
+	// schedules must fire less often. It defaults to 30s.
+	Lease time.Duration
+	// Tasks maps task names to cron expressions, with five fields or a
+	// descriptor such as @hourly or @every 10m. Tasks without an expression
+	// are disabled.
+	Tasks map[string]string
+}
+
+type EventsConfig struct {
+	// PollInterval is how often the relay checks the outbox for new events.
+	// It defaults to 1s.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// BatchSize is the maximum number of events published at once. It
+	// defaults to 100.
+	BatchSize int `mapstructure:"batch_size"`
+	// Stream is the Redis stream events are published to. It defaults to
+	// events:users.
+	Stream string
+	// StreamMaxLen is the approximate number of entries the stream is
+	// trimmed to. It defaults to 100000.
+	StreamMaxLen int64 `mapstructure:"stream_max_len"`
+	// Retention is how long published events stay in the outbox before the
+	// purge_sent_events task deletes them. Zero keeps them forever.
+	Retention time.Duration
+	// Channel is the Redis pub/sub channel streaming events to the clients
+	// of GET /users/events on every instance. It defaults to
+	// events:users:live.
+	Channel string
+	// ReplaySize is the number of latest events kept for clients resuming
+	// with Last-Event-ID. It defaults to 1000.
+	ReplaySize int64 `mapstructure:"replay_size"`
+	// Heartbeat is how often an idle event stream sends a comment, so that
+	// proxies keep the connection open. It defaults to 15s.
+	Heartbeat time.Duration
+	// MaxConnections caps the concurrent GET /users/events streams of an
+	// instance. It defaults to 1000.
+	MaxConnections int `mapstructure:"max_connections"`
+}
+
+type WebhooksConfig struct {
+	// Timeout bounds each delivery request. It defaults to 10s.
+	Timeout time.Duration
+	// DisableAfter is the number of failed delivery attempts in a row after
+	// which a webhook is disabled. Zero never disables webhooks.
+	DisableAfter int `mapstructure:"disable_after"`
+	// AllowPrivateNetworks lets webhooks reach loopback, private and
+	// link-local addresses, which are refused by default. Only enable it
+	// for local testing.
+	AllowPrivateNetworks bool `mapstructure:"allow_private_networks"`
+}
+
+type WebSocketConfig struct {
+	// MaxConnections caps the concurrent /ws connections of an instance. It
+	// defaults to 1000.
+	MaxConnections int `mapstructure:"max_connections"`
+	// SendBuffer is the number of messages queued for a connection before
+	// it is closed as a slow consumer. It defaults to 64.
+	SendBuffer int `mapstructure:"send_buffer"`
+	// PingInterval is how often connections are pinged. Connections
+	// answering neither pings nor messages for twice as long are closed. It
+	// defaults to 30s.
+	PingInterval time.Duration `mapstructure:"ping_interval"`
+	// WriteTimeout bounds each write to a connection. It defaults to 10s.
+	WriteTimeout time.Duration `mapstructure:"write_timeout"`
+	// AllowedOrigins are the browser origins allowed to connect besides the
+	// API's own. Clients sending no Origin header, such as mobile apps, are
+	// always allowed.
+	AllowedOrigins []string `mapstructure:"allowed_origins"`
+}
+
+type GraphQLConfig struct {
+	// Playground serves GraphiQL on GET /graphql. Enable it in development
+	// only.
+	Playground bool
+	// MaxDepth is the deepest field nesting a query may have. It defaults
+	// to 10.
+	MaxDepth int `mapstructure:"max_depth"`
+	// MaxComplexity bounds the estimated number of fields a query
+	// resolves, where the fields under a paginated list count once per
+	// requested item. It defaults to 1000.
+	MaxComplexity int `mapstructure:"max_complexity"`
 }
 
 type RedisConfig struct {
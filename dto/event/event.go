@@ -0,0 +1,53 @@
+package event
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Types of the user lifecycle events.
+const (
+	// TypeUserCreated carries the created user.User.
+	TypeUserCreated = "user.created"
+	// TypeUserUpdated carries the user.User after the change, including
+	// restores of soft-deleted users.
+	TypeUserUpdated = "user.updated"
+	// TypeUserDeleted carries a UserDeleted.
+	TypeUserDeleted = "user.deleted"
+)
+
+// Types lists every event type.
+var Types = []string{TypeUserCreated, TypeUserUpdated, TypeUserDeleted}
+
+// Event is a domain event, as published to sinks. Delivery is
+// at-least-once, so consumers should skip IDs they have already seen.
+type Event struct {
+	ID         string          `json:"id" example:"0b8a3f5e-1c2d-4e6f-8a9b-7c5d3e1f2a4b"`
+	Type       string          `json:"type" example:"user.created"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data" swaggertype:"object"`
+}
+
+// UserDeleted is the data of user.deleted events.
+type UserDeleted struct {
+	ID int `json:"id" example:"1"`
+	// Permanent is false for soft deletions, which can be undone.
+	Permanent bool `json:"permanent"`
+}
+
+// New creates an event of the given type occurring now, with data encoded
+// as JSON.
+func New(eventType string, data any) (Event, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         uuid.NewString(),
+		Type:       eventType,
+		OccurredAt: time.Now().UTC(),
+		Data:       raw,
+	}, nil
+}
@@ -0,0 +1,26 @@
+package user
+
+// Import row statuses.
+const (
+	ImportRowCreated = "created"
+	ImportRowFailed  = "failed"
+)
+
+// ImportReport is the response of a bulk user import.
+type ImportReport struct {
+	Created int               `json:"created" example:"1"`
+	Failed  int               `json:"failed" example:"1"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportRowResult is the outcome of importing a single row.
+type ImportRowResult struct {
+	// Row is the position of the row in the input, starting at 1 and not
+	// counting the CSV header or blank NDJSON lines.
+	Row    int    `json:"row" example:"1"`
+	Status string `json:"status" enums:"created,failed" example:"created"`
+	// ID is set for created users.
+	ID int `json:"id,omitempty" example:"1"`
+	// Error explains why the row failed.
+	Error string `json:"error,omitempty" example:"Email already taken"`
+}
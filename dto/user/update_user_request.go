@@ -0,0 +1,7 @@
+package user
+
+// UpdateUserRequest represents the request body for replacing a user.
+type UpdateUserRequest struct {
+	Name  string `json:"name" example:"John Doe"`
+	Email string `json:"email" example:"john.doe@example.com"`
+}
@@ -1,8 +1,14 @@
 package user
 
+import "time"
+
 // User represents a user in the system.
 type User struct {
 	ID    int    `json:"id" example:"1"`
 	Name  string `json:"name" example:"John Doe"`
 	Email string `json:"email" example:"john.doe@example.com"`
+	// Version is incremented by every change and used as the ETag.
+	Version int `json:"version" example:"1"`
+	// DeletedAt is set while the user is soft-deleted.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
 }
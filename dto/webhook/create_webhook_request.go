@@ -0,0 +1,10 @@
+package webhook
+
+// CreateWebhookRequest represents the request body for creating a webhook.
+type CreateWebhookRequest struct {
+	URL string `json:"url" example:"https://partner.example.com/hooks/users"`
+	// EventTypes lists the event types to deliver. Empty means all of them.
+	EventTypes []string `json:"event_types" example:"user.created,user.deleted"`
+	// Secret signs the deliveries. A random secret is generated when empty.
+	Secret string `json:"secret,omitempty" example:"whsec_3f9a2c7e5b1d4e8f"`
+}
@@ -0,0 +1,21 @@
+package webhook
+
+import "time"
+
+// Delivery is an attempt to deliver an event to a webhook.
+type Delivery struct {
+	ID        int64  `json:"id" example:"1"`
+	WebhookID int    `json:"webhook_id" example:"1"`
+	EventID   string `json:"event_id" example:"0b8a3f5e-1c2d-4e6f-8a9b-7c5d3e1f2a4b"`
+	EventType string `json:"event_type" example:"user.created"`
+	// Attempt is the number of the attempt for this event, starting at 1.
+	Attempt int `json:"attempt" example:"1"`
+	// StatusCode is the status of the response, or 0 when none was
+	// received.
+	StatusCode int    `json:"status_code,omitempty" example:"200"`
+	Error      string `json:"error,omitempty" example:"unexpected status 503"`
+	// DurationMs is how long the request took, in milliseconds.
+	DurationMs int       `json:"duration_ms" example:"120"`
+	Succeeded  bool      `json:"succeeded" example:"true"`
+	CreatedAt  time.Time `json:"created_at"`
+}
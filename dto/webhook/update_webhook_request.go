@@ -0,0 +1,12 @@
+package webhook
+
+// UpdateWebhookRequest represents the request body for replacing a webhook.
+// The secret cannot be changed.
+type UpdateWebhookRequest struct {
+	URL string `json:"url" example:"https://partner.example.com/hooks/users"`
+	// EventTypes lists the event types to deliver. Empty means all of them.
+	EventTypes []string `json:"event_types" example:"user.created,user.deleted"`
+	// Active enables or disables deliveries. Enabling a webhook resets its
+	// count of consecutive failures.
+	Active bool `json:"active" example:"true"`
+}
@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"slices"
+	"time"
+)
+
+// Webhook is a subscription delivering events to a URL.
+type Webhook struct {
+	ID  int    `json:"id" example:"1"`
+	URL string `json:"url" example:"https://partner.example.com/hooks/users"`
+	// EventTypes lists the event types delivered. Empty means all of them.
+	EventTypes []string `json:"event_types" example:"user.created,user.deleted"`
+	// Secret signs the deliveries. It is only returned on creation.
+	Secret string `json:"secret,omitempty" example:"whsec_3f9a2c7e5b1d4e8f"`
+	// Active is false once the webhook has been disabled, by hand or after
+	// too many failed deliveries in a row.
+	Active bool `json:"active" example:"true"`
+	// ConsecutiveFailures counts failed delivery attempts since the last
+	// successful one.
+	ConsecutiveFailures int       `json:"consecutive_failures" example:"0"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Subscribes reports whether the webhook delivers events of eventType.
+func (w *Webhook) Subscribes(eventType string) bool {
+	return len(w.EventTypes) == 0 || slices.Contains(w.EventTypes, eventType)
+}
@@ -0,0 +1,285 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/storage"
+	"http-server/utils"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultChannel    = "events:users:live"
+	defaultReplaySize = 1000
+	// subscriptionBuffer is the number of events a subscription holds for a
+	// subscriber that is busy writing.
+	subscriptionBuffer = 64
+)
+
+// ErrBrokerClosed is returned by Subscribe once the broker is closed.
+var ErrBrokerClosed = errors.New("broker closed")
+
+// Broker fans events out to the subscribers of every instance through Redis
+// pub/sub. It is a Sink, so the relay publishes each event once for the
+// whole cluster. Each instance holds a single Redis subscription, opened
+// for the first subscriber, whose events are dispatched to the local
+// subscribers. The latest events are also kept in a capped Redis list, so
+// that subscribers can catch up on what they missed while reconnecting.
+type Broker struct {
+	rdb        *storage.RedisClient
+	channel    string
+	replayKey  string
+	replaySize int64
+
+	mu     sync.Mutex
+	pubsub *redis.PubSub
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroker creates a Broker publishing to the channel of cfg and keeping
+// cfg.ReplaySize events for resuming subscribers.
+func NewBroker(rdb *storage.RedisClient, cfg *config.EventsConfig) *Broker {
+	channel := cfg.Channel
+	if channel == "" {
+		channel = defaultChannel
+	}
+	replaySize := cfg.ReplaySize
+	if replaySize <= 0 {
+		replaySize = defaultReplaySize
+	}
+	return &Broker{
+		rdb:        rdb,
+		channel:    channel,
+		replayKey:  channel + ":replay",
+		replaySize: replaySize,
+		subs:       make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish appends events to the replay buffer and sends them to the
+// subscribers of every instance, in a single pipeline.
+func (b *Broker) Publish(ctx context.Context, events []event.Event) error {
+	_, err := b.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range events {
+			payload, err := json.Marshal(e)
+			if err != nil {
+				return err
+			}
+			pipe.RPush(ctx, b.replayKey, payload)
+			pipe.Publish(ctx, b.channel, payload)
+		}
+		pipe.LTrim(ctx, b.replayKey, -b.replaySize, -1)
+		return nil
+	})
+	return err
+}
+
+// Subscribe returns a subscription receiving the events published from now
+// on. When lastEventID is set, the events of the replay buffer published
+// after it are received first; all of them are when it is no longer in the
+// buffer. The subscription ends when ctx is done, it is closed, or it falls
+// more than a buffer behind the published events.
+func (b *Broker) Subscribe(ctx context.Context, lastEventID string) (*Subscription, error) {
+	sub := &Subscription{
+		broker: b,
+		live:   make(chan event.Event, subscriptionBuffer),
+		events: make(chan event.Event, subscriptionBuffer),
+		done:   make(chan struct{}),
+	}
+	// Register before reading the replay buffer, so that no event published
+	// after it is read can be missed.
+	if err := b.add(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	var replay []event.Event
+	if lastEventID != "" {
+		var err error
+		replay, err = b.replay(ctx, lastEventID)
+		if err != nil {
+			_ = sub.Close()
+			return nil, err
+		}
+	}
+
+	go sub.forward(ctx, replay)
+	return sub, nil
+}
+
+// Close ends every subscription and the Redis subscription of the
+// instance.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		close(sub.live)
+	}
+	if b.pubsub == nil {
+		return nil
+	}
+	return b.pubsub.Close()
+}
+
+// add registers sub, subscribing to the channel for the first subscriber.
+func (b *Broker) add(ctx context.Context, sub *Subscription) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBrokerClosed
+	}
+	if b.pubsub == nil {
+		// The subscription outlives the request of the first subscriber.
+		pubsub := b.rdb.Subscribe(context.WithoutCancel(ctx), b.channel)
+		// Wait for the subscription, so that events published from now on
+		// reach sub.
+		if _, err := pubsub.Receive(ctx); err != nil {
+			_ = pubsub.Close()
+			return err
+		}
+		b.pubsub = pubsub
+		go b.dispatch(pubsub.Channel())
+	}
+	b.subs[sub] = struct{}{}
+	return nil
+}
+
+// remove unregisters sub, ending its live events.
+func (b *Broker) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.live)
+	}
+}
+
+// dispatch sends the published events to every subscriber until the Redis
+// subscription is closed. A subscriber whose buffer is full is dropped
+// rather than holding the others back; its client resumes with
+// Last-Event-ID.
+func (b *Broker) dispatch(messages <-chan *redis.Message) {
+	for msg := range messages {
+		var e event.Event
+		if err := json.Unmarshal([]byte(msg.Payload), &e); err != nil {
+			utils.Logger.Error("Failed to decode published event", "error", err)
+			continue
+		}
+		b.mu.Lock()
+		for sub := range b.subs {
+			select {
+			case sub.live <- e:
+			default:
+				utils.Logger.Warn("Dropping slow event subscriber")
+				delete(b.subs, sub)
+				close(sub.live)
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+// replay returns the events of the replay buffer published after
+// lastEventID.
+func (b *Broker) replay(ctx context.Context, lastEventID string) ([]event.Event, error) {
+	payloads, err := b.rdb.LRange(ctx, b.replayKey, 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	events := make([]event.Event, 0, len(payloads))
+	for _, payload := range payloads {
+		var e event.Event
+		if err := json.Unmarshal([]byte(payload), &e); err != nil {
+			return nil, err
+		}
+		if e.ID == lastEventID {
+			events = events[:0]
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// Subscription receives the events published to a Broker.
+type Subscription struct {
+	broker *Broker
+	// live receives the published events from the broker, which closes it
+	// when the subscription is dropped.
+	live      chan event.Event
+	events    chan event.Event
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Events returns the channel receiving the events. It is closed when the
+// subscription ends.
+func (s *Subscription) Events() <-chan event.Event {
+	return s.events
+}
+
+// Close ends the subscription.
+func (s *Subscription) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.broker.remove(s)
+	})
+	return nil
+}
+
+// forward sends the replayed events, then the published ones, skipping
+// those that were both in the replay buffer and published after
+// subscribing.
+func (s *Subscription) forward(ctx context.Context, replay []event.Event) {
+	defer close(s.events)
+	defer s.Close()
+
+	replayed := make(map[string]bool, len(replay))
+	for _, e := range replay {
+		replayed[e.ID] = true
+		if !s.send(ctx, e) {
+			return
+		}
+	}
+
+	for {
+		select {
+		case e, ok := <-s.live:
+			if !ok {
+				return
+			}
+			if replayed[e.ID] {
+				delete(replayed, e.ID)
+				continue
+			}
+			if !s.send(ctx, e) {
+				return
+			}
+		case <-s.done:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *Subscription) send(ctx context.Context, e event.Event) bool {
+	select {
+	case s.events <- e:
+		return true
+	case <-s.done:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
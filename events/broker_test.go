@@ -0,0 +1,180 @@
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/storage/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newEvents returns n user.deleted events.
+func newEvents(t *testing.T, n int) []event.Event {
+	t.Helper()
+	events := make([]event.Event, n)
+	for i := range events {
+		e, err := event.New(event.TypeUserDeleted, event.UserDeleted{ID: i + 1})
+		require.NoError(t, err)
+		events[i] = e
+	}
+	return events
+}
+
+// receive returns the next n events of sub.
+func receive(t *testing.T, sub *Subscription, n int) []event.Event {
+	t.Helper()
+	var received []event.Event
+	for len(received) < n {
+		select {
+		case e, ok := <-sub.Events():
+			require.True(t, ok, "subscription ended")
+			received = append(received, e)
+		case <-time.After(time.Second):
+			require.FailNow(t, "timed out waiting for events", "received %d of %d", len(received), n)
+		}
+	}
+	return received
+}
+
+func TestBroker(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should deliver published events to every subscriber", func(t *testing.T) {
+		// Arrange
+		broker := NewBroker(storagetest.NewRedisClient(t), &config.EventsConfig{})
+		first, err := broker.Subscribe(ctx, "")
+		require.NoError(t, err)
+		defer first.Close()
+		second, err := broker.Subscribe(ctx, "")
+		require.NoError(t, err)
+		defer second.Close()
+		events := newEvents(t, 3)
+
+		// Act
+		err = broker.Publish(ctx, events)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, eventIDs(events), eventIDs(receive(t, first, 3)))
+		assert.Equal(t, eventIDs(events), eventIDs(receive(t, second, 3)))
+	})
+
+	t.Run("should replay the events published after Last-Event-ID first", func(t *testing.T) {
+		// Arrange
+		broker := NewBroker(storagetest.NewRedisClient(t), &config.EventsConfig{})
+		missed := newEvents(t, 3)
+		require.NoError(t, broker.Publish(ctx, missed))
+		sub, err := broker.Subscribe(ctx, missed[0].ID)
+		require.NoError(t, err)
+		defer sub.Close()
+		live := newEvents(t, 1)
+
+		// Act
+		err = broker.Publish(ctx, live)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, eventIDs(append(missed[1:], live...)), eventIDs(receive(t, sub, 3)))
+	})
+
+	t.Run("should replay the whole buffer when Last-Event-ID is no longer in it", func(t *testing.T) {
+		// Arrange
+		broker := NewBroker(storagetest.NewRedisClient(t), &config.EventsConfig{ReplaySize: 2})
+		events := newEvents(t, 4)
+		require.NoError(t, broker.Publish(ctx, events))
+
+		// Act
+		sub, err := broker.Subscribe(ctx, events[0].ID)
+
+		// Assert
+		require.NoError(t, err)
+		defer sub.Close()
+		assert.Equal(t, eventIDs(events[2:]), eventIDs(receive(t, sub, 2)))
+	})
+
+	t.Run("should end the subscription when ctx is done", func(t *testing.T) {
+		// Arrange
+		broker := NewBroker(storagetest.NewRedisClient(t), &config.EventsConfig{})
+		subCtx, cancel := context.WithCancel(ctx)
+		sub, err := broker.Subscribe(subCtx, "")
+		require.NoError(t, err)
+
+		// Act
+		cancel()
+
+		// Assert
+		select {
+		case _, ok := <-sub.Events():
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			assert.Fail(t, "subscription did not end")
+		}
+	})
+
+	t.Run("should share one Redis subscription between subscribers", func(t *testing.T) {
+		// Arrange
+		rdb := storagetest.NewRedisClient(t)
+		broker := NewBroker(rdb, &config.EventsConfig{})
+		t.Cleanup(func() { _ = broker.Close() })
+
+		// Act
+		for range 3 {
+			sub, err := broker.Subscribe(ctx, "")
+			require.NoError(t, err)
+			defer sub.Close()
+		}
+
+		// Assert
+		counts, err := rdb.PubSubNumSub(ctx, defaultChannel).Result()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), counts[defaultChannel])
+	})
+
+	t.Run("should drop subscribers falling a buffer behind", func(t *testing.T) {
+		// Arrange
+		broker := NewBroker(storagetest.NewRedisClient(t), &config.EventsConfig{})
+		t.Cleanup(func() { _ = broker.Close() })
+		slow, err := broker.Subscribe(ctx, "")
+		require.NoError(t, err)
+		events := newEvents(t, 3*subscriptionBuffer)
+
+		// Act
+		require.NoError(t, broker.Publish(ctx, events))
+
+		// Assert
+		received := 0
+		for range slow.Events() {
+			received++
+		}
+		assert.Less(t, received, len(events))
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+		assert.Empty(t, broker.subs)
+	})
+
+	t.Run("should end every subscription when closed", func(t *testing.T) {
+		// Arrange
+		broker := NewBroker(storagetest.NewRedisClient(t), &config.EventsConfig{})
+		sub, err := broker.Subscribe(ctx, "")
+		require.NoError(t, err)
+
+		// Act
+		closeErr := broker.Close()
+		_, subscribeErr := broker.Subscribe(ctx, "")
+
+		// Assert
+		require.NoError(t, closeErr)
+		assert.ErrorIs(t, subscribeErr, ErrBrokerClosed)
+		select {
+		case _, ok := <-sub.Events():
+			assert.False(t, ok)
+		case <-time.After(time.Second):
+			assert.Fail(t, "subscription did not end")
+		}
+	})
+}
@@ -0,0 +1,23 @@
+package events
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	eventsPublishedTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "events_published_total",
+			Help: "Total number of outbox events published to every sink by this instance.",
+		},
+	)
+	relayFailuresTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "events_relay_failures_total",
+			Help: "Total number of failed attempts to publish outbox events.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(eventsPublishedTotal)
+	prometheus.MustRegister(relayFailuresTotal)
+}
@@ -0,0 +1,167 @@
+package events
+
+import (
+	"context"
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/storage"
+	"http-server/utils"
+	"sync"
+	"time"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+)
+
+// Relay publishes the events of the outbox to its sinks, in the order they
+// were appended, and marks them as sent. Each batch is published and marked
+// in one transaction, which locks the events so relays of other instances
+// wait for it instead of publishing them too. Events are published again
+// when marking fails, so delivery is at-least-once.
+type Relay struct {
+	outbox       storage.OutboxRepository
+	txManager    storage.TxManager
+	sinks        []Sink
+	pollInterval time.Duration
+	batchSize    int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// runCtx is passed to batches being published and cancelled when Stop
+	// stops waiting for them.
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	done      chan struct{}
+}
+
+// NewRelay creates a Relay publishing the events of outbox to sinks.
+func NewRelay(outbox storage.OutboxRepository, txManager storage.TxManager, cfg *config.EventsConfig, sinks ...Sink) *Relay {
+	pollInterval := cfg.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+	batchSize := cfg.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	return &Relay{
+		outbox:       outbox,
+		txManager:    txManager,
+		sinks:        sinks,
+		pollInterval: pollInterval,
+		batchSize:    batchSize,
+		stop:         make(chan struct{}),
+		runCtx:       runCtx,
+		cancelRun:    cancelRun,
+		done:         make(chan struct{}),
+	}
+}
+
+// Start starts polling the outbox.
+func (r *Relay) Start() {
+	go r.loop()
+}
+
+// Stop stops polling and waits for the batch being published. When ctx is
+// done first, the batch is cancelled and published again later.
+func (r *Relay) Stop(ctx context.Context) error {
+	r.stopOnce.Do(func() { close(r.stop) })
+
+	select {
+	case <-r.done:
+		r.cancelRun()
+		return nil
+	case <-ctx.Done():
+		r.cancelRun()
+		return ctx.Err()
+	}
+}
+
+// Flush publishes pending events batch by batch until none is left, and
+// returns how many were published.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := r.publishBatch(ctx)
+		total += n
+		if err != nil || n < r.batchSize {
+			return total, err
+		}
+	}
+}
+
+// loop flushes the outbox every poll interval until the relay stops.
+func (r *Relay) loop() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		if _, err := r.Flush(r.runCtx); err != nil {
+			relayFailuresTotal.Inc()
+			utils.Logger.Error("Failed to publish events", "error", err)
+		}
+	}
+}
+
+// publishBatch publishes the oldest pending events to every sink and marks
+// them as sent.
+func (r *Relay) publishBatch(ctx context.Context) (int, error) {
+	var n int
+	err := r.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		events, err := r.outbox.Pending(ctx, r.batchSize)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		for _, sink := range r.sinks {
+			if err := sink.Publish(ctx, events); err != nil {
+				return err
+			}
+		}
+		if err := r.outbox.MarkSent(ctx, eventIDs(events)); err != nil {
+			return err
+		}
+		n = len(events)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	eventsPublishedTotal.Add(float64(n))
+	return n, nil
+}
+
+// PurgeSentEventsTask returns a scheduler task deleting the events
+// published longer than retention ago. A zero retention keeps them forever.
+func PurgeSentEventsTask(outbox storage.OutboxRepository, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if retention <= 0 {
+			return nil
+		}
+		n, err := outbox.PurgeSent(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			utils.LoggerFromContext(ctx).Info("Purged sent events", "count", n, "retention", retention.String())
+		}
+		return nil
+	}
+}
+
+func eventIDs(events []event.Event) []string {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
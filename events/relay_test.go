@@ -0,0 +1,161 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/storage"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+// appendEvents appends n user.deleted events to outbox and returns them.
+func appendEvents(t *testing.T, outbox storage.OutboxRepository, n int) []event.Event {
+	t.Helper()
+	events := make([]event.Event, n)
+	for i := range events {
+		e, err := event.New(event.TypeUserDeleted, event.UserDeleted{ID: i + 1})
+		require.NoError(t, err)
+		events[i] = e
+	}
+	require.NoError(t, outbox.Append(context.Background(), events...))
+	return events
+}
+
+// failingSink fails until it is told to succeed, recording what it received.
+type failingSink struct {
+	fail      bool
+	published []event.Event
+}
+
+func (s *failingSink) Publish(ctx context.Context, events []event.Event) error {
+	if s.fail {
+		return errors.New("sink unavailable")
+	}
+	s.published = append(s.published, events...)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should publish events to the stream in order and mark them as sent", func(t *testing.T) {
+		// Arrange
+		rdb := storagetest.NewRedisClient(t)
+		outbox := storage.NewMemoryOutboxRepository()
+		events := appendEvents(t, outbox, 5)
+		relay := NewRelay(outbox, storage.NewNoopTxManager(), &config.EventsConfig{BatchSize: 2}, NewRedisStreamSink(rdb, "", 0))
+
+		// Act
+		n, err := relay.Flush(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, 5, n)
+		entries, err := rdb.XRange(ctx, defaultStream, "-", "+").Result()
+		require.NoError(t, err)
+		require.Len(t, entries, 5)
+		for i, entry := range entries {
+			assert.Equal(t, events[i].ID, entry.Values["id"])
+			assert.Equal(t, event.TypeUserDeleted, entry.Values["type"])
+			assert.Equal(t, events[i].OccurredAt.Format(time.RFC3339Nano), entry.Values["occurred_at"])
+			assert.JSONEq(t, string(events[i].Data), entry.Values["data"].(string))
+		}
+		pending, err := outbox.Pending(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("should keep events pending until every sink published them", func(t *testing.T) {
+		// Arrange
+		outbox := storage.NewMemoryOutboxRepository()
+		events := appendEvents(t, outbox, 2)
+		healthy, broken := &failingSink{}, &failingSink{fail: true}
+		relay := NewRelay(outbox, storage.NewNoopTxManager(), &config.EventsConfig{}, healthy, broken)
+
+		// Act
+		_, errFailed := relay.Flush(ctx)
+		broken.fail = false
+		n, errRetried := relay.Flush(ctx)
+
+		// Assert
+		assert.EqualError(t, errFailed, "sink unavailable")
+		require.NoError(t, errRetried)
+		assert.Equal(t, 2, n)
+		assert.Equal(t, append(events, events...), healthy.published)
+		assert.Equal(t, events, broken.published)
+	})
+
+	t.Run("should publish new events until stopped", func(t *testing.T) {
+		// Arrange
+		outbox := storage.NewMemoryOutboxRepository()
+		sink := &failingSink{}
+		relay := NewRelay(outbox, storage.NewNoopTxManager(), &config.EventsConfig{PollInterval: 5 * time.Millisecond}, sink)
+		relay.Start()
+
+		// Act
+		events := appendEvents(t, outbox, 3)
+
+		// Assert
+		assert.Eventually(t, func() bool {
+			pending, err := outbox.Pending(ctx, 10)
+			return err == nil && len(pending) == 0
+		}, time.Second, 5*time.Millisecond)
+		assert.NoError(t, relay.Stop(ctx))
+		assert.Equal(t, events, sink.published)
+	})
+}
+
+func TestPurgeSentEventsTask(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should delete events sent before the retention", func(t *testing.T) {
+		// Arrange
+		outbox := storage.NewMemoryOutboxRepository()
+		events := appendEvents(t, outbox, 1)
+		require.NoError(t, outbox.MarkSent(ctx, []string{events[0].ID}))
+		time.Sleep(5 * time.Millisecond)
+
+		// Act
+		err := PurgeSentEventsTask(outbox, time.Millisecond)(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		left, err := outbox.PurgeSent(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), left)
+	})
+
+	t.Run("should keep events forever without retention", func(t *testing.T) {
+		// Arrange
+		outbox := storage.NewMemoryOutboxRepository()
+		events := appendEvents(t, outbox, 1)
+		require.NoError(t, outbox.MarkSent(ctx, []string{events[0].ID}))
+
+		// Act
+		err := PurgeSentEventsTask(outbox, 0)(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		left, err := outbox.PurgeSent(ctx, time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), left)
+	})
+}
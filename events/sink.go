@@ -0,0 +1,65 @@
+// Package events publishes the domain events stored in the outbox to
+// external sinks.
+package events
+
+import (
+	"context"
+	"http-server/dto/event"
+	"http-server/storage"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	defaultStream       = "events:users"
+	defaultStreamMaxLen = 100000
+)
+
+// Sink delivers events to consumers outside the service.
+type Sink interface {
+	// Publish delivers events in order. When it fails, the relay publishes
+	// all of them again, so sinks may receive an event more than once.
+	Publish(ctx context.Context, events []event.Event) error
+}
+
+// RedisStreamSink appends events to a Redis stream. Each entry has the
+// fields id, type, occurred_at and data.
+type RedisStreamSink struct {
+	rdb    *storage.RedisClient
+	stream string
+	maxLen int64
+}
+
+// NewRedisStreamSink creates a sink appending to stream, which is trimmed to
+// about maxLen entries. They default to events:users and 100000.
+func NewRedisStreamSink(rdb *storage.RedisClient, stream string, maxLen int64) *RedisStreamSink {
+	if stream == "" {
+		stream = defaultStream
+	}
+	if maxLen <= 0 {
+		maxLen = defaultStreamMaxLen
+	}
+	return &RedisStreamSink{rdb: rdb, stream: stream, maxLen: maxLen}
+}
+
+// Publish appends events to the stream in a single pipeline.
+func (s *RedisStreamSink) Publish(ctx context.Context, events []event.Event) error {
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, e := range events {
+			pipe.XAdd(ctx, &redis.XAddArgs{
+				Stream: s.stream,
+				MaxLen: s.maxLen,
+				Approx: true,
+				Values: []any{
+					"id", e.ID,
+					"type", e.Type,
+					"occurred_at", e.OccurredAt.UTC().Format(time.RFC3339Nano),
+					"data", string(e.Data),
+				},
+			})
+		}
+		return nil
+	})
+	return err
+}
@@ -0,0 +1,64 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"http-server/storage"
+	"http-server/utils"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+// Error codes, reported in the code extension of GraphQL errors.
+const (
+	CodeBadUserInput    = "BAD_USER_INPUT"
+	CodeForbidden       = "FORBIDDEN"
+	CodeNotFound        = "NOT_FOUND"
+	CodeConflict        = "CONFLICT"
+	CodeVersionMismatch = "VERSION_MISMATCH"
+	CodeQueryTooComplex = "QUERY_TOO_COMPLEX"
+	CodeInternalError   = "INTERNAL_SERVER_ERROR"
+)
+
+// Error is a GraphQL error with a code extension.
+type Error struct {
+	Message string
+	Code    string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Extensions implements gqlerrors.ExtendedError.
+func (e *Error) Extensions() map[string]any {
+	return map[string]any{"code": e.Code}
+}
+
+// formatted returns e as the errors of a response, for errors reported
+// before execution, which gqlerrors would format without extensions.
+func (e *Error) formatted() []gqlerrors.FormattedError {
+	return []gqlerrors.FormattedError{{
+		Message:    e.Message,
+		Locations:  []location.SourceLocation{},
+		Extensions: e.Extensions(),
+	}}
+}
+
+func newError(code, message string) *Error {
+	return &Error{Message: message, Code: code}
+}
+
+// userError converts an error of the user service to a GraphQL error.
+// Unexpected errors are logged and reported as failing to do action.
+func userError(ctx context.Context, err error, action string) error {
+	switch {
+	case errors.Is(err, storage.ErrUserNotFound):
+		return newError(CodeNotFound, "User not found")
+	case errors.Is(err, storage.ErrEmailTaken):
+		return newError(CodeConflict, "Email already taken")
+	case errors.Is(err, storage.ErrVersionMismatch):
+		return newError(CodeVersionMismatch, "User has been modified")
+	}
+	utils.LoggerFromContext(ctx).Error("Failed to "+action, "error", err)
+	return newError(CodeInternalError, "Failed to "+action)
+}
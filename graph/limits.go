@@ -0,0 +1,138 @@
+package graph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// maxIntrospectionDepth is the deepest nesting of introspection fields,
+// such as __schema or __type, and the fields under them. It is fixed rather
+// than maxDepth so that tools can always fetch the schema, whose type
+// references nest a few ofType fields deep.
+const maxIntrospectionDepth = 15
+
+// checkLimits rejects the operation of doc named operationName when its
+// fields nest deeper than maxDepth, its introspection fields deeper than
+// maxIntrospectionDepth, or its complexity exceeds maxComplexity. Every
+// field costs 1, introspection ones included, and the fields under a field
+// with a first argument cost once per item requested.
+func checkLimits(doc *ast.Document, operationName string, variables map[string]any, maxDepth, maxComplexity int) *Error {
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, def := range doc.Definitions {
+		if def, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[def.Name.Value] = def
+		}
+	}
+	operation := findOperation(doc, operationName)
+	if operation == nil {
+		// Execution reports the missing operation
+		return nil
+	}
+
+	a := &analyzer{fragments: fragments, variables: variables}
+	depth, complexity := a.selectionSet(operation.SelectionSet, map[string]bool{})
+	if depth > maxDepth {
+		return newError(CodeQueryTooComplex, fmt.Sprintf("Query depth %d exceeds the maximum of %d", depth, maxDepth))
+	}
+	if a.introspectionDepth > maxIntrospectionDepth {
+		return newError(CodeQueryTooComplex, fmt.Sprintf("Introspection depth %d exceeds the maximum of %d", a.introspectionDepth, maxIntrospectionDepth))
+	}
+	if complexity > maxComplexity {
+		return newError(CodeQueryTooComplex, fmt.Sprintf("Query complexity %d exceeds the maximum of %d", complexity, maxComplexity))
+	}
+	return nil
+}
+
+// findOperation returns the operation of doc named operationName, or the
+// last one when operationName is empty, or nil.
+func findOperation(doc *ast.Document, operationName string) *ast.OperationDefinition {
+	var operation *ast.OperationDefinition
+	for _, def := range doc.Definitions {
+		if def, ok := def.(*ast.OperationDefinition); ok {
+			if operationName == "" || (def.Name != nil && def.Name.Value == operationName) {
+				operation = def
+			}
+		}
+	}
+	return operation
+}
+
+type analyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]any
+	// introspectionDepth is the depth of the deepest introspection field
+	// and the fields under it, which are left out of the query depth.
+	introspectionDepth int
+}
+
+// selectionSet returns the depth and complexity of set. visiting holds the
+// fragments being expanded, which validation guarantees not to form
+// cycles; it is checked anyway so that a bug cannot hang requests.
+func (a *analyzer) selectionSet(set *ast.SelectionSet, visiting map[string]bool) (depth, complexity int) {
+	if set == nil {
+		return 0, 0
+	}
+	for _, selection := range set.Selections {
+		var d, c int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childDepth, childComplexity := a.selectionSet(selection.SelectionSet, visiting)
+			d = 1 + childDepth
+			c = 1 + a.multiplier(selection)*childComplexity
+			if strings.HasPrefix(selection.Name.Value, "__") {
+				a.introspectionDepth = max(a.introspectionDepth, d)
+				d = 0
+			}
+		case *ast.InlineFragment:
+			d, c = a.selectionSet(selection.SelectionSet, visiting)
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := a.fragments[name]
+			if !ok || visiting[name] {
+				continue
+			}
+			visiting[name] = true
+			d, c = a.selectionSet(fragment.SelectionSet, visiting)
+			delete(visiting, name)
+		}
+		depth = max(depth, d)
+		complexity += c
+	}
+	return depth, complexity
+}
+
+// multiplier returns the number of items field requests: its first
+// argument, or defaultPageSize for a paginated field without one.
+func (a *analyzer) multiplier(field *ast.Field) int {
+	for _, arg := range field.Arguments {
+		if arg.Name.Value != "first" {
+			continue
+		}
+		switch value := arg.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			// Variables decoded from JSON are float64
+			switch n := a.variables[value.Name.Value].(type) {
+			case float64:
+				if n > 0 {
+					return int(n)
+				}
+			case int:
+				if n > 0 {
+					return n
+				}
+			}
+		}
+		return defaultPageSize
+	}
+	if field.Name.Value == "users" {
+		return defaultPageSize
+	}
+	return 1
+}
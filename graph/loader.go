@@ -0,0 +1,70 @@
+package graph
+
+import (
+	"context"
+	"http-server/dto/user"
+	"http-server/services"
+	"http-server/storage"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+)
+
+// loaderWait is how long the user loader collects keys before fetching
+// them.
+const loaderWait = time.Millisecond
+
+// userKey identifies a user lookup.
+type userKey struct {
+	ID             int
+	IncludeDeleted bool
+}
+
+type resolverCtxKey struct{}
+
+// resolverContext holds the state shared by the resolvers of a request.
+type resolverContext struct {
+	service services.UserService
+	users   *dataloader.Loader[userKey, *user.User]
+}
+
+// withResolverContext returns a copy of ctx holding a fresh user loader,
+// so that lookups are only cached for the duration of a request.
+func withResolverContext(ctx context.Context, service services.UserService) context.Context {
+	rc := &resolverContext{
+		service: service,
+		users:   dataloader.NewBatchedLoader(batchGetUsers(service), dataloader.WithWait[userKey, *user.User](loaderWait)),
+	}
+	return context.WithValue(ctx, resolverCtxKey{}, rc)
+}
+
+func resolverContextFrom(ctx context.Context) *resolverContext {
+	return ctx.Value(resolverCtxKey{}).(*resolverContext)
+}
+
+// batchGetUsers returns a batch function getting the users of a batch of
+// distinct keys with one query per filter, so at most two. Users that do
+// not exist resolve to nil.
+func batchGetUsers(service services.UserService) dataloader.BatchFunc[userKey, *user.User] {
+	return func(ctx context.Context, keys []userKey) []*dataloader.Result[*user.User] {
+		ids := make(map[bool][]int, 2)
+		for _, key := range keys {
+			ids[key.IncludeDeleted] = append(ids[key.IncludeDeleted], key.ID)
+		}
+		found := make(map[userKey]*user.User, len(keys))
+		errs := make(map[bool]error, 2)
+		for includeDeleted, batch := range ids {
+			users, err := service.GetUsersByIDs(ctx, batch, storage.UserFilter{IncludeDeleted: includeDeleted})
+			errs[includeDeleted] = err
+			for i := range users {
+				found[userKey{ID: users[i].ID, IncludeDeleted: includeDeleted}] = &users[i]
+			}
+		}
+
+		results := make([]*dataloader.Result[*user.User], len(keys))
+		for i, key := range keys {
+			results[i] = &dataloader.Result[*user.User]{Data: found[key], Error: errs[key.IncludeDeleted]}
+		}
+		return results
+	}
+}
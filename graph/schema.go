@@ -0,0 +1,329 @@
+package graph
+
+import (
+	"encoding/base64"
+	"fmt"
+	"http-server/dto/user"
+	"http-server/middleware"
+	"http-server/storage"
+	"strconv"
+	"strings"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"github.com/graphql-go/graphql"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+	cursorPrefix    = "user:"
+)
+
+var userType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "User",
+	Fields: graphql.Fields{
+		"id":    &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+		"name":  &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"email": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"version": &graphql.Field{
+			Type:        graphql.NewNonNull(graphql.Int),
+			Description: "Incremented by every change. Pass it as expectedVersion to avoid overwriting concurrent changes.",
+		},
+		"deletedAt": &graphql.Field{
+			Type:        graphql.DateTime,
+			Description: "Set while the user is soft-deleted.",
+			Resolve: func(p graphql.ResolveParams) (any, error) {
+				if u := p.Source.(*user.User); u.DeletedAt != nil {
+					return u.DeletedAt.UTC(), nil
+				}
+				return nil, nil
+			},
+		},
+	},
+})
+
+var userEdgeType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserEdge",
+	Fields: graphql.Fields{
+		"cursor": &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+		"node":   &graphql.Field{Type: graphql.NewNonNull(userType)},
+	},
+})
+
+var pageInfoType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "PageInfo",
+	Fields: graphql.Fields{
+		"hasNextPage":     &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"hasPreviousPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+		"startCursor":     &graphql.Field{Type: graphql.String},
+		"endCursor":       &graphql.Field{Type: graphql.String},
+	},
+})
+
+var userConnectionType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "UserConnection",
+	Fields: graphql.Fields{
+		"edges":      &graphql.Field{Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userEdgeType)))},
+		"pageInfo":   &graphql.Field{Type: graphql.NewNonNull(pageInfoType)},
+		"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int), Description: "Number of users matching the filter.", Resolve: resolveTotalCount},
+	},
+})
+
+var userFilterType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserFilter",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"includeDeleted": &graphql.InputObjectFieldConfig{
+			Type:        graphql.Boolean,
+			Description: "Also return soft-deleted users (admins only).",
+		},
+		"search": &graphql.InputObjectFieldConfig{
+			Type:        graphql.String,
+			Description: "Only return users whose name or email contains this text, ignoring case.",
+		},
+	},
+})
+
+var userInputType = graphql.NewInputObject(graphql.InputObjectConfig{
+	Name: "UserInput",
+	Fields: graphql.InputObjectConfigFieldMap{
+		"name":  &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		"email": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+	},
+})
+
+// newSchema builds the GraphQL schema.
+func newSchema() (graphql.Schema, error) {
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type:        userType,
+				Description: "Get a user by ID, or null if there is none.",
+				Args: graphql.FieldConfigArgument{
+					"id":             &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"includeDeleted": &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Also return a soft-deleted user (admins only)."},
+				},
+				Resolve: resolveUser,
+			},
+			"users": &graphql.Field{
+				Type:        graphql.NewNonNull(userConnectionType),
+				Description: "List users by ID.",
+				Args: graphql.FieldConfigArgument{
+					"first":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize, Description: fmt.Sprintf("Number of users to return, at most %d.", maxPageSize)},
+					"after":  &graphql.ArgumentConfig{Type: graphql.String, Description: "Return the users after this cursor."},
+					"filter": &graphql.ArgumentConfig{Type: userFilterType},
+				},
+				Resolve: resolveUsers,
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(userInputType)},
+				},
+				Resolve: resolveCreateUser,
+			},
+			"updateUser": &graphql.Field{
+				Type:        graphql.NewNonNull(userType),
+				Description: "Replace the name and email of a user.",
+				Args: graphql.FieldConfigArgument{
+					"id":              &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"input":           &graphql.ArgumentConfig{Type: graphql.NewNonNull(userInputType)},
+					"expectedVersion": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Version the user must still have."},
+				},
+				Resolve: resolveUpdateUser,
+			},
+			"deleteUser": &graphql.Field{
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Soft-delete a user, or delete it permanently (admins only).",
+				Args: graphql.FieldConfigArgument{
+					"id":              &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.Int)},
+					"permanent":       &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+					"expectedVersion": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Version the user must still have."},
+				},
+				Resolve: resolveDeleteUser,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+}
+
+// ============== QUERIES ==============
+
+// resolveUser loads the user through the request's loader, so that the
+// lookups of a query are batched.
+func resolveUser(p graphql.ResolveParams) (any, error) {
+	includeDeleted, _ := p.Args["includeDeleted"].(bool)
+	if includeDeleted && !middleware.IsAdmin(p.Context) {
+		return nil, newError(CodeForbidden, "Only admins can include deleted users")
+	}
+	id, _ := p.Args["id"].(int)
+
+	thunk := resolverContextFrom(p.Context).users.Load(p.Context, userKey{ID: id, IncludeDeleted: includeDeleted})
+	return func() (any, error) {
+		u, err := thunk()
+		if err != nil {
+			return nil, userError(p.Context, err, "get user")
+		}
+		if u == nil {
+			// A typed nil would not resolve to null
+			return nil, nil
+		}
+		return u, nil
+	}, nil
+}
+
+func resolveUsers(p graphql.ResolveParams) (any, error) {
+	first, _ := p.Args["first"].(int)
+	if first < 0 || first > maxPageSize {
+		return nil, newError(CodeBadUserInput, fmt.Sprintf("first must be between 0 and %d", maxPageSize))
+	}
+	var q storage.UserQuery
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		var err error
+		if q.AfterID, err = decodeCursor(after); err != nil {
+			return nil, newError(CodeBadUserInput, "Invalid cursor")
+		}
+	}
+	if args, ok := p.Args["filter"].(map[string]any); ok {
+		q.Filter.IncludeDeleted, _ = args["includeDeleted"].(bool)
+		q.Search, _ = args["search"].(string)
+	}
+	if q.Filter.IncludeDeleted && !middleware.IsAdmin(p.Context) {
+		return nil, newError(CodeForbidden, "Only admins can include deleted users")
+	}
+
+	rc := resolverContextFrom(p.Context)
+	edges := []map[string]any{}
+	hasNextPage := false
+	if first > 0 {
+		// One more user than asked tells whether a next page exists
+		page := q
+		page.Limit = first + 1
+		users, err := rc.service.ListUsers(p.Context, page)
+		if err != nil {
+			return nil, userError(p.Context, err, "get users")
+		}
+		hasNextPage = len(users) > first
+		users = users[:min(first, len(users))]
+		for i := range users {
+			u := &users[i]
+			rc.users.Prime(p.Context, userKey{ID: u.ID, IncludeDeleted: q.Filter.IncludeDeleted}, u)
+			edges = append(edges, map[string]any{"cursor": encodeCursor(u.ID), "node": u})
+		}
+	}
+
+	hasPreviousPage := false
+	if q.AfterID > 0 {
+		// A previous page exists when the first matching user comes
+		// before the cursor
+		head := q
+		head.AfterID, head.Limit = 0, 1
+		users, err := rc.service.ListUsers(p.Context, head)
+		if err != nil {
+			return nil, userError(p.Context, err, "get users")
+		}
+		hasPreviousPage = len(users) > 0 && users[0].ID <= q.AfterID
+	}
+
+	pageInfo := map[string]any{
+		"hasNextPage":     hasNextPage,
+		"hasPreviousPage": hasPreviousPage,
+	}
+	if len(edges) > 0 {
+		pageInfo["startCursor"] = edges[0]["cursor"]
+		pageInfo["endCursor"] = edges[len(edges)-1]["cursor"]
+	}
+	return map[string]any{"edges": edges, "pageInfo": pageInfo, "query": q}, nil
+}
+
+// resolveTotalCount counts the users of a connection, so that the count
+// query only runs when totalCount is selected.
+func resolveTotalCount(p graphql.ResolveParams) (any, error) {
+	q := p.Source.(map[string]any)["query"].(storage.UserQuery)
+	n, err := resolverContextFrom(p.Context).service.CountUsers(p.Context, q)
+	if err != nil {
+		return nil, userError(p.Context, err, "count users")
+	}
+	return n, nil
+}
+
+// encodeCursor returns the opaque cursor of the user with the given ID.
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, ok := strings.CutPrefix(string(data), cursorPrefix)
+	if !ok {
+		return 0, fmt.Errorf("invalid cursor %q", cursor)
+	}
+	return strconv.Atoi(id)
+}
+
+// ============== MUTATIONS ==============
+
+func resolveCreateUser(p graphql.ResolveParams) (any, error) {
+	input := p.Args["input"].(map[string]any)
+	req := &user.CreateUserRequest{Name: input["name"].(string), Email: input["email"].(string)}
+
+	createdUser, err := resolverContextFrom(p.Context).service.CreateUser(p.Context, req)
+	if err != nil {
+		return nil, userError(p.Context, err, "create user")
+	}
+	return createdUser, nil
+}
+
+func resolveUpdateUser(p graphql.ResolveParams) (any, error) {
+	id, _ := p.Args["id"].(int)
+	version, _ := p.Args["expectedVersion"].(int)
+	input := p.Args["input"].(map[string]any)
+	req := &user.UpdateUserRequest{Name: input["name"].(string), Email: input["email"].(string)}
+
+	rc := resolverContextFrom(p.Context)
+	updatedUser, err := rc.service.UpdateUser(p.Context, id, req, version)
+	if err != nil {
+		return nil, userError(p.Context, err, "update user")
+	}
+	clearUser(rc.users, p, id)
+	return updatedUser, nil
+}
+
+func resolveDeleteUser(p graphql.ResolveParams) (any, error) {
+	id, _ := p.Args["id"].(int)
+	version, _ := p.Args["expectedVersion"].(int)
+	permanent, _ := p.Args["permanent"].(bool)
+
+	rc := resolverContextFrom(p.Context)
+	var err error
+	if permanent {
+		if !middleware.IsAdmin(p.Context) {
+			return nil, newError(CodeForbidden, "Only admins can delete users permanently")
+		}
+		err = rc.service.PurgeUser(p.Context, id, version)
+	} else {
+		err = rc.service.DeleteUser(p.Context, id, version)
+	}
+	if err != nil {
+		return nil, userError(p.Context, err, "delete user")
+	}
+	clearUser(rc.users, p, id)
+	return true, nil
+}
+
+// clearUser evicts the user with the given ID from the loader, so that
+// later fields of the request see the change.
+func clearUser(loader *dataloader.Loader[userKey, *user.User], p graphql.ResolveParams, id int) {
+	loader.Clear(p.Context, userKey{ID: id})
+	loader.Clear(p.Context, userKey{ID: id, IncludeDeleted: true})
+}
@@ -0,0 +1,93 @@
+// Package graph serves a GraphQL API over services.UserService.
+package graph
+
+import (
+	"context"
+	"http-server/config"
+	"http-server/services"
+	"http-server/storage"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/graphql-go/graphql/language/source"
+)
+
+const (
+	defaultMaxDepth      = 10
+	defaultMaxComplexity = 1000
+)
+
+// Request is a GraphQL request, as posted to /graphql.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Server executes GraphQL requests.
+type Server struct {
+	schema        graphql.Schema
+	service       services.UserService
+	maxDepth      int
+	maxComplexity int
+}
+
+// NewServer creates a Server resolving users with service.
+func NewServer(service services.UserService, cfg *config.GraphQLConfig) (*Server, error) {
+	schema, err := newSchema()
+	if err != nil {
+		return nil, err
+	}
+	maxDepth := cfg.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = defaultMaxDepth
+	}
+	maxComplexity := cfg.MaxComplexity
+	if maxComplexity <= 0 {
+		maxComplexity = defaultMaxComplexity
+	}
+	return &Server{schema: schema, service: service, maxDepth: maxDepth, maxComplexity: maxComplexity}, nil
+}
+
+// Execute parses, validates and runs req. Queries exceeding the depth or
+// complexity limits are rejected before anything is resolved. Errors are
+// reported in the result.
+func (s *Server) Execute(ctx context.Context, req *Request) *graphql.Result {
+	result, _ := s.ExecuteOperation(ctx, req)
+	return result
+}
+
+// ExecuteOperation runs req like Execute and also reports whether it ran a
+// mutation. Mutations read from the primary database, so that they see
+// their own writes.
+func (s *Server) ExecuteOperation(ctx context.Context, req *Request) (*graphql.Result, bool) {
+	doc, err := parser.Parse(parser.ParseParams{Source: source.NewSource(&source.Source{
+		Body: []byte(req.Query),
+		Name: "GraphQL request",
+	})})
+	if err != nil {
+		return &graphql.Result{Errors: gqlerrors.FormatErrors(err)}, false
+	}
+	if validation := graphql.ValidateDocument(&s.schema, doc, nil); !validation.IsValid {
+		return &graphql.Result{Errors: validation.Errors}, false
+	}
+	if err := checkLimits(doc, req.OperationName, req.Variables, s.maxDepth, s.maxComplexity); err != nil {
+		return &graphql.Result{Errors: err.formatted()}, false
+	}
+
+	operation := findOperation(doc, req.OperationName)
+	mutation := operation != nil && operation.Operation == ast.OperationTypeMutation
+	if mutation {
+		ctx = storage.WithPrimary(ctx)
+	}
+	ctx = withResolverContext(ctx, s.service)
+	return graphql.Execute(graphql.ExecuteParams{
+		Schema:        s.schema,
+		AST:           doc,
+		OperationName: req.OperationName,
+		Args:          req.Variables,
+		Context:       ctx,
+	}), mutation
+}
@@ -0,0 +1,355 @@
+package graph
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"http-server/config"
+	user "http-server/dto/user"
+	"http-server/middleware"
+	"http-server/services"
+	"http-server/storage"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+// countingService counts the user lookups of a UserService.
+type countingService struct {
+	services.UserService
+	getUserCalls       atomic.Int32
+	getUsersByIDsCalls atomic.Int32
+	listUsersCalls     atomic.Int32
+	countUsersCalls    atomic.Int32
+	pinnedCreates      atomic.Int32
+}
+
+func (s *countingService) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error) {
+	if storage.UsesPrimary(ctx) {
+		s.pinnedCreates.Add(1)
+	}
+	return s.UserService.CreateUser(ctx, req)
+}
+
+func (s *countingService) GetUser(ctx context.Context, id int, filter storage.UserFilter) (*user.User, error) {
+	s.getUserCalls.Add(1)
+	return s.UserService.GetUser(ctx, id, filter)
+}
+
+func (s *countingService) GetUsersByIDs(ctx context.Context, ids []int, filter storage.UserFilter) ([]user.User, error) {
+	s.getUsersByIDsCalls.Add(1)
+	return s.UserService.GetUsersByIDs(ctx, ids, filter)
+}
+
+func (s *countingService) ListUsers(ctx context.Context, q storage.UserQuery) ([]user.User, error) {
+	s.listUsersCalls.Add(1)
+	return s.UserService.ListUsers(ctx, q)
+}
+
+func (s *countingService) CountUsers(ctx context.Context, q storage.UserQuery) (int, error) {
+	s.countUsersCalls.Add(1)
+	return s.UserService.CountUsers(ctx, q)
+}
+
+// newTestServer returns a server over an in-memory user service holding
+// the given number of users, named User 1, User 2 and so on.
+func newTestServer(t *testing.T, cfg *config.GraphQLConfig, users int) (*Server, *countingService) {
+	t.Helper()
+	rdb := storagetest.NewRedisClient(t)
+	service := &countingService{UserService: services.NewUserService(
+		storage.NewMemoryUserRepository(), storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), rdb)}
+	for i := 1; i <= users; i++ {
+		_, err := service.CreateUser(context.Background(), &user.CreateUserRequest{
+			Name:  fmt.Sprintf("User %d", i),
+			Email: fmt.Sprintf("user%d@example.com", i),
+		})
+		require.NoError(t, err)
+	}
+	server, err := NewServer(service, cfg)
+	require.NoError(t, err)
+	return server, service
+}
+
+// adminContext returns the context of a request authenticated as admin.
+func adminContext(t *testing.T) context.Context {
+	t.Helper()
+	var ctx context.Context
+	handler := middleware.BasicAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/graphql", nil)
+	req.SetBasicAuth("admin", "password")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	require.NotNil(t, ctx)
+	return ctx
+}
+
+// data returns the data of result as JSON, failing on errors.
+func data(t *testing.T, result *graphql.Result) string {
+	t.Helper()
+	require.Empty(t, result.Errors)
+	body, err := json.Marshal(result.Data)
+	require.NoError(t, err)
+	return string(body)
+}
+
+// errorCode returns the code of the only error of result.
+func errorCode(t *testing.T, result *graphql.Result) string {
+	t.Helper()
+	require.Len(t, result.Errors, 1)
+	return fmt.Sprint(result.Errors[0].Extensions["code"])
+}
+
+func TestServerQueries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should get users by ID and null for missing ones", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 1)
+
+		// Act
+		result := server.Execute(ctx, &Request{Query: `{ found: user(id: 1) { id name email version deletedAt } missing: user(id: 9) { id } }`})
+
+		// Assert
+		assert.JSONEq(t, `{
+			"found": {"id": 1, "name": "User 1", "email": "user1@example.com", "version": 1, "deletedAt": null},
+			"missing": null
+		}`, data(t, result))
+	})
+
+	t.Run("should resolve the user lookups of a request with one query", func(t *testing.T) {
+		// Arrange
+		server, service := newTestServer(t, &config.GraphQLConfig{}, 2)
+
+		// Act
+		result := server.Execute(ctx, &Request{Query: `{ a: user(id: 1) { name } b: user(id: 1) { email } c: user(id: 2) { name } d: user(id: 9) { name } }`})
+
+		// Assert
+		assert.JSONEq(t, `{"a": {"name": "User 1"}, "b": {"email": "user1@example.com"}, "c": {"name": "User 2"}, "d": null}`, data(t, result))
+		assert.Equal(t, int32(1), service.getUsersByIDsCalls.Load())
+		assert.Zero(t, service.getUserCalls.Load())
+	})
+
+	t.Run("should paginate users with cursors", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 3)
+		query := `query($after: String) {
+			users(first: 2, after: $after) {
+				totalCount
+				edges { node { id } }
+				pageInfo { hasNextPage hasPreviousPage endCursor }
+			}
+		}`
+
+		// Act
+		first := server.Execute(ctx, &Request{Query: query})
+		endCursor := first.Data.(map[string]any)["users"].(map[string]any)["pageInfo"].(map[string]any)["endCursor"]
+		second := server.Execute(ctx, &Request{Query: query, Variables: map[string]any{"after": endCursor}})
+
+		// Assert
+		assert.JSONEq(t, fmt.Sprintf(`{"users": {
+			"totalCount": 3,
+			"edges": [{"node": {"id": 1}}, {"node": {"id": 2}}],
+			"pageInfo": {"hasNextPage": true, "hasPreviousPage": false, "endCursor": %q}
+		}}`, endCursor), data(t, first))
+		assert.JSONEq(t, fmt.Sprintf(`{"users": {
+			"totalCount": 3,
+			"edges": [{"node": {"id": 3}}],
+			"pageInfo": {"hasNextPage": false, "hasPreviousPage": true, "endCursor": %q}
+		}}`, encodeCursor(3)), data(t, second))
+	})
+
+	t.Run("should only count users when totalCount is selected", func(t *testing.T) {
+		// Arrange
+		server, service := newTestServer(t, &config.GraphQLConfig{}, 3)
+
+		// Act
+		page := server.Execute(ctx, &Request{Query: `{ users(first: 2) { edges { node { id } } pageInfo { hasNextPage } } }`})
+		pageCalls, pageCounts := service.listUsersCalls.Load(), service.countUsersCalls.Load()
+		counted := server.Execute(ctx, &Request{Query: `{ users(first: 2) { totalCount } }`})
+
+		// Assert
+		assert.JSONEq(t, `{"users": {"edges": [{"node": {"id": 1}}, {"node": {"id": 2}}], "pageInfo": {"hasNextPage": true}}}`, data(t, page))
+		assert.Equal(t, int32(1), pageCalls)
+		assert.Zero(t, pageCounts)
+		assert.JSONEq(t, `{"users": {"totalCount": 3}}`, data(t, counted))
+		assert.Equal(t, int32(1), service.countUsersCalls.Load())
+	})
+
+	t.Run("should filter users by name or email", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 3)
+
+		// Act
+		result := server.Execute(ctx, &Request{Query: `{ users(filter: {search: "USER2@"}) { totalCount edges { node { id } } } }`})
+
+		// Assert
+		assert.JSONEq(t, `{"users": {"totalCount": 1, "edges": [{"node": {"id": 2}}]}}`, data(t, result))
+	})
+
+	t.Run("should only let admins include deleted users", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 1)
+		query := `{ users(filter: {includeDeleted: true}) { totalCount } }`
+
+		// Act
+		forbidden := server.Execute(ctx, &Request{Query: query})
+		allowed := server.Execute(adminContext(t), &Request{Query: query})
+
+		// Assert
+		assert.Equal(t, CodeForbidden, errorCode(t, forbidden))
+		assert.JSONEq(t, `{"users": {"totalCount": 1}}`, data(t, allowed))
+	})
+
+	t.Run("should reject invalid page sizes and cursors", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 1)
+
+		// Act
+		tooMany := server.Execute(ctx, &Request{Query: `{ users(first: 101) { totalCount } }`})
+		badCursor := server.Execute(ctx, &Request{Query: `{ users(after: "bogus") { totalCount } }`})
+
+		// Assert
+		assert.Equal(t, CodeBadUserInput, errorCode(t, tooMany))
+		assert.Equal(t, CodeBadUserInput, errorCode(t, badCursor))
+	})
+}
+
+func TestServerMutations(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should report mutations and run them on the primary", func(t *testing.T) {
+		// Arrange
+		server, service := newTestServer(t, &config.GraphQLConfig{}, 0)
+
+		// Act
+		_, queryIsMutation := server.ExecuteOperation(ctx, &Request{Query: `{ user(id: 1) { id } }`})
+		_, mutationIsMutation := server.ExecuteOperation(ctx, &Request{
+			Query:         `query Get { user(id: 1) { id } } mutation Create { createUser(input: {name: "Alice", email: "alice@example.com"}) { id } }`,
+			OperationName: "Create",
+		})
+
+		// Assert
+		assert.False(t, queryIsMutation)
+		assert.True(t, mutationIsMutation)
+		assert.Equal(t, int32(1), service.pinnedCreates.Load())
+	})
+
+	t.Run("should create, update and delete users", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 0)
+
+		// Act
+		created := server.Execute(ctx, &Request{Query: `mutation { createUser(input: {name: "Alice", email: "alice@example.com"}) { id version } }`})
+		updated := server.Execute(ctx, &Request{Query: `mutation { updateUser(id: 1, input: {name: "Alicia", email: "alice@example.com"}, expectedVersion: 1) { name version } }`})
+		deleted := server.Execute(ctx, &Request{Query: `mutation { deleteUser(id: 1) }`})
+		after := server.Execute(ctx, &Request{Query: `{ user(id: 1) { id } }`})
+
+		// Assert
+		assert.JSONEq(t, `{"createUser": {"id": 1, "version": 1}}`, data(t, created))
+		assert.JSONEq(t, `{"updateUser": {"name": "Alicia", "version": 2}}`, data(t, updated))
+		assert.JSONEq(t, `{"deleteUser": true}`, data(t, deleted))
+		assert.JSONEq(t, `{"user": null}`, data(t, after))
+	})
+
+	t.Run("should report service errors with codes", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{}, 2)
+
+		// Act
+		taken := server.Execute(ctx, &Request{Query: `mutation { createUser(input: {name: "Copy", email: "user1@example.com"}) { id } }`})
+		stale := server.Execute(ctx, &Request{Query: `mutation { updateUser(id: 1, input: {name: "A", email: "a@example.com"}, expectedVersion: 5) { id } }`})
+		missing := server.Execute(ctx, &Request{Query: `mutation { deleteUser(id: 9) }`})
+		purge := server.Execute(ctx, &Request{Query: `mutation { deleteUser(id: 2, permanent: true) }`})
+
+		// Assert
+		assert.Equal(t, CodeConflict, errorCode(t, taken))
+		assert.Equal(t, CodeVersionMismatch, errorCode(t, stale))
+		assert.Equal(t, CodeNotFound, errorCode(t, missing))
+		assert.Equal(t, CodeForbidden, errorCode(t, purge))
+	})
+}
+
+func TestServerLimits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should reject queries nested deeper than the maximum", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{MaxDepth: 3}, 0)
+
+		// Act
+		result := server.Execute(ctx, &Request{Query: `{ users { edges { node { id } } } }`})
+
+		// Assert
+		assert.Equal(t, CodeQueryTooComplex, errorCode(t, result))
+		assert.Nil(t, result.Data)
+	})
+
+	t.Run("should count the fields of paginated lists once per item", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{MaxComplexity: 20}, 0)
+
+		// Act
+		small := server.Execute(ctx, &Request{Query: `{ users(first: 2) { edges { node { id name } } } }`})
+		large := server.Execute(ctx, &Request{
+			Query:     `query($n: Int) { users(first: $n) { edges { node { id name } } } }`,
+			Variables: map[string]any{"n": float64(10)},
+		})
+
+		// Assert
+		assert.Empty(t, small.Errors)
+		assert.Equal(t, CodeQueryTooComplex, errorCode(t, large))
+	})
+
+	t.Run("should allow the introspection query of tools", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{MaxDepth: 2}, 0)
+
+		// Act
+		result := server.Execute(ctx, &Request{Query: testutil.IntrospectionQuery})
+
+		// Assert
+		assert.Empty(t, result.Errors)
+	})
+
+	t.Run("should limit introspection fields", func(t *testing.T) {
+		// Arrange
+		server, _ := newTestServer(t, &config.GraphQLConfig{MaxComplexity: 50}, 0)
+		var aliases strings.Builder
+		for i := range 20 {
+			fmt.Fprintf(&aliases, "s%d: __schema { types { name } } ", i)
+		}
+		ofTypes := "name"
+		for range maxIntrospectionDepth {
+			ofTypes = "ofType { " + ofTypes + " }"
+		}
+
+		// Act
+		aliased := server.Execute(ctx, &Request{Query: "{ " + aliases.String() + "}"})
+		deep := server.Execute(ctx, &Request{Query: `{ __type(name: "User") { fields { type { ` + ofTypes + ` } } } }`})
+
+		// Assert
+		assert.Equal(t, CodeQueryTooComplex, errorCode(t, aliased))
+		assert.Equal(t, CodeQueryTooComplex, errorCode(t, deep))
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"http-server/dto/user"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+var errInvalidIfMatch = errors.New("invalid If-Match header")
+
+// userETag returns the strong entity tag of u, derived from its version.
+func userETag(u *user.User) string {
+	return `"` + strconv.Itoa(u.Version) + `"`
+}
+
+// ifMatchVersion returns the user version required by the If-Match header of
+// r, or 0 when the header is absent or "*". Only a single strong entity tag
+// is supported.
+func ifMatchVersion(r *http.Request) (int, error) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(strings.Trim(value, `"`))
+	if err != nil || version <= 0 || !strings.HasPrefix(value, `"`) || !strings.HasSuffix(value, `"`) {
+		return 0, errInvalidIfMatch
+	}
+	return version, nil
+}
+
+// noneMatch reports whether the If-None-Match header of r matches etag,
+// using the weak comparison required for GET requests.
+func noneMatch(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"http-server/graph"
+	"http-server/middleware"
+	"http-server/utils"
+	"net/http"
+	"time"
+)
+
+// maxGraphQLBodySize bounds the body of GraphQL requests, whose queries are
+// parsed and analysed in memory.
+const maxGraphQLBodySize = 1 << 20
+
+// ============== STRUCTS ==============
+
+type GraphQLHandler struct {
+	server               *graph.Server
+	playground           bool
+	readYourWritesWindow time.Duration
+}
+
+// NewGraphQLHandler creates a handler executing requests with server. When
+// playground is set, GET /graphql serves GraphiQL. Mutations pin the reads
+// of the client to the primary for readYourWritesWindow, like the REST
+// writes; queries are served by replicas.
+func NewGraphQLHandler(server *graph.Server, playground bool, readYourWritesWindow time.Duration) *GraphQLHandler {
+	return &GraphQLHandler{server: server, playground: playground, readYourWritesWindow: readYourWritesWindow}
+}
+
+// ============== METHODS ==============
+
+// QueryHandler godoc
+//
+//	@Summary		Execute a GraphQL request
+//	@Description	Run a GraphQL query or mutation on users. Errors are reported in the errors of the response, with a code extension, and the status stays 200.
+//	@Tags			graphql
+//	@Accept			json
+//	@Produce		json
+//	@Param			request	body		graph.Request	true	"GraphQL request"
+//	@Success		200		{object}	map[string]any	"GraphQL response with data and errors"
+//	@Failure		400		{object}	map[string]string
+//	@Failure		413		{object}	map[string]string
+//	@Router			/graphql [post]
+func (h *GraphQLHandler) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	var req graph.Request
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxGraphQLBodySize)).Decode(&req)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Request body is too large"}, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil || req.Query == "" {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	result, mutation := h.server.ExecuteOperation(r.Context(), &req)
+	if mutation {
+		middleware.PinReads(w, h.readYourWritesWindow)
+	}
+	utils.WriteJSON(w, result)
+}
+
+// PlaygroundHandler godoc
+//
+//	@Summary		GraphiQL playground
+//	@Description	Serve GraphiQL to explore the GraphQL API. Only enabled in development.
+//	@Tags			graphql
+//	@Produce		html
+//	@Success		200	{string}	string	"GraphiQL page"
+//	@Failure		404	{object}	map[string]string
+//	@Router			/graphql [get]
+func (h *GraphQLHandler) PlaygroundHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.playground {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Not found"}, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = w.Write([]byte(graphiQLPage))
+}
+
+// graphiQLPage loads GraphiQL from a CDN and points it at /graphql.
+const graphiQLPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>GraphiQL</title>
+  <style>body { margin: 0; height: 100vh; } #graphiql { height: 100vh; }</style>
+  <link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css">
+</head>
+<body>
+  <div id="graphiql">Loading...</div>
+  <script crossorigin src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+  <script crossorigin src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+  <script>
+    const fetcher = GraphiQL.createFetcher({ url: '/graphql' });
+    ReactDOM.createRoot(document.getElementById('graphiql')).render(React.createElement(GraphiQL, { fetcher }));
+  </script>
+</body>
+</html>
+`
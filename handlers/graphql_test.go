@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/graph"
+	"http-server/middleware"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphQLQueryHandler(t *testing.T) {
+	newHandler := func(t *testing.T) http.Handler {
+		t.Helper()
+		server, err := graph.NewServer(newTestUserService(t, alice), &config.GraphQLConfig{})
+		require.NoError(t, err)
+		handler := NewGraphQLHandler(server, false, time.Minute)
+		return middleware.ReadYourWrites(time.Minute, "/graphql")(http.HandlerFunc(handler.QueryHandler))
+	}
+
+	t.Run("should execute queries", func(t *testing.T) {
+		// Act
+		rec := serve(newHandler(t), http.MethodPost, "/graphql", `{"query": "{ user(id: 1) { email } }"}`)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.JSONEq(t, `{"data": {"user": {"email": "alice@example.com"}}}`, rec.Body.String())
+	})
+
+	t.Run("should pin the reads of the client after mutations only", func(t *testing.T) {
+		// Arrange
+		handler := newHandler(t)
+
+		// Act
+		query := serve(handler, http.MethodPost, "/graphql", `{"query": "{ user(id: 1) { email } }"}`)
+		mutation := serve(handler, http.MethodPost, "/graphql",
+			`{"query": "mutation { createUser(input: {name: \"Bob\", email: \"bob@example.com\"}) { id } }"}`)
+
+		// Assert
+		assert.Empty(t, query.Result().Cookies())
+		assert.Empty(t, query.Header().Get(middleware.ReadYourWritesHeader))
+		assert.JSONEq(t, `{"data": {"createUser": {"id": 2}}}`, mutation.Body.String())
+		cookies := mutation.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, middleware.ReadYourWritesCookie, cookies[0].Name)
+		assert.Equal(t, mutation.Header().Get(middleware.ReadYourWritesHeader), cookies[0].Value)
+	})
+
+	t.Run("should reject invalid and oversized bodies", func(t *testing.T) {
+		// Arrange
+		handler := newHandler(t)
+		padding := strings.Repeat(" ", maxGraphQLBodySize)
+
+		// Act
+		invalid := serve(handler, http.MethodPost, "/graphql", `{"query": ""}`)
+		tooLarge := serve(handler, http.MethodPost, "/graphql", `{"query": "{ user(id: 1) { email } }"`+padding+`}`)
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, invalid.Code)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, tooLarge.Code)
+		assert.JSONEq(t, `{"error": "Request body is too large"}`, tooLarge.Body.String())
+	})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"errors"
+	"http-server/jobs"
+	"http-server/utils"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ============== STRUCTS ==============
+
+type JobHandler struct {
+	queue *jobs.Queue
+}
+
+func NewJobHandler(queue *jobs.Queue) *JobHandler {
+	return &JobHandler{queue: queue}
+}
+
+// ============== METHODS ==============
+
+// GetJobHandler godoc
+//
+//	@Summary		Get a job by ID
+//	@Description	Get the status of a background job, and its result once it succeeded
+//	@Tags			jobs
+//	@Produce		json
+//	@Param			id	path		string	true	"Job ID"
+//	@Success		200	{object}	jobs.Job
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/jobs/{id} [get]
+func (h *JobHandler) GetJobHandler(w http.ResponseWriter, r *http.Request) {
+	job, err := h.queue.Get(r.Context(), chi.URLParam(r, "id"))
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Job not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.LoggerFromContext(r.Context()).Error("Failed to get job", "error", err)
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get job"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, job)
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"http-server/middleware"
+	"http-server/scheduler"
+	"http-server/utils"
+	"net/http"
+)
+
+// ============== STRUCTS ==============
+
+type SchedulerHandler struct {
+	scheduler *scheduler.Scheduler
+}
+
+func NewSchedulerHandler(scheduler *scheduler.Scheduler) *SchedulerHandler {
+	return &SchedulerHandler{scheduler: scheduler}
+}
+
+// ============== METHODS ==============
+
+// GetTasksHandler godoc
+//
+//	@Summary		List scheduled tasks
+//	@Description	Get the schedule, next run and outcome of the last run of every scheduled task (admins only)
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		scheduler.TaskStatus
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/admin/scheduler/tasks [get]
+func (h *SchedulerHandler) GetTasksHandler(w http.ResponseWriter, r *http.Request) {
+	if !middleware.IsAdmin(r.Context()) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Only admins can list scheduled tasks"}, http.StatusForbidden)
+		return
+	}
+
+	tasks, err := h.scheduler.Tasks(r.Context())
+	if err != nil {
+		utils.LoggerFromContext(r.Context()).Error("Failed to get scheduled tasks", "error", err)
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get scheduled tasks"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, tasks)
+}
@@ -2,8 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"http-server/dto/user"
+	"http-server/jobs"
+	"http-server/middleware"
 	"http-server/services"
+	"http-server/storage"
 	"http-server/utils"
 	"net/http"
 	"strconv"
@@ -15,10 +19,17 @@ import (
 
 type UserHandler struct {
 	service services.UserService
+	jobs    *jobs.Queue
 }
 
-func NewUserHandler(service services.UserService) *UserHandler {
-	return &UserHandler{service: service}
+// NewUserHandler creates a UserHandler and registers its jobs with queue.
+// A nil queue disables asynchronous imports.
+func NewUserHandler(service services.UserService, queue *jobs.Queue) *UserHandler {
+	h := &UserHandler{service: service, jobs: queue}
+	if queue != nil {
+		jobs.Register(queue, ImportUsersJob, h.runImportJob)
+	}
+	return h
 }
 
 // ============== METHODS ==============
@@ -26,15 +37,22 @@ func NewUserHandler(service services.UserService) *UserHandler {
 // GetUsersHandler godoc
 //
 //	@Summary		Get all users
-//	@Description	Get a list of all users
+//	@Description	Get a list of all users. Admins can include soft-deleted users.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Success		200	{array}		user.User
-//	@Failure		500	{object}	map[string]string
+//	@Param			include_deleted	query		bool	false	"Include soft-deleted users (admins only)"
+//	@Success		200				{array}		user.User
+//	@Failure		403				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
 //	@Router			/users [get]
 func (h *UserHandler) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
-	users, err := h.service.GetUsers()
+	filter, ok := userFilter(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := h.service.GetUsers(r.Context(), filter)
 	if err != nil {
 		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get users"}, http.StatusInternalServerError)
 		return
@@ -50,11 +68,16 @@ func (h *UserHandler) GetUsersHandler(w http.ResponseWriter, r *http.Request) {
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path		int	true	"User ID"
-//	@Success		200	{object}	user.User
-//	@Failure		400	{object}	map[string]string
-//	@Failure		404	{object}	map[string]string
-//	@Failure		500	{object}	map[string]string
+//	@Param			id				path		int		true	"User ID"
+//	@Param			include_deleted	query		bool	false	"Include soft-deleted users (admins only)"
+//	@Param			If-None-Match	header		string	false	"ETag of a cached copy"
+//	@Success		200				{object}	user.User
+//	@Success		304				"Not Modified"
+//	@Header			200				{string}	ETag	"Version of the user"
+//	@Failure		400				{object}	map[string]string
+//	@Failure		403				{object}	map[string]string
+//	@Failure		404				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
 //	@Router			/users/{id} [get]
 func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
@@ -62,13 +85,27 @@ func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid user ID"}, http.StatusBadRequest)
 		return
 	}
+	filter, ok := userFilter(w, r)
+	if !ok {
+		return
+	}
 
-	user, err := h.service.GetUser(id)
-	if err != nil {
+	user, err := h.service.GetUser(r.Context(), id, filter)
+	if errors.Is(err, storage.ErrUserNotFound) {
 		utils.WriteJSONStatus(w, map[string]string{"error": "User not found"}, http.StatusNotFound)
 		return
 	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get user"}, http.StatusInternalServerError)
+		return
+	}
 
+	etag := userETag(user)
+	w.Header().Set("ETag", etag)
+	if noneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
 	utils.WriteJSON(w, user)
 }
 
@@ -79,10 +116,14 @@ func (h *UserHandler) GetUserHandler(w http.ResponseWriter, r *http.Request) {
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			user	body		user.CreateUserRequest	true	"User object to be created"
-//	@Success		201		{object}	user.User
-//	@Failure		400		{object}	map[string]string
-//	@Failure		500		{object}	map[string]string
+//	@Param			user			body		user.CreateUserRequest	true	"User object to be created"
+//	@Param			Idempotency-Key	header		string					false	"Key making retries of this request safe"
+//	@Success		201				{object}	user.User
+//	@Failure		400				{object}	map[string]string
+//	@Failure		409				{object}	map[string]string
+//	@Failure		413				{object}	map[string]string
+//	@Failure		422				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
 //	@Router			/users [post]
 func (h *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request) {
 	var req user.CreateUserRequest
@@ -91,27 +132,96 @@ func (h *UserHandler) CreateUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	createdUser, err := h.service.CreateUser(&req)
+	createdUser, err := h.service.CreateUser(r.Context(), &req)
+	if errors.Is(err, storage.ErrEmailTaken) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Email already taken"}, http.StatusConflict)
+		return
+	}
 	if err != nil {
 		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to create user"}, http.StatusInternalServerError)
 		return
 	}
 
-	utils.Logger.Info("User created", "id", createdUser.ID)
+	utils.LoggerFromContext(r.Context()).Info("User created", "id", createdUser.ID)
+	w.Header().Set("ETag", userETag(createdUser))
 	utils.WriteJSONStatus(w, createdUser, http.StatusCreated)
 }
 
+// UpdateUserHandler godoc
+//
+//	@Summary		Update a user
+//	@Description	Replace the name and email of a user. Send the user's ETag in If-Match to avoid overwriting concurrent changes.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id			path		int						true	"User ID"
+//	@Param			If-Match	header		string					false	"ETag the user must still have"
+//	@Param			user		body		user.UpdateUserRequest	true	"New user details"
+//	@Success		200			{object}	user.User
+//	@Header			200			{string}	ETag	"Version of the user"
+//	@Failure		400			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		409			{object}	map[string]string
+//	@Failure		412			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
+//	@Router			/users/{id} [put]
+func (h *UserHandler) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid user ID"}, http.StatusBadRequest)
+		return
+	}
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid If-Match header"}, http.StatusBadRequest)
+		return
+	}
+
+	var req user.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	updatedUser, err := h.service.UpdateUser(r.Context(), id, &req, version)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "User not found"}, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "User has been modified"}, http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, storage.ErrEmailTaken) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Email already taken"}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to update user"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("User updated", "id", id)
+	w.Header().Set("ETag", userETag(updatedUser))
+	utils.WriteJSON(w, updatedUser)
+}
+
 // DeleteUserHandler godoc
 //
 //	@Summary		Delete a user by ID
-//	@Description	Delete a single user by their ID
+//	@Description	Soft-delete a single user by their ID, so it can be restored. Admins can delete it permanently.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			id	path	int	true	"User ID"
-//	@Success		204	"No Content"
-//	@Failure		400	{object}	map[string]string
-//	@Failure		500	{object}	map[string]string
+//	@Param			id			path	int		true	"User ID"
+//	@Param			permanent	query	bool	false	"Delete permanently (admins only)"
+//	@Param			If-Match	header	string	false	"ETag the user must still have"
+//	@Success		204			"No Content"
+//	@Failure		400			{object}	map[string]string
+//	@Failure		403			{object}	map[string]string
+//	@Failure		404			{object}	map[string]string
+//	@Failure		412			{object}	map[string]string
+//	@Failure		500			{object}	map[string]string
 //	@Router			/users/{id} [delete]
 func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 	id, err := strconv.Atoi(chi.URLParam(r, "id"))
@@ -120,11 +230,93 @@ func (h *UserHandler) DeleteUserHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if err := h.service.DeleteUser(id); err != nil {
+	version, err := ifMatchVersion(r)
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid If-Match header"}, http.StatusBadRequest)
+		return
+	}
+
+	if r.URL.Query().Get("permanent") == "true" {
+		if !middleware.IsAdmin(r.Context()) {
+			utils.WriteJSONStatus(w, map[string]string{"error": "Only admins can delete users permanently"}, http.StatusForbidden)
+			return
+		}
+		err = h.service.PurgeUser(r.Context(), id, version)
+	} else {
+		err = h.service.DeleteUser(r.Context(), id, version)
+	}
+	if errors.Is(err, storage.ErrUserNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "User not found"}, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionMismatch) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "User has been modified"}, http.StatusPreconditionFailed)
+		return
+	}
+	if err != nil {
 		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to delete user"}, http.StatusInternalServerError)
 		return
 	}
 
-	utils.Logger.Info("User deleted", "id", id)
+	utils.LoggerFromContext(r.Context()).Info("User deleted", "id", id)
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// RestoreUserHandler godoc
+//
+//	@Summary		Restore a deleted user
+//	@Description	Undo the soft deletion of a user
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			id	path		int	true	"User ID"
+//	@Success		200	{object}	user.User
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		409	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/users/{id}/restore [post]
+func (h *UserHandler) RestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid user ID"}, http.StatusBadRequest)
+		return
+	}
+	if !middleware.IsAdmin(r.Context()) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Only admins can restore users"}, http.StatusForbidden)
+		return
+	}
+
+	restoredUser, err := h.service.RestoreUser(r.Context(), id)
+	if errors.Is(err, storage.ErrUserNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "User not found"}, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrEmailTaken) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Email already taken by another user"}, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to restore user"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("User restored", "id", id)
+	w.Header().Set("ETag", userETag(restoredUser))
+	utils.WriteJSON(w, restoredUser)
+}
+
+// userFilter reads the include_deleted query parameter, which only admins
+// may set. It writes a 403 response and returns false otherwise.
+func userFilter(w http.ResponseWriter, r *http.Request) (storage.UserFilter, bool) {
+	var filter storage.UserFilter
+	if r.URL.Query().Get("include_deleted") == "true" {
+		if !middleware.IsAdmin(r.Context()) {
+			utils.WriteJSONStatus(w, map[string]string{"error": "Only admins can include deleted users"}, http.StatusForbidden)
+			return filter, false
+		}
+		filter.IncludeDeleted = true
+	}
+	return filter, true
+}
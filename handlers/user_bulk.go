@@ -0,0 +1,446 @@
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"http-server/dto/user"
+	"http-server/jobs"
+	"http-server/utils"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Content types accepted by ImportUsersHandler and produced by
+// ExportUsersHandler.
+const (
+	ContentTypeCSV    = "text/csv"
+	ContentTypeNDJSON = "application/x-ndjson"
+)
+
+// ImportUsersJob is the name of the job running asynchronous imports.
+const ImportUsersJob = "users.import"
+
+const (
+	// importBatchSize is the number of valid rows inserted at a time.
+	importBatchSize = 500
+	// maxAsyncImportSize bounds the body of asynchronous imports, which is
+	// stored in the job queue.
+	maxAsyncImportSize = 32 << 20
+	// maxImportLineSize bounds the length of a single NDJSON line.
+	maxImportLineSize = 1 << 20
+	// maxUserFieldLength is the length of the name and email columns.
+	maxUserFieldLength = 255
+)
+
+var userCSVHeader = []string{"id", "name", "email", "version", "deleted_at"}
+
+// ============== METHODS ==============
+
+// ImportUsersHandler godoc
+//
+//	@Summary		Import users
+//	@Description	Create users in bulk from CSV, with a header naming the name and email columns, or from NDJSON, one user object per line. Rows are validated one by one and inserted in batches, each committed on its own, and the response reports the outcome of every row. With async=true the import runs as a background job, whose result is the report.
+//	@Tags			users
+//	@Accept			text/csv
+//	@Accept			application/x-ndjson
+//	@Produce		json
+//	@Param			users	body		string	true	"Users as CSV or NDJSON"
+//	@Param			async	query		bool	false	"Run the import as a background job"
+//	@Success		200		{object}	user.ImportReport
+//	@Success		202		{object}	jobs.Job
+//	@Header			202		{string}	Location	"URL of the job"
+//	@Failure		400		{object}	map[string]string
+//	@Failure		413		{object}	map[string]string
+//	@Failure		415		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/users/import [post]
+func (h *UserHandler) ImportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	contentType := r.Header.Get("Content-Type")
+	if r.URL.Query().Get("async") == "true" {
+		h.enqueueImport(w, r, contentType)
+		return
+	}
+
+	rows, err := newImportRowReader(contentType, r.Body)
+	if errors.Is(err, errUnsupportedImportType) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Content-Type must be " + ContentTypeCSV + " or " + ContentTypeNDJSON}, http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "CSV header must have name and email columns"}, http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.importUsers(r.Context(), rows)
+	var inputErr *importInputError
+	if errors.As(err, &inputErr) {
+		utils.LoggerFromContext(r.Context()).Error("Failed to read import", "error", inputErr.err, "row", inputErr.row)
+		utils.WriteJSONStatus(w, map[string]string{"error": fmt.Sprintf("Invalid request body at row %d", inputErr.row)}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to import users"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("Users imported", "created", report.Created, "failed", report.Failed)
+	utils.WriteJSON(w, report)
+}
+
+// enqueueImport stores the body of an import request in an ImportUsersJob
+// and answers with the job.
+func (h *UserHandler) enqueueImport(w http.ResponseWriter, r *http.Request, contentType string) {
+	if h.jobs == nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Asynchronous imports are not available"}, http.StatusNotImplemented)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType != ContentTypeCSV && mediaType != ContentTypeNDJSON {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Content-Type must be " + ContentTypeCSV + " or " + ContentTypeNDJSON}, http.StatusUnsupportedMediaType)
+		return
+	}
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAsyncImportSize))
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		utils.WriteJSONStatus(w, map[string]string{"error": fmt.Sprintf("Asynchronous imports are limited to %d bytes", maxAsyncImportSize)}, http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.jobs.Enqueue(r.Context(), ImportUsersJob, importUsersPayload{ContentType: contentType, Data: string(data)})
+	if err != nil {
+		utils.LoggerFromContext(r.Context()).Error("Failed to enqueue import", "error", err)
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to import users"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("User import enqueued", "job_id", job.ID)
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	utils.WriteJSONStatus(w, job, http.StatusAccepted)
+}
+
+// importUsersPayload is the payload of an ImportUsersJob.
+type importUsersPayload struct {
+	ContentType string `json:"content_type"`
+	Data        string `json:"data"`
+}
+
+// runImportJob imports the users of an ImportUsersJob. Input that cannot
+// be read fails the job without retries.
+func (h *UserHandler) runImportJob(ctx context.Context, payload importUsersPayload) (any, error) {
+	rows, err := newImportRowReader(payload.ContentType, strings.NewReader(payload.Data))
+	if err != nil {
+		return nil, jobs.Permanent(err)
+	}
+	report, err := h.importUsers(ctx, rows)
+	var inputErr *importInputError
+	if errors.As(err, &inputErr) {
+		return nil, jobs.Permanent(err)
+	}
+	if err != nil {
+		return nil, err
+	}
+	utils.LoggerFromContext(ctx).Info("Users imported", "created", report.Created, "failed", report.Failed)
+	return report, nil
+}
+
+// importUsers validates the rows read from rows and creates the valid ones
+// in batches of importBatchSize. Batches are committed as they fill up, so
+// an error leaves the earlier ones in place.
+func (h *UserHandler) importUsers(ctx context.Context, rows importRowReader) (*user.ImportReport, error) {
+	report := &user.ImportReport{Rows: []user.ImportRowResult{}}
+	batch := make([]user.CreateUserRequest, 0, importBatchSize)
+	// pending holds the index in report.Rows of every row in batch.
+	pending := make([]int, 0, importBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		created, err := h.service.ImportUsers(ctx, batch)
+		if err != nil {
+			return err
+		}
+		for i, u := range created {
+			result := &report.Rows[pending[i]]
+			if u == nil {
+				result.Status, result.Error = user.ImportRowFailed, "Email already taken"
+				report.Failed++
+				continue
+			}
+			result.Status, result.ID = user.ImportRowCreated, u.ID
+			report.Created++
+		}
+		batch, pending = batch[:0], pending[:0]
+		return nil
+	}
+
+	for row := 1; ; row++ {
+		req, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr rowError
+		if err != nil && !errors.As(err, &rowErr) {
+			return nil, &importInputError{row: row, err: err}
+		}
+		if err == nil {
+			err = validateImportRow(&req)
+		}
+		if err != nil {
+			report.Rows = append(report.Rows, user.ImportRowResult{Row: row, Status: user.ImportRowFailed, Error: err.Error()})
+			report.Failed++
+			continue
+		}
+
+		report.Rows = append(report.Rows, user.ImportRowResult{Row: row})
+		batch = append(batch, req)
+		pending = append(pending, len(report.Rows)-1)
+		if len(batch) == importBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// ExportUsersHandler godoc
+//
+//	@Summary		Export users
+//	@Description	Stream all users as CSV or NDJSON, ordered by ID. Admins can include soft-deleted users.
+//	@Tags			users
+//	@Produce		text/csv
+//	@Produce		application/x-ndjson
+//	@Param			format			query		string	false	"Export format"	Enums(csv, ndjson)	default(csv)
+//	@Param			include_deleted	query		bool	false	"Include soft-deleted users (admins only)"
+//	@Success		200				{string}	string	"One user per row or line"
+//	@Failure		400				{object}	map[string]string
+//	@Failure		403				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Router			/users/export [get]
+func (h *UserHandler) ExportUsersHandler(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "ndjson" {
+		utils.WriteJSONStatus(w, map[string]string{"error": "format must be csv or ndjson"}, http.StatusBadRequest)
+		return
+	}
+	filter, ok := userFilter(w, r)
+	if !ok {
+		return
+	}
+
+	// Nothing is written before the first user arrives, so a failing query
+	// can still be answered with an error status.
+	csvWriter := csv.NewWriter(w)
+	jsonEncoder := json.NewEncoder(w)
+	started := false
+	start := func() error {
+		started = true
+		if format == "csv" {
+			w.Header().Set("Content-Type", ContentTypeCSV+"; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", ContentTypeNDJSON)
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="users.`+format+`"`)
+		if format == "csv" {
+			return csvWriter.Write(userCSVHeader)
+		}
+		return nil
+	}
+
+	err := h.service.ExportUsers(r.Context(), filter, func(u *user.User) error {
+		if !started {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if format == "csv" {
+			return csvWriter.Write(userCSVRecord(u))
+		}
+		return jsonEncoder.Encode(u)
+	})
+	if err == nil && !started {
+		err = start()
+	}
+	if err == nil {
+		csvWriter.Flush()
+		err = csvWriter.Error()
+	}
+	if err != nil {
+		utils.LoggerFromContext(r.Context()).Error("Failed to export users", "error", err)
+		if !started {
+			utils.WriteJSONStatus(w, map[string]string{"error": "Failed to export users"}, http.StatusInternalServerError)
+			return
+		}
+		// The export has started with a 200 status. Aborting the connection
+		// keeps clients from mistaking it for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// userCSVRecord formats u as a row under userCSVHeader.
+func userCSVRecord(u *user.User) []string {
+	deletedAt := ""
+	if u.DeletedAt != nil {
+		deletedAt = u.DeletedAt.UTC().Format(time.RFC3339)
+	}
+	return []string{strconv.Itoa(u.ID), u.Name, u.Email, strconv.Itoa(u.Version), deletedAt}
+}
+
+// validateImportRow trims the fields of req and checks that they can be
+// stored.
+func validateImportRow(req *user.CreateUserRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	switch {
+	case req.Name == "":
+		return rowError("Name is required")
+	case utf8.RuneCountInString(req.Name) > maxUserFieldLength:
+		return rowError("Name is too long")
+	case req.Email == "":
+		return rowError("Email is required")
+	case utf8.RuneCountInString(req.Email) > maxUserFieldLength:
+		return rowError("Email is too long")
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		return rowError("Invalid email")
+	}
+	return nil
+}
+
+// rowError is an error affecting a single import row, which is reported
+// without aborting the import.
+type rowError string
+
+func (e rowError) Error() string { return string(e) }
+
+// importInputError is returned by importUsers when the input cannot be
+// read any further.
+type importInputError struct {
+	row int
+	err error
+}
+
+func (e *importInputError) Error() string {
+	return fmt.Sprintf("row %d: %v", e.row, e.err)
+}
+
+func (e *importInputError) Unwrap() error { return e.err }
+
+var errUnsupportedImportType = errors.New("unsupported import content type")
+
+// newImportRowReader returns the reader of the rows of r, which has the
+// given content type.
+func newImportRowReader(contentType string, r io.Reader) (importRowReader, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case ContentTypeCSV:
+		return newCSVRowReader(r)
+	case ContentTypeNDJSON:
+		return newNDJSONRowReader(r), nil
+	default:
+		return nil, errUnsupportedImportType
+	}
+}
+
+// importRowReader reads the users of an import one row at a time.
+type importRowReader interface {
+	// next returns the next row, or io.EOF after the last one. Errors of
+	// type rowError only affect the row they are returned for.
+	next() (user.CreateUserRequest, error)
+}
+
+// csvRowReader reads CSV rows, locating the name and email columns by the
+// header so that other columns, such as those of an export, are ignored.
+type csvRowReader struct {
+	r           *csv.Reader
+	name, email int
+}
+
+func newCSVRowReader(r io.Reader) (*csvRowReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, err
+	}
+	c := &csvRowReader{r: cr, name: -1, email: -1}
+	for i, column := range header {
+		// Spreadsheets often start CSV files with a byte order mark.
+		switch strings.ToLower(strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))) {
+		case "name":
+			c.name = i
+		case "email":
+			c.email = i
+		}
+	}
+	if c.name < 0 || c.email < 0 {
+		return nil, errors.New("missing name or email column")
+	}
+	return c, nil
+}
+
+func (c *csvRowReader) next() (user.CreateUserRequest, error) {
+	record, err := c.r.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return user.CreateUserRequest{}, rowError("Invalid CSV: " + parseErr.Err.Error())
+	}
+	if err != nil {
+		return user.CreateUserRequest{}, err
+	}
+	if len(record) <= max(c.name, c.email) {
+		return user.CreateUserRequest{}, rowError("Missing columns")
+	}
+	return user.CreateUserRequest{Name: record[c.name], Email: record[c.email]}, nil
+}
+
+// ndjsonRowReader reads one JSON user object per line, skipping blank
+// lines.
+type ndjsonRowReader struct {
+	s *bufio.Scanner
+}
+
+func newNDJSONRowReader(r io.Reader) *ndjsonRowReader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxImportLineSize)
+	return &ndjsonRowReader{s: s}
+}
+
+func (n *ndjsonRowReader) next() (user.CreateUserRequest, error) {
+	for n.s.Scan() {
+		line := n.s.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var req user.CreateUserRequest
+		if err := json.Unmarshal(line, &req); err != nil {
+			return user.CreateUserRequest{}, rowError("Invalid JSON")
+		}
+		return req, nil
+	}
+	if err := n.s.Err(); err != nil {
+		return user.CreateUserRequest{}, err
+	}
+	return user.CreateUserRequest{}, io.EOF
+}
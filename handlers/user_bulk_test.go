@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	user "http-server/dto/user"
+	"http-server/services"
+	"http-server/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readRows reads every row of rows, recording row errors as results.
+func readRows(t *testing.T, rows importRowReader) []string {
+	t.Helper()
+	var got []string
+	for {
+		req, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			return got
+		}
+		var rowErr rowError
+		if errors.As(err, &rowErr) {
+			got = append(got, "error: "+rowErr.Error())
+			continue
+		}
+		require.NoError(t, err)
+		got = append(got, req.Name+" <"+req.Email+">")
+	}
+}
+
+func TestImportRowReaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		input       string
+		want        []string
+		wantErr     error
+	}{
+		{
+			name:        "CSV with reordered and extra columns",
+			contentType: "text/csv; charset=utf-8",
+			input:       "\ufeffid,Email , NAME\n1,alice@example.com,Alice\n2,bob@example.com,Bob\n",
+			want:        []string{"Alice <alice@example.com>", "Bob <bob@example.com>"},
+		},
+		{
+			name:        "CSV with short and malformed rows",
+			contentType: ContentTypeCSV,
+			input:       "name,email\nAlice\n\"Bo\"b,bob@example.com\nCarol,carol@example.com\n",
+			want:        []string{"error: Missing columns", `error: Invalid CSV: extraneous or missing " in quoted-field`, "Carol <carol@example.com>"},
+		},
+		{
+			name:        "CSV without an email column",
+			contentType: ContentTypeCSV,
+			input:       "name,mail\nAlice,alice@example.com\n",
+			wantErr:     errors.New("missing name or email column"),
+		},
+		{
+			name:        "NDJSON with blank lines and invalid JSON",
+			contentType: ContentTypeNDJSON,
+			input:       "{\"name\": \"Alice\", \"email\": \"alice@example.com\"}\n\n  \n{\"name\": \nnull\n",
+			want:        []string{"Alice <alice@example.com>", "error: Invalid JSON", " <>"},
+		},
+		{
+			name:        "unsupported content type",
+			contentType: "application/json",
+			input:       "[]",
+			wantErr:     errUnsupportedImportType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			rows, err := newImportRowReader(tt.contentType, strings.NewReader(tt.input))
+
+			// Assert
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, readRows(t, rows))
+		})
+	}
+
+	t.Run("should fail on NDJSON lines over the limit", func(t *testing.T) {
+		// Arrange
+		rows := newNDJSONRowReader(strings.NewReader(strings.Repeat("x", maxImportLineSize+1)))
+
+		// Act
+		_, err := rows.next()
+
+		// Assert
+		assert.Error(t, err)
+		assert.NotErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestValidateImportRow(t *testing.T) {
+	long := strings.Repeat("a", maxUserFieldLength+1)
+	tests := []struct {
+		name    string
+		req     user.CreateUserRequest
+		want    user.CreateUserRequest
+		wantErr string
+	}{
+		{name: "valid row is trimmed", req: user.CreateUserRequest{Name: " Alice ", Email: "\talice@example.com "}, want: user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"}},
+		{name: "missing name", req: user.CreateUserRequest{Name: "  ", Email: "alice@example.com"}, wantErr: "Name is required"},
+		{name: "long name", req: user.CreateUserRequest{Name: long, Email: "alice@example.com"}, wantErr: "Name is too long"},
+		{name: "missing email", req: user.CreateUserRequest{Name: "Alice"}, wantErr: "Email is required"},
+		{name: "long email", req: user.CreateUserRequest{Name: "Alice", Email: long + "@example.com"}, wantErr: "Email is too long"},
+		{name: "invalid email", req: user.CreateUserRequest{Name: "Alice", Email: "alice"}, wantErr: "Invalid email"},
+		{name: "email with a display name", req: user.CreateUserRequest{Name: "Alice", Email: "Alice <alice@example.com>"}, wantErr: "Invalid email"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			err := validateImportRow(&tt.req)
+
+			// Assert
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, tt.req)
+		})
+	}
+}
+
+// batchCountingService counts the ImportUsers batches of a UserService.
+type batchCountingService struct {
+	services.UserService
+	batches atomic.Int32
+}
+
+func (s *batchCountingService) ImportUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error) {
+	s.batches.Add(1)
+	return s.UserService.ImportUsers(ctx, reqs)
+}
+
+// failingExportService exports the given number of users, then fails.
+type failingExportService struct {
+	services.UserService
+	before int
+}
+
+func (s *failingExportService) ExportUsers(ctx context.Context, filter storage.UserFilter, fn func(u *user.User) error) error {
+	for i := 1; i <= s.before; i++ {
+		if err := fn(&user.User{ID: i, Name: "User", Email: fmt.Sprintf("user%d@example.com", i), Version: 1}); err != nil {
+			return err
+		}
+	}
+	return errors.New("connection lost")
+}
+
+func TestImportUsersHandler(t *testing.T) {
+	t.Run("should report every row across batches", func(t *testing.T) {
+		// Arrange
+		service := &batchCountingService{UserService: newTestUserService(t, alice)}
+		router := newUserRouter(service)
+		var body strings.Builder
+		body.WriteString("name,email\n")
+		rows := 2*importBatchSize + 50
+		for i := 1; i <= rows; i++ {
+			switch {
+			case i == 3:
+				body.WriteString("Alice,alice@example.com\n")
+			case i%100 == 0:
+				body.WriteString("Invalid,not-an-email\n")
+			default:
+				fmt.Fprintf(&body, "User %d,user%d@example.com\n", i, i)
+			}
+		}
+
+		// Act
+		rec := serve(router, http.MethodPost, "/users/import", body.String(), "Content-Type", ContentTypeCSV)
+
+		// Assert
+		require.Equal(t, http.StatusOK, rec.Code)
+		var report user.ImportReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		require.Len(t, report.Rows, rows)
+		invalid := rows / 100
+		assert.Equal(t, 1+invalid, report.Failed)
+		assert.Equal(t, rows-1-invalid, report.Created)
+		assert.Equal(t, int32(3), service.batches.Load())
+		nextID := 2
+		for i, result := range report.Rows {
+			row := i + 1
+			assert.Equal(t, row, result.Row)
+			switch {
+			case row == 3:
+				assert.Equal(t, user.ImportRowResult{Row: 3, Status: user.ImportRowFailed, Error: "Email already taken"}, result)
+			case row%100 == 0:
+				assert.Equal(t, user.ImportRowResult{Row: row, Status: user.ImportRowFailed, Error: "Invalid email"}, result)
+			default:
+				require.Equal(t, user.ImportRowResult{Row: row, Status: user.ImportRowCreated, ID: nextID}, result)
+				got, err := service.GetUser(context.Background(), nextID, storage.UserFilter{})
+				require.NoError(t, err)
+				assert.Equal(t, fmt.Sprintf("user%d@example.com", row), got.Email)
+				nextID++
+			}
+		}
+	})
+
+	t.Run("should reject unsupported types and headers", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t)
+
+		// Act
+		unsupported := serve(router, http.MethodPost, "/users/import", "[]", "Content-Type", "application/json")
+		badHeader := serve(router, http.MethodPost, "/users/import", "id\n1\n", "Content-Type", ContentTypeCSV)
+		async := serve(router, http.MethodPost, "/users/import?async=true", "name,email\n", "Content-Type", ContentTypeCSV)
+
+		// Assert
+		assert.Equal(t, http.StatusUnsupportedMediaType, unsupported.Code)
+		assert.Equal(t, http.StatusBadRequest, badHeader.Code)
+		assert.Equal(t, http.StatusNotImplemented, async.Code)
+	})
+}
+
+func TestExportUsersHandler(t *testing.T) {
+	t.Run("should export users that import back unchanged", func(t *testing.T) {
+		for _, format := range []string{"csv", "ndjson"} {
+			t.Run(format, func(t *testing.T) {
+				// Arrange
+				source, _ := newTestUserRouter(t)
+				imported := serve(source, http.MethodPost, "/users/import",
+					"name,email\nAlice,alice@example.com\n\"Smith, Bob\",bob@example.com\n", "Content-Type", ContentTypeCSV)
+				require.Equal(t, http.StatusOK, imported.Code)
+				target, targetService := newTestUserRouter(t)
+
+				// Act
+				exported := serve(source, http.MethodGet, "/users/export?format="+format, "")
+				contentType := ContentTypeCSV
+				if format == "ndjson" {
+					contentType = ContentTypeNDJSON
+				}
+				reimported := serve(target, http.MethodPost, "/users/import", exported.Body.String(), "Content-Type", contentType)
+
+				// Assert
+				require.Equal(t, http.StatusOK, exported.Code)
+				assert.Contains(t, exported.Header().Get("Content-Type"), contentType)
+				assert.Equal(t, `attachment; filename="users.`+format+`"`, exported.Header().Get("Content-Disposition"))
+				require.Equal(t, http.StatusOK, reimported.Code)
+				assert.JSONEq(t, `{"created": 2, "failed": 0, "rows": [
+					{"row": 1, "status": "created", "id": 1},
+					{"row": 2, "status": "created", "id": 2}
+				]}`, reimported.Body.String())
+				users, err := targetService.GetUsers(context.Background(), storage.UserFilter{})
+				require.NoError(t, err)
+				require.Len(t, users, 2)
+				assert.Equal(t, "Smith, Bob", users[1].Name)
+			})
+		}
+	})
+
+	t.Run("should write the CSV header for an empty export", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t)
+
+		// Act
+		rec := serve(router, http.MethodGet, "/users/export", "")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "id,name,email,version,deleted_at\n", rec.Body.String())
+	})
+
+	t.Run("should answer 500 when the export fails before any user", func(t *testing.T) {
+		// Arrange
+		router := newUserRouter(&failingExportService{UserService: newTestUserService(t)})
+
+		// Act
+		rec := serve(router, http.MethodGet, "/users/export", "")
+
+		// Assert
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		assert.JSONEq(t, `{"error": "Failed to export users"}`, rec.Body.String())
+	})
+
+	t.Run("should abort the response when the export fails midway", func(t *testing.T) {
+		// Arrange
+		router := newUserRouter(&failingExportService{UserService: newTestUserService(t), before: 2})
+
+		// Act
+		act := func() { serve(router, http.MethodGet, "/users/export?format=ndjson", "") }
+
+		// Assert
+		assert.PanicsWithValue(t, http.ErrAbortHandler, act)
+	})
+
+	t.Run("should reject unknown formats", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t)
+
+		// Act
+		rec := serve(router, http.MethodGet, "/users/export?format=xml", "")
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/events"
+	"http-server/utils"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ContentTypeEventStream is the media type of Server-Sent Events.
+const ContentTypeEventStream = "text/event-stream"
+
+const (
+	defaultHeartbeat      = 15 * time.Second
+	defaultMaxConnections = 1000
+)
+
+// ============== STRUCTS ==============
+
+type UserEventsHandler struct {
+	broker    *events.Broker
+	heartbeat time.Duration
+	// slots holds a token per stream, bounding their number.
+	slots chan struct{}
+
+	// shutdown is closed to end the open streams, which would otherwise
+	// keep the server from shutting down.
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewUserEventsHandler creates a handler streaming the events of broker,
+// sending a heartbeat comment after cfg.Heartbeat without events and
+// serving at most cfg.MaxConnections streams. Zero values are replaced by
+// their defaults.
+func NewUserEventsHandler(broker *events.Broker, cfg *config.EventsConfig) *UserEventsHandler {
+	heartbeat := cfg.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = defaultHeartbeat
+	}
+	maxConnections := cfg.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = defaultMaxConnections
+	}
+	return &UserEventsHandler{
+		broker:    broker,
+		heartbeat: heartbeat,
+		slots:     make(chan struct{}, maxConnections),
+		shutdown:  make(chan struct{}),
+	}
+}
+
+// ============== METHODS ==============
+
+// Shutdown ends the open streams. Clients reconnect to another instance
+// and resume with Last-Event-ID. It is meant for http.Server.RegisterOnShutdown.
+func (h *UserEventsHandler) Shutdown() {
+	h.shutdownOnce.Do(func() { close(h.shutdown) })
+}
+
+// StreamUserEventsHandler godoc
+//
+//	@Summary		Stream user events
+//	@Description	Stream user.created, user.updated and user.deleted events as Server-Sent Events. Each message has the event ID as id, the event type as event and the JSON of the event as data. Reconnecting clients send Last-Event-ID to receive the recent events they missed. Comments are sent as heartbeats while no event occurs.
+//	@Tags			users
+//	@Produce		text/event-stream
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{string}	string	"Event stream"
+//	@Failure		500				{object}	map[string]string
+//	@Failure		503				{object}	map[string]string
+//	@Router			/users/events [get]
+func (h *UserEventsHandler) StreamUserEventsHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case h.slots <- struct{}{}:
+		defer func() { <-h.slots }()
+	default:
+		utils.WriteJSONStatus(w, map[string]string{"error": "Too many connections"}, http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := r.Context()
+	sub, err := h.broker.Subscribe(ctx, r.Header.Get("Last-Event-ID"))
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error("Failed to subscribe to user events", "error", err)
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to subscribe to user events"}, http.StatusInternalServerError)
+		return
+	}
+	defer sub.Close()
+
+	w.Header().Set("Content-Type", ContentTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Keep nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		utils.LoggerFromContext(ctx).Error("Failed to flush user events", "error", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(h.heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+			heartbeat.Reset(h.heartbeat)
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-h.shutdown:
+			return
+		case <-ctx.Done():
+			return
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes e as a Server-Sent Events message.
+func writeEvent(w http.ResponseWriter, e event.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
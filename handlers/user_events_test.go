@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/events"
+	"http-server/storage/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestUserEventsServer returns a server streaming the events of a new
+// broker.
+func newTestUserEventsServer(t *testing.T, cfg config.EventsConfig) (*httptest.Server, *UserEventsHandler, *events.Broker) {
+	t.Helper()
+	broker := events.NewBroker(storagetest.NewRedisClient(t), &cfg)
+	t.Cleanup(func() { _ = broker.Close() })
+	h := NewUserEventsHandler(broker, &cfg)
+	server := httptest.NewServer(http.HandlerFunc(h.StreamUserEventsHandler))
+	t.Cleanup(server.Close)
+	// End the streams first, or closing the server waits for them
+	t.Cleanup(h.Shutdown)
+	return server, h, broker
+}
+
+// openStream opens an event stream, resuming after lastEventID when set.
+func openStream(t *testing.T, url, lastEventID string) (*http.Response, *bufio.Reader) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readMessage returns the lines of the next message of a stream.
+func readMessage(t *testing.T, r *bufio.Reader) []string {
+	t.Helper()
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return lines
+		}
+		lines = append(lines, line)
+	}
+}
+
+// publishUserDeleted publishes a user.deleted event for every ID.
+func publishUserDeleted(t *testing.T, broker *events.Broker, ids ...int) []event.Event {
+	t.Helper()
+	published := make([]event.Event, len(ids))
+	for i, id := range ids {
+		e, err := event.New(event.TypeUserDeleted, event.UserDeleted{ID: id})
+		require.NoError(t, err)
+		published[i] = e
+	}
+	require.NoError(t, broker.Publish(context.Background(), published))
+	return published
+}
+
+func TestStreamUserEventsHandler(t *testing.T) {
+	t.Run("should stream published events", func(t *testing.T) {
+		// Arrange
+		server, _, broker := newTestUserEventsServer(t, config.EventsConfig{})
+		resp, body := openStream(t, server.URL, "")
+
+		// Act
+		published := publishUserDeleted(t, broker, 7)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, ContentTypeEventStream, resp.Header.Get("Content-Type"))
+		assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+		message := readMessage(t, body)
+		require.Len(t, message, 3)
+		assert.Equal(t, "id: "+published[0].ID, message[0])
+		assert.Equal(t, "event: "+event.TypeUserDeleted, message[1])
+		assert.Contains(t, message[2], `"data":{"id":7,`)
+	})
+
+	t.Run("should send heartbeats while no event occurs", func(t *testing.T) {
+		// Arrange
+		server, _, _ := newTestUserEventsServer(t, config.EventsConfig{Heartbeat: 20 * time.Millisecond})
+
+		// Act
+		_, body := openStream(t, server.URL, "")
+
+		// Assert
+		assert.Equal(t, []string{": heartbeat"}, readMessage(t, body))
+		assert.Equal(t, []string{": heartbeat"}, readMessage(t, body))
+	})
+
+	t.Run("should first send the events missed since Last-Event-ID", func(t *testing.T) {
+		// Arrange
+		server, _, broker := newTestUserEventsServer(t, config.EventsConfig{})
+		missed := publishUserDeleted(t, broker, 1, 2, 3)
+
+		// Act
+		_, body := openStream(t, server.URL, missed[0].ID)
+		live := publishUserDeleted(t, broker, 4)
+
+		// Assert
+		for _, e := range append(missed[1:], live...) {
+			assert.Equal(t, "id: "+e.ID, readMessage(t, body)[0])
+		}
+	})
+
+	t.Run("should end the streams on shutdown", func(t *testing.T) {
+		// Arrange
+		server, h, _ := newTestUserEventsServer(t, config.EventsConfig{})
+		resp, body := openStream(t, server.URL, "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		// Act
+		h.Shutdown()
+
+		// Assert
+		_, err := io.ReadAll(body)
+		assert.NoError(t, err, "the stream should end before the client timeout")
+	})
+
+	t.Run("should answer 503 beyond the maximum number of streams", func(t *testing.T) {
+		// Arrange
+		server, _, _ := newTestUserEventsServer(t, config.EventsConfig{MaxConnections: 1})
+		first, _ := openStream(t, server.URL, "")
+		require.Equal(t, http.StatusOK, first.StatusCode)
+
+		// Act
+		second, body := openStream(t, server.URL, "")
+
+		// Assert
+		assert.Equal(t, http.StatusServiceUnavailable, second.StatusCode)
+		data, err := io.ReadAll(body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"error": "Too many connections"}`, string(data))
+	})
+}
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	user "http-server/dto/user"
+	"http-server/middleware"
+	"http-server/services"
+	"http-server/storage"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+// newTestUserService returns an in-memory user service holding the given
+// users.
+func newTestUserService(t *testing.T, users ...user.CreateUserRequest) services.UserService {
+	t.Helper()
+	service := services.NewUserService(storage.NewMemoryUserRepository(), storage.NewMemoryOutboxRepository(),
+		storage.NewNoopTxManager(), storagetest.NewRedisClient(t))
+	for i := range users {
+		_, err := service.CreateUser(context.Background(), &users[i])
+		require.NoError(t, err)
+	}
+	return service
+}
+
+// newUserRouter returns the /users routes over service.
+func newUserRouter(service services.UserService) http.Handler {
+	h := NewUserHandler(service, nil)
+	r := chi.NewRouter()
+	r.Route("/users", func(r chi.Router) {
+		r.Use(middleware.BasicAuth)
+		r.Post("/import", h.ImportUsersHandler)
+		r.Get("/export", h.ExportUsersHandler)
+		r.Get("/{id}", h.GetUserHandler)
+		r.Put("/{id}", h.UpdateUserHandler)
+		r.Delete("/{id}", h.DeleteUserHandler)
+	})
+	return r
+}
+
+// newTestUserRouter returns the /users routes over an in-memory user
+// service holding the given users.
+func newTestUserRouter(t *testing.T, users ...user.CreateUserRequest) (http.Handler, services.UserService) {
+	t.Helper()
+	service := newTestUserService(t, users...)
+	return newUserRouter(service), service
+}
+
+// serve sends an admin request to handler. headers are name, value pairs.
+func serve(handler http.Handler, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	req.SetBasicAuth("admin", "password")
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+var alice = user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"}
+
+func TestGetUserHandler(t *testing.T) {
+	t.Run("should return the user with its version as ETag", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		rec := serve(router, http.MethodGet, "/users/1", "")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+		var got user.User
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+		assert.Equal(t, "alice@example.com", got.Email)
+	})
+
+	t.Run("should return 304 when If-None-Match matches", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		strong := serve(router, http.MethodGet, "/users/1", "", "If-None-Match", `"1"`)
+		weak := serve(router, http.MethodGet, "/users/1", "", "If-None-Match", `"7", W/"1"`)
+		stale := serve(router, http.MethodGet, "/users/1", "", "If-None-Match", `"7"`)
+
+		// Assert
+		assert.Equal(t, http.StatusNotModified, strong.Code)
+		assert.Empty(t, strong.Body.String())
+		assert.Equal(t, `"1"`, strong.Header().Get("ETag"))
+		assert.Equal(t, http.StatusNotModified, weak.Code)
+		assert.Equal(t, http.StatusOK, stale.Code)
+	})
+
+	t.Run("should return 404 for missing users and 400 for invalid IDs", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t)
+
+		// Act
+		missing := serve(router, http.MethodGet, "/users/9", "")
+		invalid := serve(router, http.MethodGet, "/users/abc", "")
+
+		// Assert
+		assert.Equal(t, http.StatusNotFound, missing.Code)
+		assert.Equal(t, http.StatusBadRequest, invalid.Code)
+	})
+}
+
+func TestUpdateUserHandler(t *testing.T) {
+	body := `{"name": "Alicia", "email": "alice@example.com"}`
+
+	t.Run("should update a user whose ETag matches If-Match", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		rec := serve(router, http.MethodPut, "/users/1", body, "If-Match", `"1"`)
+
+		// Assert
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+	})
+
+	t.Run("should update without If-Match or with a wildcard", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		without := serve(router, http.MethodPut, "/users/1", body)
+		wildcard := serve(router, http.MethodPut, "/users/1", body, "If-Match", "*")
+
+		// Assert
+		assert.Equal(t, http.StatusOK, without.Code)
+		assert.Equal(t, http.StatusOK, wildcard.Code)
+		assert.Equal(t, `"3"`, wildcard.Header().Get("ETag"))
+	})
+
+	t.Run("should return 412 when If-Match is stale", func(t *testing.T) {
+		// Arrange
+		router, service := newTestUserRouter(t, alice)
+
+		// Act
+		rec := serve(router, http.MethodPut, "/users/1", body, "If-Match", `"2"`)
+
+		// Assert
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		got, err := service.GetUser(context.Background(), 1, storage.UserFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", got.Name)
+	})
+
+	t.Run("should return 400 for a malformed If-Match", func(t *testing.T) {
+		for _, ifMatch := range []string{`1`, `W/"1"`, `"one"`, `"0"`, `"1", "2"`} {
+			// Arrange
+			router, _ := newTestUserRouter(t, alice)
+
+			// Act
+			rec := serve(router, http.MethodPut, "/users/1", body, "If-Match", ifMatch)
+
+			// Assert
+			assert.Equal(t, http.StatusBadRequest, rec.Code, ifMatch)
+			assert.JSONEq(t, `{"error": "Invalid If-Match header"}`, rec.Body.String())
+		}
+	})
+}
+
+func TestDeleteUserHandler(t *testing.T) {
+	t.Run("should delete a user whose ETag matches If-Match", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		rec := serve(router, http.MethodDelete, "/users/1", "", "If-Match", `"1"`)
+		after := serve(router, http.MethodGet, "/users/1", "")
+
+		// Assert
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, http.StatusNotFound, after.Code)
+	})
+
+	t.Run("should return 412 when If-Match is stale", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		rec := serve(router, http.MethodDelete, "/users/1", "", "If-Match", `"5"`)
+		after := serve(router, http.MethodGet, "/users/1", "")
+
+		// Assert
+		assert.Equal(t, http.StatusPreconditionFailed, rec.Code)
+		assert.Equal(t, http.StatusOK, after.Code)
+	})
+
+	t.Run("should return 400 for a malformed If-Match", func(t *testing.T) {
+		// Arrange
+		router, _ := newTestUserRouter(t, alice)
+
+		// Act
+		rec := serve(router, http.MethodDelete, "/users/1?permanent=true", "", "If-Match", "latest")
+
+		// Assert
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -0,0 +1,294 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"http-server/dto/event"
+	"http-server/dto/webhook"
+	"http-server/middleware"
+	"http-server/services"
+	"http-server/storage"
+	"http-server/utils"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+// ============== STRUCTS ==============
+
+type WebhookHandler struct {
+	service services.WebhookService
+}
+
+func NewWebhookHandler(service services.WebhookService) *WebhookHandler {
+	return &WebhookHandler{service: service}
+}
+
+// ============== METHODS ==============
+
+// GetWebhooksHandler godoc
+//
+//	@Summary		Get all webhooks
+//	@Description	Get a list of all webhook subscriptions, without their secrets (admins only)
+//	@Tags			webhooks
+//	@Produce		json
+//	@Success		200	{array}		webhook.Webhook
+//	@Failure		403	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/webhooks [get]
+func (h *WebhookHandler) GetWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.adminOnly(w, r) {
+		return
+	}
+
+	webhooks, err := h.service.GetWebhooks(r.Context())
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get webhooks"}, http.StatusInternalServerError)
+		return
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	utils.WriteJSON(w, webhooks)
+}
+
+// GetWebhookHandler godoc
+//
+//	@Summary		Get a webhook by ID
+//	@Description	Get a single webhook subscription, without its secret (admins only)
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id	path		int	true	"Webhook ID"
+//	@Success		200	{object}	webhook.Webhook
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/webhooks/{id} [get]
+func (h *WebhookHandler) GetWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.adminOnly(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid webhook ID"}, http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.service.GetWebhook(r.Context(), id)
+	if errors.Is(err, storage.ErrWebhookNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Webhook not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get webhook"}, http.StatusInternalServerError)
+		return
+	}
+
+	hook.Secret = ""
+	utils.WriteJSON(w, hook)
+}
+
+// CreateWebhookHandler godoc
+//
+//	@Summary		Create a webhook
+//	@Description	Subscribe a URL to user events. The response holds the secret signing the deliveries, which is not returned again (admins only).
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			webhook			body		webhook.CreateWebhookRequest	true	"Webhook to be created"
+//	@Param			Idempotency-Key	header		string							false	"Key making retries of this request safe"
+//	@Success		201				{object}	webhook.Webhook
+//	@Failure		400				{object}	map[string]string
+//	@Failure		403				{object}	map[string]string
+//	@Failure		413				{object}	map[string]string
+//	@Failure		422				{object}	map[string]string
+//	@Failure		500				{object}	map[string]string
+//	@Router			/webhooks [post]
+func (h *WebhookHandler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.adminOnly(w, r) {
+		return
+	}
+	var req webhook.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if msg := validateWebhook(req.URL, req.EventTypes); msg != "" {
+		utils.WriteJSONStatus(w, map[string]string{"error": msg}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	hook, err := h.service.CreateWebhook(r.Context(), &req)
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to create webhook"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("Webhook created", "id", hook.ID)
+	utils.WriteJSONStatus(w, hook, http.StatusCreated)
+}
+
+// UpdateWebhookHandler godoc
+//
+//	@Summary		Update a webhook
+//	@Description	Replace the URL, event types and state of a webhook. Enabling it again resets its failure count (admins only).
+//	@Tags			webhooks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		int							true	"Webhook ID"
+//	@Param			webhook	body		webhook.UpdateWebhookRequest	true	"New webhook details"
+//	@Success		200		{object}	webhook.Webhook
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		422		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/webhooks/{id} [put]
+func (h *WebhookHandler) UpdateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.adminOnly(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid webhook ID"}, http.StatusBadRequest)
+		return
+	}
+	var req webhook.UpdateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
+		return
+	}
+	if msg := validateWebhook(req.URL, req.EventTypes); msg != "" {
+		utils.WriteJSONStatus(w, map[string]string{"error": msg}, http.StatusUnprocessableEntity)
+		return
+	}
+
+	hook, err := h.service.UpdateWebhook(r.Context(), id, &req)
+	if errors.Is(err, storage.ErrWebhookNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Webhook not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to update webhook"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("Webhook updated", "id", id, "active", hook.Active)
+	hook.Secret = ""
+	utils.WriteJSON(w, hook)
+}
+
+// DeleteWebhookHandler godoc
+//
+//	@Summary		Delete a webhook
+//	@Description	Delete a webhook with its delivery log. Pending deliveries are dropped (admins only).
+//	@Tags			webhooks
+//	@Param			id	path	int	true	"Webhook ID"
+//	@Success		204	"No Content"
+//	@Failure		400	{object}	map[string]string
+//	@Failure		403	{object}	map[string]string
+//	@Failure		404	{object}	map[string]string
+//	@Failure		500	{object}	map[string]string
+//	@Router			/webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.adminOnly(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid webhook ID"}, http.StatusBadRequest)
+		return
+	}
+
+	err = h.service.DeleteWebhook(r.Context(), id)
+	if errors.Is(err, storage.ErrWebhookNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Webhook not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to delete webhook"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.LoggerFromContext(r.Context()).Info("Webhook deleted", "id", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveriesHandler godoc
+//
+//	@Summary		Get the deliveries of a webhook
+//	@Description	Get the latest delivery attempts of a webhook, newest first (admins only)
+//	@Tags			webhooks
+//	@Produce		json
+//	@Param			id		path		int	true	"Webhook ID"
+//	@Param			limit	query		int	false	"Maximum number of deliveries, up to 500"	default(50)
+//	@Success		200		{array}		webhook.Delivery
+//	@Failure		400		{object}	map[string]string
+//	@Failure		403		{object}	map[string]string
+//	@Failure		404		{object}	map[string]string
+//	@Failure		500		{object}	map[string]string
+//	@Router			/webhooks/{id}/deliveries [get]
+func (h *WebhookHandler) GetDeliveriesHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.adminOnly(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Invalid webhook ID"}, http.StatusBadRequest)
+		return
+	}
+	limit := defaultDeliveriesLimit
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		limit, err = strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > maxDeliveriesLimit {
+			utils.WriteJSONStatus(w, map[string]string{"error": "Limit must be between 1 and 500"}, http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := h.service.GetDeliveries(r.Context(), id, limit)
+	if errors.Is(err, storage.ErrWebhookNotFound) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Webhook not found"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Failed to get webhook deliveries"}, http.StatusInternalServerError)
+		return
+	}
+
+	utils.WriteJSON(w, deliveries)
+}
+
+// adminOnly writes a 403 response unless the caller is an admin.
+func (h *WebhookHandler) adminOnly(w http.ResponseWriter, r *http.Request) bool {
+	if !middleware.IsAdmin(r.Context()) {
+		utils.WriteJSONStatus(w, map[string]string{"error": "Only admins can manage webhooks"}, http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// validateWebhook returns why a webhook URL or event type filter is
+// invalid, or "".
+func validateWebhook(rawURL string, eventTypes []string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "URL must be an absolute http or https URL"
+	}
+	for _, t := range eventTypes {
+		if !slices.Contains(event.Types, t) {
+			return "Unknown event type " + strconv.Quote(t)
+		}
+	}
+	return ""
+}
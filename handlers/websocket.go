@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"errors"
+	"http-server/realtime"
+	"http-server/utils"
+	"net/http"
+)
+
+// ============== STRUCTS ==============
+
+type WebSocketHandler struct {
+	hub *realtime.Hub
+}
+
+func NewWebSocketHandler(hub *realtime.Hub) *WebSocketHandler {
+	return &WebSocketHandler{hub: hub}
+}
+
+// ============== METHODS ==============
+
+// ConnectHandler godoc
+//
+//	@Summary		Open a WebSocket
+//	@Description	Upgrade to a WebSocket receiving user events. Clients send JSON messages {"type": "subscribe"|"unsubscribe", "topic": "users"|"users:{id}"} and {"type": "ping"}, answered with subscribed, unsubscribed and pong messages. Events arrive as {"type": "event", "topic": "...", "event": {...}}. Connections whose send buffer fills up are closed with status 1008.
+//	@Tags			users
+//	@Success		101	{string}	string	"Switching Protocols"
+//	@Failure		400	{string}	string	"Not a WebSocket handshake"
+//	@Failure		403	{string}	string	"Origin not allowed"
+//	@Failure		503	{object}	map[string]string
+//	@Router			/ws [get]
+func (h *WebSocketHandler) ConnectHandler(w http.ResponseWriter, r *http.Request) {
+	err := h.hub.Serve(w, r)
+	switch {
+	case errors.Is(err, realtime.ErrTooManyConnections):
+		utils.WriteJSONStatus(w, map[string]string{"error": "Too many connections"}, http.StatusServiceUnavailable)
+	case errors.Is(err, realtime.ErrHubStopped):
+		utils.WriteJSONStatus(w, map[string]string{"error": "Server is shutting down"}, http.StatusServiceUnavailable)
+	case err != nil:
+		// The upgrader has already responded
+		utils.LoggerFromContext(r.Context()).Debug("WebSocket handshake failed", "error", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Package jobs runs work outside of request handlers. Jobs are stored in
+// Redis, claimed by in-process workers for a visibility timeout, retried
+// with exponential backoff and moved to a dead-letter list once they run
+// out of attempts.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Job statuses.
+const (
+	// StatusQueued jobs wait for a worker, possibly until a retry is due.
+	StatusQueued = "queued"
+	// StatusRunning jobs have been claimed by a worker.
+	StatusRunning = "running"
+	// StatusSucceeded jobs finished without error.
+	StatusSucceeded = "succeeded"
+	// StatusFailed jobs ran out of attempts, or failed permanently, and
+	// are in the dead-letter list.
+	StatusFailed = "failed"
+)
+
+// ErrJobNotFound is returned for unknown or expired job IDs.
+var ErrJobNotFound = errors.New("job not found")
+
+// Job is the state of a job, as reported by GET /jobs/{id}.
+type Job struct {
+	ID          string `json:"id" example:"6f1c2a8e-4f5b-4b8e-9c3d-2a7e5b1d0c9f"`
+	Type        string `json:"type" example:"users.import"`
+	Status      string `json:"status" enums:"queued,running,succeeded,failed" example:"succeeded"`
+	Attempts    int    `json:"attempts" example:"1"`
+	MaxAttempts int    `json:"max_attempts" example:"5"`
+	// LastError is the error of the latest failed attempt.
+	LastError string `json:"last_error,omitempty"`
+	// Result is the value returned by the handler of a succeeded job.
+	Result    json.RawMessage `json:"result,omitempty" swaggertype:"object"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	// RunAt is when a queued job is due.
+	RunAt time.Time `json:"run_at"`
+
+	// claim is the token of the worker running the job.
+	claim string
+}
+
+// permanentError marks an error that retrying cannot fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent wraps err so that the job failing with it is moved to the
+// dead-letter list without being retried, for example because its payload
+// is invalid.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+type attemptCtxKey struct{}
+
+// Attempt returns the number of the attempt running the job of ctx,
+// starting at 1, or 0 outside of a job handler.
+func Attempt(ctx context.Context) int {
+	attempt, _ := ctx.Value(attemptCtxKey{}).(int)
+	return attempt
+}
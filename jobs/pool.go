@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"context"
+	"http-server/utils"
+	"sync"
+	"time"
+)
+
+const defaultWorkers = 4
+
+// Pool runs the jobs of a Queue on a fixed number of in-process workers.
+type Pool struct {
+	queue   *Queue
+	workers int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// jobsCtx is passed to running jobs and cancelled when Shutdown stops
+	// waiting for them.
+	jobsCtx    context.Context
+	cancelJobs context.CancelFunc
+	wg         sync.WaitGroup
+}
+
+// NewPool creates a Pool of workers running the jobs of queue. It
+// defaults to 4 workers.
+func NewPool(queue *Queue, workers int) *Pool {
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	return &Pool{
+		queue:      queue,
+		workers:    workers,
+		stop:       make(chan struct{}),
+		jobsCtx:    jobsCtx,
+		cancelJobs: cancelJobs,
+	}
+}
+
+// Start starts the workers.
+func (p *Pool) Start() {
+	for range p.workers {
+		p.wg.Add(1)
+		go p.work()
+	}
+}
+
+// Shutdown stops the workers from claiming jobs and waits for the running
+// ones to finish. When ctx is done first, the running jobs are cancelled
+// and Shutdown returns without waiting for them; they are retried once
+// their visibility timeout expires.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		p.cancelJobs()
+		return nil
+	case <-ctx.Done():
+		p.cancelJobs()
+		return ctx.Err()
+	}
+}
+
+// work claims and runs jobs until the pool is stopped, polling the queue
+// while it is empty.
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		default:
+		}
+
+		job, payload, err := p.queue.claim(p.jobsCtx)
+		if err != nil {
+			utils.Logger.Error("Failed to claim job", "error", err)
+		}
+		if job == nil {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(p.queue.cfg.PollInterval):
+			}
+			continue
+		}
+		p.queue.run(p.jobsCtx, job, payload)
+	}
+}
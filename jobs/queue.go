@@ -0,0 +1,387 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"http-server/config"
+	"http-server/storage"
+	"http-server/utils"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultMaxAttempts       = 5
+	defaultBackoffBase       = time.Second
+	defaultBackoffMax        = 10 * time.Minute
+	defaultPollInterval      = time.Second
+	defaultRetention         = 24 * time.Hour
+)
+
+// Redis keys of the queue.
+const (
+	// readyKey is a sorted set of queued job IDs scored by when they are
+	// due, in Unix milliseconds.
+	readyKey = "jobs:ready"
+	// inflightKey is a sorted set of claimed job IDs scored by their
+	// visibility deadline.
+	inflightKey = "jobs:inflight"
+	// deadKey is the dead-letter list of failed job IDs, newest first.
+	deadKey = "jobs:dead"
+	// jobKeyPrefix prefixes the hash holding the state of a job, as JSON in
+	// its "job" field, and its payload.
+	jobKeyPrefix = "jobs:job:"
+)
+
+// claimScript returns the jobs whose visibility deadline passed to the
+// ready set, then moves the first due job to the in-flight set and stores
+// the claim token of the worker in its hash. Doing all of it in one script
+// keeps two workers from claiming the same job, and a worker whose claim
+// expired from recording an outcome, see finishScript.
+//
+// KEYS: ready set, in-flight set. ARGV: now, visibility deadline, claim
+// token, job key prefix.
+var claimScript = redis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[1])
+for _, id in ipairs(expired) do
+	redis.call('ZREM', KEYS[2], id)
+	redis.call('ZADD', KEYS[1], ARGV[1], id)
+end
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, 1)
+if #due == 0 then
+	return false
+end
+redis.call('ZREM', KEYS[1], due[1])
+redis.call('ZADD', KEYS[2], ARGV[2], due[1])
+redis.call('HSET', ARGV[4] .. due[1], 'claim', ARGV[3])
+return due[1]
+`)
+
+// finishScript records the outcome of a claimed job if the claim token in
+// its hash is still that of the worker: the job leaves the in-flight set,
+// its state is written and, depending on the outcome, it expires, is
+// queued again or is pushed to the dead-letter list. It returns 0 without
+// changing anything when the job was claimed again in the meantime.
+//
+// KEYS: job hash, in-flight set, ready set, dead-letter list. ARGV: claim
+// token, job ID, state, outcome (complete, retry or bury), retention in
+// milliseconds for complete or due score for retry.
+var finishScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'claim') ~= ARGV[1] then
+	return 0
+end
+redis.call('ZREM', KEYS[2], ARGV[2])
+redis.call('HSET', KEYS[1], 'job', ARGV[3])
+redis.call('HDEL', KEYS[1], 'claim')
+if ARGV[4] == 'complete' then
+	redis.call('PEXPIRE', KEYS[1], ARGV[5])
+elseif ARGV[4] == 'retry' then
+	redis.call('ZADD', KEYS[3], ARGV[5], ARGV[2])
+else
+	redis.call('LPUSH', KEYS[4], ARGV[2])
+end
+return 1
+`)
+
+// errClaimLost is returned when recording the outcome of a job that another
+// worker claimed after the visibility timeout of the first one expired.
+var errClaimLost = errors.New("job was claimed by another worker")
+
+type handlerFunc func(ctx context.Context, payload []byte) (any, error)
+
+// Queue is a job queue stored in Redis. Any instance can enqueue jobs and
+// look them up, and the workers of a Pool run them.
+type Queue struct {
+	rdb *storage.RedisClient
+	cfg config.JobsConfig
+
+	mu       sync.RWMutex
+	handlers map[string]handlerFunc
+}
+
+// NewQueue creates a Queue on rdb. Zero values in cfg are replaced by their
+// defaults.
+func NewQueue(rdb *storage.RedisClient, cfg *config.JobsConfig) *Queue {
+	q := &Queue{rdb: rdb, cfg: *cfg, handlers: make(map[string]handlerFunc)}
+	if q.cfg.VisibilityTimeout <= 0 {
+		q.cfg.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if q.cfg.MaxAttempts <= 0 {
+		q.cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if q.cfg.BackoffBase <= 0 {
+		q.cfg.BackoffBase = defaultBackoffBase
+	}
+	if q.cfg.BackoffMax <= 0 {
+		q.cfg.BackoffMax = defaultBackoffMax
+	}
+	if q.cfg.PollInterval <= 0 {
+		q.cfg.PollInterval = defaultPollInterval
+	}
+	if q.cfg.Retention <= 0 {
+		q.cfg.Retention = defaultRetention
+	}
+	return q
+}
+
+// Register makes fn the handler of the jobs named name. Payloads are
+// decoded from JSON into T, and the value fn returns, which may be nil, is
+// stored as the result of the job. Register panics if name is registered
+// twice.
+func Register[T any](q *Queue, name string, fn func(ctx context.Context, payload T) (any, error)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, dup := q.handlers[name]; dup {
+		panic(fmt.Sprintf("jobs: handler %q registered twice", name))
+	}
+	q.handlers[name] = func(ctx context.Context, data []byte) (any, error) {
+		var payload T
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return nil, Permanent(fmt.Errorf("invalid payload: %w", err))
+		}
+		return fn(ctx, payload)
+	}
+}
+
+func (q *Queue) handler(name string) (handlerFunc, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	fn, ok := q.handlers[name]
+	return fn, ok
+}
+
+// Enqueue adds a job named name with the JSON encoding of payload, due
+// immediately.
+func (q *Queue) Enqueue(ctx context.Context, name string, payload any) (*Job, error) {
+	if _, ok := q.handler(name); !ok {
+		return nil, fmt.Errorf("no handler registered for job %q", name)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload for job %q: %w", name, err)
+	}
+
+	now := time.Now().UTC()
+	job := &Job{
+		ID:          uuid.NewString(),
+		Type:        name,
+		Status:      StatusQueued,
+		MaxAttempts: q.cfg.MaxAttempts,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		RunAt:       now,
+	}
+	state, err := json.Marshal(job)
+	if err != nil {
+		return nil, err
+	}
+	_, err = q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, jobKey(job.ID), "job", state, "payload", data)
+		pipe.ZAdd(ctx, readyKey, &redis.Z{Score: score(now), Member: job.ID})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Get returns the state of a job.
+func (q *Queue) Get(ctx context.Context, id string) (*Job, error) {
+	state, err := q.rdb.HGet(ctx, jobKey(id), "job").Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(state, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// claim takes the next due job for the visibility timeout and counts the
+// attempt. It returns a nil job when none is due.
+func (q *Queue) claim(ctx context.Context) (*Job, []byte, error) {
+	now := time.Now().UTC()
+	token := uuid.NewString()
+	id, err := claimScript.Run(ctx, q.rdb, []string{readyKey, inflightKey},
+		score(now), score(now.Add(q.cfg.VisibilityTimeout)), token, jobKeyPrefix).Text()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values, err := q.rdb.HMGet(ctx, jobKey(id), "job", "payload").Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	state, _ := values[0].(string)
+	payload, _ := values[1].(string)
+	if state == "" {
+		// The job expired or was deleted while queued.
+		return nil, nil, q.rdb.ZRem(ctx, inflightKey, id).Err()
+	}
+	job := Job{claim: token}
+	if err := json.Unmarshal([]byte(state), &job); err != nil {
+		return nil, nil, err
+	}
+
+	if job.Status == StatusRunning {
+		// The previous attempt did not finish within the visibility timeout.
+		job.LastError = "visibility timeout expired"
+		if job.Attempts >= job.MaxAttempts {
+			return nil, nil, q.bury(ctx, &job)
+		}
+	}
+	job.Status = StatusRunning
+	job.Attempts++
+	job.UpdatedAt = now
+	if err := q.save(ctx, &job); err != nil {
+		return nil, nil, err
+	}
+	return &job, []byte(payload), nil
+}
+
+// run calls the handler of job and records the outcome. The handler is
+// cancelled at the end of the visibility timeout, when another worker may
+// claim the job again.
+func (q *Queue) run(ctx context.Context, job *Job, payload []byte) {
+	logger := utils.Logger.With("job_id", job.ID, "job_type", job.Type, "attempt", job.Attempts)
+	ctx = context.WithValue(utils.ContextWithLogger(ctx, logger), attemptCtxKey{}, job.Attempts)
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.VisibilityTimeout)
+	defer cancel()
+
+	t0 := time.Now()
+	result, err := q.call(ctx, job, payload)
+
+	// Record the outcome even when ctx was cancelled by a shutdown.
+	ctx = context.WithoutCancel(ctx)
+	if err != nil {
+		logger.Warn("Job failed", "error", err, "latency", time.Since(t0))
+		err = q.fail(ctx, job, err)
+	} else {
+		logger.Info("Job succeeded", "latency", time.Since(t0))
+		err = q.complete(ctx, job, result)
+	}
+	if errors.Is(err, errClaimLost) {
+		logger.Warn("Job outcome discarded", "error", err)
+	} else if err != nil {
+		logger.Error("Failed to record job outcome", "error", err)
+	}
+}
+
+// call runs the handler of job, turning panics into errors.
+func (q *Queue) call(ctx context.Context, job *Job, payload []byte) (result any, err error) {
+	fn, ok := q.handler(job.Type)
+	if !ok {
+		return nil, Permanent(fmt.Errorf("no handler registered for job %q", job.Type))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx, payload)
+}
+
+// complete records the result of a succeeded job, which is kept for the
+// retention period.
+func (q *Queue) complete(ctx context.Context, job *Job, result any) error {
+	if result != nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			return q.fail(ctx, job, Permanent(fmt.Errorf("invalid result: %w", err)))
+		}
+		job.Result = data
+	}
+	job.Status = StatusSucceeded
+	job.UpdatedAt = time.Now().UTC()
+	return q.finish(ctx, job, "complete", q.cfg.Retention.Milliseconds())
+}
+
+// fail schedules a retry of a failed job after its backoff delay, or moves
+// it to the dead-letter list once it ran out of attempts or failed
+// permanently.
+func (q *Queue) fail(ctx context.Context, job *Job, jobErr error) error {
+	job.LastError = jobErr.Error()
+	var permanent *permanentError
+	if job.Attempts >= job.MaxAttempts || errors.As(jobErr, &permanent) {
+		return q.bury(ctx, job)
+	}
+
+	now := time.Now().UTC()
+	job.Status = StatusQueued
+	job.UpdatedAt = now
+	job.RunAt = now.Add(q.backoff(job.Attempts))
+	return q.finish(ctx, job, "retry", score(job.RunAt))
+}
+
+// bury moves a job to the dead-letter list. Failed jobs do not expire.
+func (q *Queue) bury(ctx context.Context, job *Job) error {
+	job.Status = StatusFailed
+	job.UpdatedAt = time.Now().UTC()
+	if err := q.finish(ctx, job, "bury", 0); err != nil {
+		return err
+	}
+	utils.Logger.Error("Job moved to the dead-letter list", "job_id", job.ID, "job_type", job.Type, "attempts", job.Attempts, "error", job.LastError)
+	return nil
+}
+
+// finish records the outcome of a job claimed by this worker, returning
+// errClaimLost when another worker claimed it since. arg is passed to
+// finishScript with the outcome.
+func (q *Queue) finish(ctx context.Context, job *Job, outcome string, arg any) error {
+	state, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	owned, err := finishScript.Run(ctx, q.rdb, []string{jobKey(job.ID), inflightKey, readyKey, deadKey},
+		job.claim, job.ID, state, outcome, arg).Int()
+	if err != nil {
+		return err
+	}
+	if owned == 0 {
+		return errClaimLost
+	}
+	return nil
+}
+
+// save writes the state of job.
+func (q *Queue) save(ctx context.Context, job *Job) error {
+	state, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.rdb.HSet(ctx, jobKey(job.ID), "job", state).Err()
+}
+
+// backoff returns the delay before the retry following the given attempt:
+// BackoffBase doubled for every earlier attempt, capped at BackoffMax.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.cfg.BackoffBase
+	for i := 1; i < attempt && d < q.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	return min(d, q.cfg.BackoffMax)
+}
+
+func jobKey(id string) string {
+	return jobKeyPrefix + id
+}
+
+// score converts t to the Unix milliseconds used as sorted set scores.
+func score(t time.Time) float64 {
+	return float64(t.UnixMilli())
+}
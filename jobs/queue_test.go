@@ -0,0 +1,298 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+type greeting struct {
+	Name string `json:"name"`
+}
+
+func newTestQueue(t *testing.T, cfg config.JobsConfig) *Queue {
+	t.Helper()
+	rdb := storagetest.NewRedisClient(t)
+	if cfg.PollInterval == 0 {
+		cfg.PollInterval = 5 * time.Millisecond
+	}
+	return NewQueue(rdb, &cfg)
+}
+
+// waitForStatus polls the job until it has the given status.
+func waitForStatus(t *testing.T, q *Queue, id, status string) *Job {
+	t.Helper()
+	var job *Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = q.Get(context.Background(), id)
+		return err == nil && job.Status == status
+	}, 5*time.Second, 5*time.Millisecond)
+	return job
+}
+
+func TestQueue(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should run jobs and store their result", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{})
+		Register(q, "greet", func(ctx context.Context, p greeting) (any, error) {
+			return map[string]string{"greeting": "Hello, " + p.Name}, nil
+		})
+		pool := NewPool(q, 2)
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Shutdown(ctx) })
+
+		// Act
+		queued, err := q.Enqueue(ctx, "greet", greeting{Name: "Alice"})
+		require.NoError(t, err)
+
+		// Assert
+		assert.Equal(t, StatusQueued, queued.Status)
+		job := waitForStatus(t, q, queued.ID, StatusSucceeded)
+		assert.Equal(t, 1, job.Attempts)
+		assert.JSONEq(t, `{"greeting":"Hello, Alice"}`, string(job.Result))
+	})
+
+	t.Run("should refuse jobs without a handler", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{})
+
+		// Act
+		_, err := q.Enqueue(ctx, "unknown", nil)
+
+		// Assert
+		assert.Error(t, err)
+	})
+
+	t.Run("should return ErrJobNotFound for unknown IDs", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{})
+
+		// Act
+		_, err := q.Get(ctx, "missing")
+
+		// Assert
+		assert.ErrorIs(t, err, ErrJobNotFound)
+	})
+
+	t.Run("should retry failing jobs until they succeed", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{BackoffBase: time.Millisecond})
+		var calls atomic.Int32
+		Register(q, "flaky", func(ctx context.Context, p greeting) (any, error) {
+			if calls.Add(1) < 3 {
+				return nil, errors.New("temporary failure")
+			}
+			return map[string]int{"attempt": Attempt(ctx)}, nil
+		})
+		pool := NewPool(q, 1)
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Shutdown(ctx) })
+
+		// Act
+		queued, err := q.Enqueue(ctx, "flaky", greeting{})
+		require.NoError(t, err)
+
+		// Assert
+		job := waitForStatus(t, q, queued.ID, StatusSucceeded)
+		assert.Equal(t, 3, job.Attempts)
+		assert.Equal(t, "temporary failure", job.LastError)
+		assert.JSONEq(t, `{"attempt":3}`, string(job.Result))
+	})
+
+	t.Run("should move jobs out of attempts to the dead-letter list", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{MaxAttempts: 2, BackoffBase: time.Millisecond})
+		Register(q, "broken", func(ctx context.Context, p greeting) (any, error) {
+			panic("boom")
+		})
+		pool := NewPool(q, 1)
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Shutdown(ctx) })
+
+		// Act
+		queued, err := q.Enqueue(ctx, "broken", greeting{})
+		require.NoError(t, err)
+
+		// Assert
+		job := waitForStatus(t, q, queued.ID, StatusFailed)
+		assert.Equal(t, 2, job.Attempts)
+		assert.Equal(t, "panic: boom", job.LastError)
+		dead, err := q.rdb.LRange(ctx, deadKey, 0, -1).Result()
+		require.NoError(t, err)
+		assert.Equal(t, []string{queued.ID}, dead)
+	})
+
+	t.Run("should not retry permanent failures", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{BackoffBase: time.Millisecond})
+		Register(q, "invalid", func(ctx context.Context, p greeting) (any, error) {
+			return nil, Permanent(errors.New("invalid name"))
+		})
+		pool := NewPool(q, 1)
+		pool.Start()
+		t.Cleanup(func() { _ = pool.Shutdown(ctx) })
+
+		// Act
+		queued, err := q.Enqueue(ctx, "invalid", greeting{})
+		require.NoError(t, err)
+
+		// Assert
+		job := waitForStatus(t, q, queued.ID, StatusFailed)
+		assert.Equal(t, 1, job.Attempts)
+	})
+
+	t.Run("should hand jobs to another worker after the visibility timeout", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{VisibilityTimeout: 50 * time.Millisecond})
+		Register(q, "greet", func(ctx context.Context, p greeting) (any, error) { return nil, nil })
+		queued, err := q.Enqueue(ctx, "greet", greeting{})
+		require.NoError(t, err)
+		first, _, err := q.claim(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, first)
+
+		// Act
+		before, _, errBefore := q.claim(ctx)
+		time.Sleep(60 * time.Millisecond)
+		after, _, errAfter := q.claim(ctx)
+
+		// Assert
+		require.NoError(t, errBefore)
+		require.NoError(t, errAfter)
+		assert.Nil(t, before)
+		require.NotNil(t, after)
+		assert.Equal(t, queued.ID, after.ID)
+		assert.Equal(t, 2, after.Attempts)
+		assert.Equal(t, "visibility timeout expired", after.LastError)
+	})
+
+	t.Run("should discard the outcome of a worker whose claim expired", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{VisibilityTimeout: 50 * time.Millisecond})
+		Register(q, "greet", func(ctx context.Context, p greeting) (any, error) { return nil, nil })
+		queued, err := q.Enqueue(ctx, "greet", greeting{})
+		require.NoError(t, err)
+		stale, _, err := q.claim(ctx)
+		require.NoError(t, err)
+		time.Sleep(60 * time.Millisecond)
+		current, _, err := q.claim(ctx)
+		require.NoError(t, err)
+		require.NotNil(t, current)
+
+		// Act
+		staleComplete := q.complete(ctx, stale, "stale")
+		staleFail := q.fail(ctx, stale, Permanent(errors.New("stale")))
+		running, getErr := q.Get(ctx, queued.ID)
+		currentComplete := q.complete(ctx, current, "current")
+
+		// Assert
+		assert.ErrorIs(t, staleComplete, errClaimLost)
+		assert.ErrorIs(t, staleFail, errClaimLost)
+		require.NoError(t, getErr)
+		assert.Equal(t, StatusRunning, running.Status)
+		require.NoError(t, currentComplete)
+		job, err := q.Get(ctx, queued.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusSucceeded, job.Status)
+		assert.JSONEq(t, `"current"`, string(job.Result))
+		dead, err := q.rdb.LLen(ctx, deadKey).Result()
+		require.NoError(t, err)
+		assert.Zero(t, dead)
+	})
+
+	t.Run("should double the backoff up to the maximum", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{BackoffBase: time.Second, BackoffMax: 5 * time.Second})
+
+		// Act
+		delays := []time.Duration{q.backoff(1), q.backoff(2), q.backoff(3), q.backoff(4), q.backoff(60)}
+
+		// Assert
+		assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+	})
+}
+
+func TestPoolShutdown(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should wait for running jobs to finish", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{})
+		started := make(chan struct{})
+		release := make(chan struct{})
+		Register(q, "slow", func(ctx context.Context, p greeting) (any, error) {
+			close(started)
+			<-release
+			return nil, nil
+		})
+		pool := NewPool(q, 1)
+		pool.Start()
+		queued, err := q.Enqueue(ctx, "slow", greeting{})
+		require.NoError(t, err)
+		<-started
+
+		// Act
+		stopped := make(chan error)
+		go func() { stopped <- pool.Shutdown(ctx) }()
+		select {
+		case <-stopped:
+			t.Fatal("Shutdown returned while a job was running")
+		case <-time.After(20 * time.Millisecond):
+		}
+		close(release)
+
+		// Assert
+		assert.NoError(t, <-stopped)
+		job, err := q.Get(ctx, queued.ID)
+		require.NoError(t, err)
+		assert.Equal(t, StatusSucceeded, job.Status)
+	})
+
+	t.Run("should cancel running jobs when the deadline passes", func(t *testing.T) {
+		// Arrange
+		q := newTestQueue(t, config.JobsConfig{})
+		started := make(chan struct{})
+		Register(q, "stuck", func(ctx context.Context, p greeting) (any, error) {
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})
+		pool := NewPool(q, 1)
+		pool.Start()
+		queued, err := q.Enqueue(ctx, "stuck", greeting{})
+		require.NoError(t, err)
+		<-started
+		shutdownCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+
+		// Act
+		err = pool.Shutdown(shutdownCtx)
+
+		// Assert
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		job := waitForStatus(t, q, queued.ID, StatusQueued)
+		assert.Equal(t, context.Canceled.Error(), job.LastError)
+	})
+}
@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"context"
+	"http-server/utils"
 	"net/http"
 )
 
+type principalCtxKey struct{}
+
 // BasicAuth is a middleware that provides basic authentication.
 func BasicAuth(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -13,10 +17,25 @@ func BasicAuth(next http.Handler) http.Handler {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next.ServeHTTP(w, r)
+		utils.AddLogAttrs(r.Context(), "principal", user)
+		ctx := context.WithValue(r.Context(), principalCtxKey{}, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// PrincipalFromContext returns the authenticated user name, or "" if the
+// request was not authenticated.
+func PrincipalFromContext(ctx context.Context) string {
+	principal, _ := ctx.Value(principalCtxKey{}).(string)
+	return principal
+}
+
+// IsAdmin reports whether the authenticated user is an administrator.
+func IsAdmin(ctx context.Context) bool {
+	// Sample logic for checking roles
+	return PrincipalFromContext(ctx) == "admin"
+}
+
 func checkCredentials(user, pass string) bool {
 	// Sample logic for checking credentials
 	return user == "admin" && pass == "password"
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"http-server/storage"
+	"http-server/utils"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-redis/redis/v8"
+)
+
+// IdempotencyKeyHeader carries the client-chosen key identifying a request
+// across retries. IdempotentReplayedHeader marks replayed responses.
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	defaultIdempotencyTTL   = 24 * time.Hour
+	maxIdempotencyKeyLength = 255
+	defaultIdempotencyBody  = 1 << 20
+	// idempotencyLockTTL bounds how long a crashed request blocks retries
+	// with the same key.
+	idempotencyLockTTL = 2 * time.Minute
+)
+
+// replayedHeaders are the response headers stored and replayed with the body.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyRecord is stored in Redis under the idempotency key. Status is
+// zero while the first request is still in flight.
+type idempotencyRecord struct {
+	Fingerprint string            `json:"fingerprint"`
+	Status      int               `json:"status,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// Idempotency makes POST requests carrying an Idempotency-Key header safe to
+// retry. The first request with a key runs normally and its response is
+// stored in Redis for ttl; retries with the same key and body get the stored
+// response back. A retry arriving while the first request is still running
+// gets 409, and reusing a key with a different body gets 422. Keys are scoped
+// to the authenticated principal, so it must run after BasicAuth. Bodies are
+// read into memory to fingerprint them, so requests with a key and a body
+// larger than maxBody get 413. A zero ttl keeps responses for 24 hours, and a
+// zero maxBody allows 1 MiB.
+func Idempotency(rdb *storage.RedisClient, ttl time.Duration, maxBody int64) func(http.Handler) http.Handler {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	if maxBody <= 0 {
+		maxBody = defaultIdempotencyBody
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				utils.WriteJSONStatus(w, map[string]string{"error": "Idempotency-Key is too long"}, http.StatusBadRequest)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBody))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				utils.WriteJSONStatus(w, map[string]string{"error": "Request body is too large"}, http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				utils.WriteJSONStatus(w, map[string]string{"error": "Invalid request body"}, http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			ctx := r.Context()
+			logger := utils.LoggerFromContext(ctx)
+			redisKey := "idempotency:" + PrincipalFromContext(ctx) + ":" + key
+			fingerprint := requestFingerprint(r, body)
+
+			stored, acquired, err := acquireIdempotencyKey(ctx, rdb, redisKey, fingerprint)
+			if err != nil {
+				// Fail open: losing idempotency beats rejecting every write
+				// while Redis is unavailable.
+				logger.Error("Idempotency check failed", "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !acquired {
+				switch {
+				case stored.Fingerprint != fingerprint:
+					utils.WriteJSONStatus(w, map[string]string{"error": "Idempotency-Key was already used with a different request"}, http.StatusUnprocessableEntity)
+				case stored.Status == 0:
+					utils.WriteJSONStatus(w, map[string]string{"error": "A request with this Idempotency-Key is still in progress"}, http.StatusConflict)
+				default:
+					replayResponse(w, stored)
+				}
+				return
+			}
+
+			var buf bytes.Buffer
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			ww.Tee(&buf)
+			completed := false
+			defer func() {
+				// Server errors and panics release the key so the request
+				// can be retried.
+				if !completed || ww.Status() >= http.StatusInternalServerError {
+					if err := rdb.Del(context.WithoutCancel(ctx), redisKey).Err(); err != nil {
+						logger.Error("Failed to release idempotency key", "error", err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(ww, r)
+			completed = true
+			if ww.Status() >= http.StatusInternalServerError {
+				return
+			}
+
+			record := idempotencyRecord{Fingerprint: fingerprint, Status: ww.Status(), Header: map[string]string{}, Body: buf.Bytes()}
+			for _, name := range replayedHeaders {
+				if value := ww.Header().Get(name); value != "" {
+					record.Header[name] = value
+				}
+			}
+			data, err := json.Marshal(record)
+			if err == nil {
+				err = rdb.Set(context.WithoutCancel(ctx), redisKey, data, ttl).Err()
+			}
+			if err != nil {
+				logger.Error("Failed to store idempotent response", "error", err)
+			}
+		})
+	}
+}
+
+// acquireIdempotencyKey claims redisKey for a new request. When the key is
+// already taken it returns the stored record instead.
+func acquireIdempotencyKey(ctx context.Context, rdb *storage.RedisClient, redisKey, fingerprint string) (*idempotencyRecord, bool, error) {
+	inFlight, err := json.Marshal(idempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, false, err
+	}
+	// The key can expire between SETNX and GET, so try twice.
+	for range 2 {
+		acquired, err := rdb.SetNX(ctx, redisKey, inFlight, idempotencyLockTTL).Result()
+		if err != nil || acquired {
+			return nil, acquired, err
+		}
+		data, err := rdb.Get(ctx, redisKey).Bytes()
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		var stored idempotencyRecord
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, false, err
+		}
+		return &stored, false, nil
+	}
+	return nil, false, errors.New("idempotency key changed concurrently")
+}
+
+// requestFingerprint identifies the method, path and body of a request.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method+" "+r.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replayResponse(w http.ResponseWriter, record *idempotencyRecord) {
+	for name, value := range record.Header {
+		w.Header().Set(name, value)
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(record.Status)
+	_, _ = w.Write(record.Body)
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+func newIdempotentHandler(t *testing.T, handler http.HandlerFunc) http.Handler {
+	t.Helper()
+	rdb := storagetest.NewRedisClient(t)
+	return Idempotency(rdb, time.Minute, 64)(handler)
+}
+
+func postWithKey(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	return req.WithContext(context.WithValue(req.Context(), principalCtxKey{}, "admin"))
+}
+
+func TestIdempotency(t *testing.T) {
+	t.Run("should replay the stored response for a matching retry", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		handler := newIdempotentHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"id":1}`))
+		})
+
+		// Act
+		first := httptest.NewRecorder()
+		handler.ServeHTTP(first, postWithKey("key-1", `{"name":"A"}`))
+		retry := httptest.NewRecorder()
+		handler.ServeHTTP(retry, postWithKey("key-1", `{"name":"A"}`))
+
+		// Assert
+		assert.Equal(t, int32(1), calls.Load())
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, `{"id":1}`, retry.Body.String())
+		assert.Equal(t, "application/json", retry.Header().Get("Content-Type"))
+		assert.Equal(t, "true", retry.Header().Get(IdempotentReplayedHeader))
+		assert.Empty(t, first.Header().Get(IdempotentReplayedHeader))
+	})
+
+	t.Run("should reject bodies over the limit without claiming the key", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		handler := newIdempotentHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusCreated)
+		})
+
+		// Act
+		tooLarge := httptest.NewRecorder()
+		handler.ServeHTTP(tooLarge, postWithKey("key-1", `{"name":"`+strings.Repeat("A", 64)+`"}`))
+		retry := httptest.NewRecorder()
+		handler.ServeHTTP(retry, postWithKey("key-1", `{"name":"A"}`))
+
+		// Assert
+		assert.Equal(t, http.StatusRequestEntityTooLarge, tooLarge.Code)
+		assert.Equal(t, http.StatusCreated, retry.Code)
+		assert.Equal(t, int32(1), calls.Load())
+	})
+
+	t.Run("should reject a reused key with a different body", func(t *testing.T) {
+		// Arrange
+		handler := newIdempotentHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), postWithKey("key-1", `{"name":"A"}`))
+
+		// Act
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, postWithKey("key-1", `{"name":"B"}`))
+
+		// Assert
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
+	t.Run("should reject a duplicate while the first request is in flight", func(t *testing.T) {
+		// Arrange
+		started, release := make(chan struct{}), make(chan struct{})
+		handler := newIdempotentHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			handler.ServeHTTP(httptest.NewRecorder(), postWithKey("key-1", `{"name":"A"}`))
+		}()
+		<-started
+
+		// Act
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, postWithKey("key-1", `{"name":"A"}`))
+		close(release)
+		<-done
+
+		// Assert
+		assert.Equal(t, http.StatusConflict, rec.Code)
+	})
+
+	t.Run("should let retries through after a server error", func(t *testing.T) {
+		// Arrange
+		var calls atomic.Int32
+		handler := newIdempotentHandler(t, func(w http.ResponseWriter, r *http.Request) {
+			if calls.Add(1) == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), postWithKey("key-1", `{"name":"A"}`))
+
+		// Act
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, postWithKey("key-1", `{"name":"A"}`))
+
+		// Assert
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Equal(t, int32(2), calls.Load())
+	})
+}
@@ -1,28 +1,147 @@
 package middleware
 
 import (
+	"fmt"
 	"http-server/utils"
+	"io"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func LoggerMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-		t0 := time.Now()
-
-		defer func() {
-			utils.Logger.Info("Request",
-				"method", r.Method,
-				"path", r.URL.Path,
-				"status", writer.Status(),
-				"latency", time.Since(t0),
+// Access log formats supported by LoggerMiddleware.
+const (
+	AccessLogJSON     = "json"
+	AccessLogCombined = "combined"
+)
+
+const redactedQueryValue = "REDACTED"
+
+// LoggerMiddleware puts a request-scoped logger on the context and writes an
+// access log line once the request completes. format selects between the
+// structured JSON log (default) and the Apache/NCSA combined log format.
+func LoggerMiddleware(format string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			body := &countingReader{ReadCloser: r.Body}
+			if r.Body != nil && r.Body != http.NoBody {
+				r.Body = body
+			}
+			t0 := time.Now()
+
+			logger := utils.Logger.With(
 				"request_id", middleware.GetReqID(r.Context()),
+				"client_ip", clientIP(r),
 			)
-		}()
+			if traceID := traceIDFromRequest(r); traceID != "" {
+				logger = logger.With("trace_id", traceID)
+			}
+			r = r.WithContext(utils.ContextWithLogger(r.Context(), logger))
+
+			defer func() {
+				logger := utils.LoggerFromContext(r.Context())
+				if format == AccessLogCombined {
+					logger.Info("Request", utils.LogLineKey, combinedLogLine(r, writer, t0))
+					return
+				}
+				logger.Info("Request",
+					"method", r.Method,
+					"path", r.URL.Path,
+					"protocol", r.Proto,
+					"status", writer.Status(),
+					"latency", time.Since(t0),
+					"bytes_in", body.n,
+					"bytes_out", writer.BytesWritten(),
+					"user_agent", r.UserAgent(),
+					"referer", redactQuery(r.Referer()),
+				)
+			}()
+
+			next.ServeHTTP(writer, r)
+		})
+	}
+}
+
+// combinedLogLine formats a single access log line in the Apache/NCSA
+// combined log format. Query string values are redacted, since they may
+// carry tokens or personal data.
+func combinedLogLine(r *http.Request, ww middleware.WrapResponseWriter, t0 time.Time) string {
+	user := "-"
+	if u, _, ok := r.BasicAuth(); ok && u != "" {
+		user = u
+	}
+	size := "-"
+	if n := ww.BytesWritten(); n > 0 {
+		size = fmt.Sprint(n)
+	}
+	return fmt.Sprintf("%s - %s [%s] \"%s %s %s\" %d %s %q %q",
+		clientIP(r),
+		user,
+		t0.Format("02/Jan/2006:15:04:05 -0700"),
+		r.Method,
+		redactQuery(r.URL.RequestURI()),
+		r.Proto,
+		ww.Status(),
+		size,
+		orDash(redactQuery(r.Referer())),
+		orDash(r.UserAgent()),
+	)
+}
+
+// redactQuery replaces the values in the query string of rawURL, keeping
+// the parameter names.
+func redactQuery(rawURL string) string {
+	base, query, ok := strings.Cut(rawURL, "?")
+	if !ok || query == "" {
+		return rawURL
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		if name, _, ok := strings.Cut(param, "="); ok {
+			params[i] = name + "=" + redactedQueryValue
+		}
+	}
+	return base + "?" + strings.Join(params, "&")
+}
+
+// clientIP returns the IP address of the remote end of the connection.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return ip
+}
+
+// traceIDFromRequest extracts the trace ID from a W3C traceparent header
+// ("version-traceid-parentid-flags"), if present.
+func traceIDFromRequest(r *http.Request) string {
+	parts := strings.Split(r.Header.Get("traceparent"), "-")
+	if len(parts) != 4 || len(parts[1]) != 32 {
+		return ""
+	}
+	return parts[1]
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// countingReader counts the bytes read from a request body.
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
 
-		next.ServeHTTP(writer, r)
-	})
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
 }
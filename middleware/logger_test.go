@@ -0,0 +1,109 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"http-server/config"
+	"http-server/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveLogged serves req through LoggerMiddleware with the given access log
+// format, logging to a file sink, and returns what was logged.
+func serveLogged(t *testing.T, format string, req *http.Request) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "access.log")
+	require.NoError(t, utils.InitLogger("debug", &config.LogConfig{
+		Sinks: []config.LogSinkConfig{{Type: utils.LogSinkFile, Path: path}},
+	}))
+	t.Cleanup(func() { require.NoError(t, utils.InitLogger("debug", nil)) })
+
+	handler := LoggerMiddleware(format)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.NoError(t, utils.CloseLogger())
+	out, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(out)
+}
+
+func TestLoggerMiddleware(t *testing.T) {
+	t.Run("should log a structured access record", func(t *testing.T) {
+		// Arrange
+		req := httptest.NewRequest(http.MethodPost, "/users?token=secret", strings.NewReader("{}"))
+		req.Header.Set("Referer", "https://example.com/login?next=/home")
+
+		// Act
+		out := serveLogged(t, AccessLogJSON, req)
+
+		// Assert
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal([]byte(out), &entry))
+		assert.Equal(t, "Request", entry["msg"])
+		assert.Equal(t, "/users", entry["path"])
+		assert.Equal(t, float64(http.StatusCreated), entry["status"])
+		assert.Equal(t, float64(2), entry["bytes_in"])
+		assert.Equal(t, float64(5), entry["bytes_out"])
+		assert.Equal(t, "https://example.com/login?next=REDACTED", entry["referer"])
+	})
+
+	t.Run("should write combined lines through the sinks with query values redacted", func(t *testing.T) {
+		// Arrange
+		req := httptest.NewRequest(http.MethodGet, "/users?search=alice&page=2&flag", nil)
+		req.SetBasicAuth("admin", "password")
+		req.Header.Set("User-Agent", "curl/8.0")
+
+		// Act
+		out := serveLogged(t, AccessLogCombined, req)
+
+		// Assert
+		assert.Regexp(t, `^192\.0\.2\.1 - admin \[[^\]]+\] "GET /users\?search=REDACTED&page=REDACTED&flag HTTP/1\.1" 201 5 "-" "curl/8\.0"\n$`, out)
+	})
+
+	t.Run("should redact patterns in combined lines", func(t *testing.T) {
+		// Arrange
+		req := httptest.NewRequest(http.MethodGet, "/users/alice@example.com", nil)
+
+		// Act
+		out := serveLogged(t, AccessLogCombined, req)
+
+		// Assert
+		assert.Contains(t, out, `"GET /users/[REDACTED] HTTP/1.1"`)
+		assert.NotContains(t, out, "alice@example.com")
+	})
+
+	t.Run("should sample combined lines like other records", func(t *testing.T) {
+		// Arrange
+		path := filepath.Join(t.TempDir(), "access.log")
+		require.NoError(t, utils.InitLogger("debug", &config.LogConfig{
+			Sinks:    []config.LogSinkConfig{{Type: utils.LogSinkFile, Path: path}},
+			Sampling: config.LogSamplingConfig{Enabled: true, First: 1},
+		}))
+		t.Cleanup(func() { require.NoError(t, utils.InitLogger("debug", nil)) })
+		handler := LoggerMiddleware(AccessLogCombined)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+		// Act
+		for range 3 {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+		}
+		require.NoError(t, utils.CloseLogger())
+
+		// Assert
+		out, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, 1, strings.Count(string(out), "\n"))
+	})
+}
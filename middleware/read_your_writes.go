@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"http-server/storage"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ReadYourWritesCookie and ReadYourWritesHeader carry the time, in Unix
+// milliseconds, until which a client's reads are pinned to the primary.
+// Clients that do not keep cookies can echo the response header back instead.
+const (
+	ReadYourWritesCookie = "read_your_writes_until"
+	ReadYourWritesHeader = "X-Read-Your-Writes-Until"
+)
+
+// ReadYourWrites pins a client's reads to the primary database for window
+// after it sends a write request, so it does not observe stale replica data.
+// A zero window disables pinning. Requests to the exempt paths are never
+// taken for writes, so that their handlers, which may serve reads over
+// POST, pin with PinReads when they write.
+func ReadYourWrites(window time.Duration, exempt ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if window <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			now := time.Now()
+
+			if isWrite(r.Method) && !slices.Contains(exempt, strings.TrimSuffix(r.URL.Path, "/")) {
+				PinReads(w, window)
+				r = r.WithContext(storage.WithPrimary(r.Context()))
+			} else if until := pinnedUntil(r); until.After(now) && !until.After(now.Add(window)) {
+				// Pins further out than a write could have set are forged
+				r = r.WithContext(storage.WithPrimary(r.Context()))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// PinReads hands the client a pin of its reads to the primary for window,
+// in the cookie and the header. It must be called before the response is
+// written. A zero window does nothing.
+func PinReads(w http.ResponseWriter, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	until := time.Now().Add(window)
+	value := strconv.FormatInt(until.UnixMilli(), 10)
+	http.SetCookie(w, &http.Cookie{
+		Name:     ReadYourWritesCookie,
+		Value:    value,
+		Path:     "/",
+		Expires:  until,
+		MaxAge:   int(window.Seconds()) + 1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set(ReadYourWritesHeader, value)
+}
+
+// pinnedUntil returns the pin expiry sent by the client, or the zero time.
+func pinnedUntil(r *http.Request) time.Time {
+	value := r.Header.Get(ReadYourWritesHeader)
+	if cookie, err := r.Cookie(ReadYourWritesCookie); err == nil {
+		value = cookie.Value
+	}
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"http-server/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// servePinned serves req through ReadYourWrites and reports whether the
+// handler saw its reads pinned to the primary.
+func servePinned(window time.Duration, req *http.Request) (*httptest.ResponseRecorder, bool) {
+	var pinned bool
+	handler := ReadYourWrites(window)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pinned = storage.UsesPrimary(r.Context())
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec, pinned
+}
+
+func TestReadYourWrites(t *testing.T) {
+	t.Run("should pin writes and hand out the pin expiry", func(t *testing.T) {
+		// Act
+		rec, pinned := servePinned(time.Minute, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+		// Assert
+		assert.True(t, pinned)
+		cookies := rec.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, ReadYourWritesCookie, cookies[0].Name)
+		assert.Equal(t, rec.Header().Get(ReadYourWritesHeader), cookies[0].Value)
+		ms, err := strconv.ParseInt(cookies[0].Value, 10, 64)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), time.UnixMilli(ms), 5*time.Second)
+	})
+
+	t.Run("should pin reads carrying the cookie of a recent write", func(t *testing.T) {
+		// Arrange
+		write, _ := servePinned(time.Minute, httptest.NewRequest(http.MethodPut, "/users/1", nil))
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.AddCookie(write.Result().Cookies()[0])
+
+		// Act
+		rec, pinned := servePinned(time.Minute, req)
+
+		// Assert
+		assert.True(t, pinned)
+		assert.Empty(t, rec.Result().Cookies())
+	})
+
+	t.Run("should pin reads echoing the header of a recent write", func(t *testing.T) {
+		// Arrange
+		write, _ := servePinned(time.Minute, httptest.NewRequest(http.MethodDelete, "/users/1", nil))
+		req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		req.Header.Set(ReadYourWritesHeader, write.Header().Get(ReadYourWritesHeader))
+
+		// Act
+		_, pinned := servePinned(time.Minute, req)
+
+		// Assert
+		assert.True(t, pinned)
+	})
+
+	t.Run("should not pin reads without a pin or with an expired, malformed or far-future one", func(t *testing.T) {
+		// Arrange
+		expired := httptest.NewRequest(http.MethodGet, "/users", nil)
+		expired.Header.Set(ReadYourWritesHeader, strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10))
+		malformed := httptest.NewRequest(http.MethodGet, "/users", nil)
+		malformed.AddCookie(&http.Cookie{Name: ReadYourWritesCookie, Value: "soon"})
+		farFuture := httptest.NewRequest(http.MethodGet, "/users", nil)
+		farFuture.Header.Set(ReadYourWritesHeader, "9999999999999")
+
+		// Act
+		_, plainPinned := servePinned(time.Minute, httptest.NewRequest(http.MethodGet, "/users", nil))
+		_, expiredPinned := servePinned(time.Minute, expired)
+		_, malformedPinned := servePinned(time.Minute, malformed)
+		_, farFuturePinned := servePinned(time.Minute, farFuture)
+
+		// Assert
+		assert.False(t, plainPinned)
+		assert.False(t, expiredPinned)
+		assert.False(t, malformedPinned)
+		assert.False(t, farFuturePinned)
+	})
+
+	t.Run("should leave the writes of exempt paths to their handler", func(t *testing.T) {
+		// Arrange
+		var pinned bool
+		handler := ReadYourWrites(time.Minute, "/graphql")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pinned = storage.UsesPrimary(r.Context())
+		}))
+		rec := httptest.NewRecorder()
+
+		// Act
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/graphql/", nil))
+
+		// Assert
+		assert.False(t, pinned)
+		assert.Empty(t, rec.Result().Cookies())
+	})
+
+	t.Run("should not pin anything with a zero window", func(t *testing.T) {
+		// Act
+		rec, pinned := servePinned(0, httptest.NewRequest(http.MethodPost, "/users", nil))
+
+		// Assert
+		assert.False(t, pinned)
+		assert.Empty(t, rec.Header().Get(ReadYourWritesHeader))
+	})
+}
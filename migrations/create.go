@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var nonIdentRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Create writes an empty up/down migration pair named name into the
+// directory of every dialect under dir and returns the paths of the new
+// files. Versions are sequential (one above the highest existing version of
+// any dialect, zero-padded to six digits) unless timestamp is set, in which
+// case the current UTC time is used.
+func Create(dir, name string, timestamp bool) (files []string, err error) {
+	name = strings.Trim(nonIdentRe.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return nil, errors.New("migration name must contain letters or digits")
+	}
+
+	var version string
+	if timestamp {
+		version = time.Now().UTC().Format("20060102150405")
+	} else {
+		next := int64(1)
+		for _, dialect := range Dialects {
+			existing, err := Load(dialect, dir)
+			if err != nil {
+				return nil, err
+			}
+			if len(existing) > 0 {
+				next = max(next, existing[len(existing)-1].Version+1)
+			}
+		}
+		version = fmt.Sprintf("%06d", next)
+	}
+
+	for _, dialect := range Dialects {
+		if err := os.MkdirAll(filepath.Join(dir, dialect), 0o755); err != nil {
+			return nil, err
+		}
+		base := filepath.Join(dir, dialect, version+"_"+name)
+		for _, f := range []struct{ path, content string }{
+			{base + ".up.sql", "-- Write the migration here.\n"},
+			{base + ".down.sql", "-- Write the statements reverting the up migration here.\n"},
+		} {
+			file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+			if err != nil {
+				return nil, err
+			}
+			_, err = file.WriteString(f.content)
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, f.path)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,51 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Executor is implemented by both *sql.DB and *sql.Tx, so migration
+// functions run the same way inside and outside a transaction.
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// MigrationFunc applies or rolls back a migration written in Go.
+type MigrationFunc func(ctx context.Context, db Executor) error
+
+// GoMigration is a migration written in Go, for changes such as data
+// backfills that are awkward to express in SQL.
+type GoMigration struct {
+	Up   MigrationFunc
+	Down MigrationFunc
+	// NoTransaction runs Up and Down directly on the database instead of
+	// inside a transaction.
+	NoTransaction bool
+}
+
+type registeredGoMigration struct {
+	name string
+	GoMigration
+}
+
+var goMigrations = make(map[int64]registeredGoMigration)
+
+// Register adds a Go migration with the given version and name. Versions
+// share the numbering of the SQL files, and a version used by both is
+// reported as a duplicate when migrations are loaded. Go migrations run for
+// every dialect, so their SQL has to be portable. Register is meant to
+// be called from init functions and panics if version is registered twice
+// or Up is nil.
+func Register(version int64, name string, m GoMigration) {
+	if m.Up == nil {
+		panic(fmt.Sprintf("migrations: Go migration %d has no Up function", version))
+	}
+	if _, dup := goMigrations[version]; dup {
+		panic(fmt.Sprintf("migrations: Go migration %d registered twice", version))
+	}
+	goMigrations[version] = registeredGoMigration{name: name, GoMigration: m}
+}
@@ -0,0 +1,76 @@
+package migrations
+
+import (
+	"regexp"
+	"strings"
+)
+
+// LintIssue is a risky statement found in a migration.
+type LintIssue struct {
+	Version int64
+	Source  string
+	Rule    string
+	Message string
+}
+
+var (
+	addColumnRe   = regexp.MustCompile(`(?is)\bADD\s+(?:COLUMN\s+)?(?:IF\s+NOT\s+EXISTS\s+)?("?\w+"?)\s+([^,;]*)`)
+	createIndexRe = regexp.MustCompile(`(?is)\bCREATE\s+(?:UNIQUE\s+)?INDEX\s+(CONCURRENTLY\s+)?(?:IF\s+NOT\s+EXISTS\s+)?(?:"?\w+"?\s+)?ON\s+(?:ONLY\s+)?("?[\w.]+"?)`)
+	createTableRe = regexp.MustCompile(`(?is)\bCREATE\s+TABLE\s+(?:IF\s+NOT\s+EXISTS\s+)?("?[\w.]+"?)`)
+	dropRe        = regexp.MustCompile(`(?is)\bDROP\s+(TABLE|COLUMN|INDEX|VIEW|TYPE|SCHEMA)\b`)
+	notNullRe     = regexp.MustCompile(`(?i)\bNOT\s+NULL\b`)
+	defaultRe     = regexp.MustCompile(`(?i)\bDEFAULT\b`)
+)
+
+// Lint flags risky statements in the SQL of migs: NOT NULL columns added
+// without a default, indexes built without CONCURRENTLY on existing tables,
+// CONCURRENTLY inside a transaction, and drops that cannot be rolled back
+// because the down file is missing, empty or only holds comments. Go
+// migrations are not inspected.
+func Lint(migs []Migration) []LintIssue {
+	var issues []LintIssue
+	for _, mig := range migs {
+		if mig.Up == nil || mig.Up.SQL == "" {
+			continue
+		}
+		report := func(rule, message string) {
+			issues = append(issues, LintIssue{Version: mig.Version, Source: mig.Up.Source, Rule: rule, Message: message})
+		}
+
+		stmts := splitStatements(mig.Up.SQL)
+		created := make(map[string]bool)
+		for _, stmt := range stmts {
+			for _, m := range createTableRe.FindAllStringSubmatch(stmt, -1) {
+				created[normalizeIdent(m[1])] = true
+			}
+		}
+
+		for _, stmt := range stmts {
+			for _, m := range addColumnRe.FindAllStringSubmatch(stmt, -1) {
+				if strings.EqualFold(m[1], "CONSTRAINT") {
+					continue
+				}
+				if notNullRe.MatchString(m[2]) && !defaultRe.MatchString(m[2]) {
+					report("not-null-without-default", "column "+m[1]+" is added as NOT NULL without a DEFAULT; this fails on tables with rows")
+				}
+			}
+			for _, m := range createIndexRe.FindAllStringSubmatch(stmt, -1) {
+				table := normalizeIdent(m[2])
+				switch {
+				case m[1] == "" && !created[table]:
+					report("index-not-concurrent", "index on "+table+" is created without CONCURRENTLY and locks the table against writes while it builds")
+				case m[1] != "" && !mig.Up.NoTransaction:
+					report("concurrent-index-in-transaction", "CREATE INDEX CONCURRENTLY cannot run in a transaction; add \""+noTransactionDirective+"\"")
+				}
+			}
+			if m := dropRe.FindStringSubmatch(stmt); m != nil && (mig.Down == nil || !hasCode(mig.Down.SQL)) {
+				report("drop-without-down", "DROP "+strings.ToUpper(m[1])+" has no down migration to restore it")
+			}
+		}
+	}
+	return issues
+}
+
+func normalizeIdent(ident string) string {
+	return strings.ToLower(strings.Trim(ident, `"`))
+}
@@ -0,0 +1,81 @@
+package migrations
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLint(t *testing.T) {
+	lintFiles := func(t *testing.T, fsys fstest.MapFS) []string {
+		t.Helper()
+		migs, err := loadMigrations(fsys)
+		require.NoError(t, err)
+		var rules []string
+		for _, issue := range Lint(migs) {
+			rules = append(rules, issue.Rule)
+		}
+		return rules
+	}
+
+	t.Run("should flag risky statements", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{
+			"000002_risky.up.sql": {Data: []byte(`
+ALTER TABLE users ADD COLUMN age INT NOT NULL;
+CREATE INDEX idx_users_age ON users (age);
+CREATE INDEX CONCURRENTLY idx_users_name ON users (name);
+DROP TABLE legacy_users;
+`)},
+		}
+
+		// Act
+		rules := lintFiles(t, fsys)
+
+		// Assert
+		assert.Equal(t, []string{
+			"not-null-without-default",
+			"index-not-concurrent",
+			"concurrent-index-in-transaction",
+			"drop-without-down",
+		}, rules)
+	})
+
+	t.Run("should flag drops whose down file is empty or only holds comments", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{
+			"000002_drop_legacy.up.sql":     {Data: []byte("DROP TABLE legacy_users;")},
+			"000002_drop_legacy.down.sql":   {Data: []byte("")},
+			"000003_drop_nickname.up.sql":   {Data: []byte("ALTER TABLE users DROP COLUMN nickname;")},
+			"000003_drop_nickname.down.sql": {Data: []byte("-- irreversible\n")},
+		}
+
+		// Act
+		rules := lintFiles(t, fsys)
+
+		// Assert
+		assert.Equal(t, []string{"drop-without-down", "drop-without-down"}, rules)
+	})
+
+	t.Run("should accept safe statements", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{
+			"000002_safe.up.sql": {Data: []byte(`-- +migrate notransaction
+ALTER TABLE users ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+CREATE TABLE notes (id SERIAL PRIMARY KEY, user_id INT NOT NULL);
+CREATE INDEX idx_notes_user_id ON notes (user_id);
+CREATE INDEX CONCURRENTLY idx_users_name ON users (name);
+ALTER TABLE users DROP COLUMN nickname;
+`)},
+			"000002_safe.down.sql": {Data: []byte("ALTER TABLE users ADD COLUMN nickname TEXT;")},
+		}
+
+		// Act
+		rules := lintFiles(t, fsys)
+
+		// Assert
+		assert.Empty(t, rules)
+	})
+}
@@ -0,0 +1,72 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// migrationLockID is the key of the session-level advisory lock serialising
+// migration runs across processes.
+const migrationLockID int64 = 0x6d69677261746521 // "migrate!"
+
+const lockPollInterval = 500 * time.Millisecond
+
+// withLock runs fn while holding the migration advisory lock, waiting up to
+// the configured lock timeout for concurrent runs to finish. The
+// schema_migrations table is created under the lock before fn runs, except
+// in dry-run mode, which leaves the database untouched.
+//
+// SQLite has no advisory locks; it is meant for single-node deployments,
+// where its own file locking is enough.
+func (m *Migrator) withLock(fn func() error) error {
+	if m.dialect == DialectSQLite {
+		if err := m.ensureSchemaMigrationsTable(); err != nil {
+			return err
+		}
+		return fn()
+	}
+
+	ctx := context.Background()
+	if m.lockTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, m.lockTimeout)
+		defer cancel()
+	}
+
+	// Advisory locks belong to a session, so acquire and release the lock on
+	// one dedicated connection.
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Close()
+
+	for {
+		var locked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationLockID).Scan(&locked); err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+		if locked {
+			break
+		}
+		log.Println("Waiting for a concurrent migration run to finish...")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timed out waiting for migration lock after %s", m.lockTimeout)
+		case <-time.After(lockPollInterval):
+		}
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID); err != nil {
+			log.Printf("Failed to release migration lock: %v", err)
+		}
+	}()
+
+	if err := m.ensureSchemaMigrationsTable(); err != nil {
+		return err
+	}
+
+	return fn()
+}
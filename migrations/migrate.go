@@ -1,106 +1,585 @@
 package migrations
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
-	"os"
-	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
+	"time"
 
 	"http-server/config"
 
 	_ "github.com/jackc/pgx/v4/stdlib" // PostgreSQL driver
+	_ "modernc.org/sqlite"             // SQLite driver
 )
 
+// Migration is a single versioned schema change.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      *Step
+	// Down is nil when the migration cannot be rolled back.
+	Down *Step
+	// Checksum is the hex-encoded SHA-256 of the up file.
+	Checksum string
+}
+
+// Step is one direction of a migration: a SQL file or a Go function.
+type Step struct {
+	// Source is the file name, or a description of a Go migration.
+	Source string
+	// SQL is the content of the file, empty for Go migrations.
+	SQL string
+	// NoTransaction runs the step outside of a transaction.
+	NoTransaction bool
+
+	run MigrationFunc
+}
+
+// MigrationStatus describes whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Dirty     bool
+	// Modified is set when the up file changed after it was applied.
+	Modified bool
+	// Missing is set for versions recorded in schema_migrations that have
+	// no migration file.
+	Missing bool
+}
+
+type appliedMigration struct {
+	appliedAt time.Time
+	dirty     bool
+	checksum  string
+}
+
+// Checksum modes controlling what happens when an applied migration file
+// has been edited since it was applied.
+const (
+	ChecksumFail   = "fail"
+	ChecksumWarn   = "warn"
+	ChecksumIgnore = "ignore"
+)
+
+// Migrator applies and rolls back migrations, tracking them in the
+// schema_migrations table.
+type Migrator struct {
+	db           *sql.DB
+	dialect      string
+	migrations   []Migration
+	lockTimeout  time.Duration
+	checksumMode string
+	dryRun       io.Writer
+}
+
+// New connects to the database and loads the migrations of its dialect.
+func New(cfg *config.DatabaseConfig) (*Migrator, error) {
+	dialect := DialectOf(cfg)
+	migrations, err := Load(dialect, cfg.Migrations.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load migrations: %w", err)
+	}
+
+	var db *sql.DB
+	switch dialect {
+	case DialectSQLite:
+		db, err = sql.Open("sqlite", cfg.SQLiteDSN())
+	default:
+		db, err = sql.Open("pgx", cfg.ConnString())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	checksumMode := cfg.Migrations.ChecksumMode
+	if checksumMode == "" {
+		checksumMode = ChecksumFail
+	}
+
+	return &Migrator{
+		db:           db,
+		dialect:      dialect,
+		migrations:   migrations,
+		lockTimeout:  cfg.Migrations.LockTimeout,
+		checksumMode: checksumMode,
+	}, nil
+}
+
+// SetDryRun makes the migrator print the SQL it would run to out, in order,
+// instead of executing it. Dry runs do not write to the database at all:
+// the schema_migrations table is neither created nor updated. A nil out
+// turns dry-run mode off.
+func (m *Migrator) SetDryRun(out io.Writer) {
+	m.dryRun = out
+}
+
+// Load returns the migrations of dialect found in dir, or the embedded ones
+// when dir is empty, without connecting to a database.
+func Load(dialect, dir string) ([]Migration, error) {
+	fsys, err := Source(dialect, dir)
+	if err != nil {
+		return nil, err
+	}
+	return loadMigrations(fsys)
+}
+
+// Dialect returns the migration dialect of the database.
+func (m *Migrator) Dialect() string {
+	return m.dialect
+}
+
+// Pending returns the migrations that have not been applied yet.
+func (m *Migrator) Pending() (pending []Migration, err error) {
+	err = m.withLock(func() error {
+		applied, err := m.loadApplied()
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok {
+				pending = append(pending, mig)
+			}
+		}
+		return nil
+	})
+	return pending, err
+}
+
+// Close closes the database connection.
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
 // Run applies all pending database migrations.
 func Run(cfg *config.DatabaseConfig) error {
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	db, err := sql.Open("pgx", connStr)
+	m, err := New(cfg)
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return err
 	}
-	defer db.Close()
+	defer m.Close()
 
-	if err := ensureSchemaMigrationsTable(db); err != nil {
-		return fmt.Errorf("failed to ensure schema_migrations table: %w", err)
-	}
+	return m.Up(0)
+}
+
+// Up applies the next n pending migrations, or all of them if n <= 0.
+func (m *Migrator) Up(n int) error {
+	return m.withLock(func() error { return m.up(n) })
+}
 
-	appliedVersions, err := getAppliedVersions(db)
+// Down rolls back the last n applied migrations, or all of them if n <= 0.
+func (m *Migrator) Down(n int) error {
+	return m.withLock(func() error { return m.down(n) })
+}
+
+// Goto migrates up or down so that exactly the migrations up to and
+// including version are applied. A version of 0 rolls back everything.
+func (m *Migrator) Goto(version int64) error {
+	return m.withLock(func() error { return m.goTo(version) })
+}
+
+// Redo rolls back the last applied migration and applies it again.
+func (m *Migrator) Redo() error {
+	return m.withLock(m.redo)
+}
+
+// Force records version as the latest cleanly applied migration without
+// running any SQL, clearing the dirty flag. It is used to recover after a
+// failed migration has been fixed by hand.
+func (m *Migrator) Force(version int64) error {
+	return m.withLock(func() error { return m.force(version) })
+}
+
+func (m *Migrator) up(n int) error {
+	applied, err := m.appliedMigrations()
 	if err != nil {
-		return fmt.Errorf("failed to get applied versions: %w", err)
+		return err
 	}
 
-	files, err := filepath.Glob("migrations/*.up.sql")
+	count := 0
+	for _, mig := range m.migrations {
+		if n > 0 && count >= n {
+			break
+		}
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		if err := m.applyUp(mig); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count == 0 {
+		log.Println("No pending migrations")
+	}
+	return nil
+}
+
+func (m *Migrator) down(n int) error {
+	applied, err := m.appliedMigrations()
 	if err != nil {
-		return fmt.Errorf("failed to find migration files: %w", err)
+		return err
 	}
-	sort.Strings(files)
 
-	for _, file := range files {
-		version, err := getVersionFromFile(file)
-		if err != nil {
-			log.Printf("Skipping file with invalid version format: %s", file)
+	count := 0
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		if n > 0 && count >= n {
+			break
+		}
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
 			continue
 		}
+		if err := m.applyDown(mig); err != nil {
+			return err
+		}
+		count++
+	}
+
+	if count == 0 {
+		log.Println("No migrations to roll back")
+	}
+	return nil
+}
 
-		if !appliedVersions[version] {
-			log.Printf("Applying migration %s...", file)
-			if err := applyMigration(db, file, version); err != nil {
-				return fmt.Errorf("failed to apply migration %s: %w", file, err)
+func (m *Migrator) goTo(version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; ok && mig.Version > version {
+			if err := m.applyDown(mig); err != nil {
+				return err
+			}
+		}
+	}
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+			if err := m.applyUp(mig); err != nil {
+				return err
 			}
-			log.Printf("Successfully applied migration %s", file)
 		}
 	}
-
 	return nil
 }
 
-func ensureSchemaMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS schema_migrations (
-			version BIGINT PRIMARY KEY
-		)
-	`)
+func (m *Migrator) redo() error {
+	applied, err := m.appliedMigrations()
+	if err != nil {
+		return err
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; ok {
+			if err := m.applyDown(mig); err != nil {
+				return err
+			}
+			return m.applyUp(mig)
+		}
+	}
+	return errors.New("no applied migration to redo")
+}
+
+func (m *Migrator) force(version int64) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+	if m.dryRun != nil {
+		return m.printForce(version)
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.Exec("DELETE FROM schema_migrations WHERE version > $1", version); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE schema_migrations SET dirty = FALSE"); err != nil {
+		return err
+	}
+	if version != 0 {
+		if _, err := tx.Exec("INSERT INTO schema_migrations (version, checksum) VALUES ($1, $2) ON CONFLICT (version) DO NOTHING", version, m.find(version).Checksum); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// printForce writes the statements force would run for dry-run mode.
+func (m *Migrator) printForce(version int64) error {
+	stmts := fmt.Sprintf("-- Force version %d\nDELETE FROM schema_migrations WHERE version > %d;\nUPDATE schema_migrations SET dirty = FALSE;\n", version, version)
+	if version != 0 {
+		stmts += fmt.Sprintf("INSERT INTO schema_migrations (version, checksum) VALUES (%d, '%s') ON CONFLICT (version) DO NOTHING;\n", version, m.find(version).Checksum)
+	}
+	_, err := io.WriteString(m.dryRun, stmts)
 	return err
 }
 
-func getAppliedVersions(db *sql.DB) (map[int64]bool, error) {
-	rows, err := db.Query("SELECT version FROM schema_migrations")
+// Status lists every known migration and whether it has been applied.
+func (m *Migrator) Status() (statuses []MigrationStatus, err error) {
+	err = m.withLock(func() error {
+		statuses, err = m.status()
+		return err
+	})
+	return statuses, err
+}
+
+func (m *Migrator) status() ([]MigrationStatus, error) {
+	applied, err := m.loadApplied()
 	if err != nil {
 		return nil, err
 	}
+
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := MigrationStatus{Migration: mig}
+		if a, ok := applied[mig.Version]; ok {
+			status.Applied = true
+			status.AppliedAt = a.appliedAt
+			status.Dirty = a.dirty
+			status.Modified = a.checksum != "" && a.checksum != mig.Checksum
+			delete(applied, mig.Version)
+		}
+		statuses = append(statuses, status)
+	}
+	for version, a := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: version},
+			Applied:   true,
+			AppliedAt: a.appliedAt,
+			Dirty:     a.dirty,
+			Missing:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+
+	return statuses, nil
+}
+
+func (m *Migrator) find(version int64) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+	return nil
+}
+
+// appliedMigrations returns the applied migrations, refusing to continue
+// while a migration is marked dirty or, depending on the checksum mode, when
+// an applied migration file has been edited.
+func (m *Migrator) appliedMigrations() (map[int64]appliedMigration, error) {
+	applied, err := m.loadApplied()
+	if err != nil {
+		return nil, err
+	}
+	for version, a := range applied {
+		if a.dirty {
+			return nil, fmt.Errorf("database is dirty at version %d; fix it manually and run `force VERSION`", version)
+		}
+	}
+	if err := m.verifyChecksums(applied); err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// verifyChecksums compares the recorded checksum of every applied migration
+// with its file. Migrations applied before checksums were recorded get their
+// current checksum stored, except in dry-run mode.
+func (m *Migrator) verifyChecksums(applied map[int64]appliedMigration) error {
+	if m.checksumMode == ChecksumIgnore {
+		return nil
+	}
+	for _, mig := range m.migrations {
+		a, ok := applied[mig.Version]
+		if !ok {
+			continue
+		}
+		if a.checksum == "" {
+			if m.dryRun != nil {
+				continue
+			}
+			if _, err := m.db.Exec("UPDATE schema_migrations SET checksum = $1 WHERE version = $2", mig.Checksum, mig.Version); err != nil {
+				return fmt.Errorf("failed to record checksum of migration %d: %w", mig.Version, err)
+			}
+			continue
+		}
+		if a.checksum == mig.Checksum {
+			continue
+		}
+		if m.checksumMode == ChecksumWarn {
+			log.Printf("WARNING: migration %s was modified after it was applied", mig.Up.Source)
+			continue
+		}
+		return fmt.Errorf("migration %s was modified after it was applied (checksum %s, recorded %s); restore the file or set database.migrations.checksum_mode to warn", mig.Up.Source, mig.Checksum, a.checksum)
+	}
+	return nil
+}
+
+func (m *Migrator) loadApplied() (map[int64]appliedMigration, error) {
+	if m.dryRun != nil {
+		exists, err := m.schemaMigrationsExists()
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return map[int64]appliedMigration{}, nil
+		}
+	}
+
+	rows, err := m.db.Query("SELECT version, applied_at, dirty, COALESCE(checksum, '') FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get applied versions: %w", err)
+	}
 	defer rows.Close()
 
-	versions := make(map[int64]bool)
+	applied := make(map[int64]appliedMigration)
 	for rows.Next() {
-		var version int64
-		if err := rows.Scan(&version); err != nil {
+		var (
+			version int64
+			a       appliedMigration
+		)
+		if err := rows.Scan(&version, &a.appliedAt, &a.dirty, &a.checksum); err != nil {
 			return nil, err
 		}
-		versions[version] = true
+		applied[version] = a
 	}
-	return versions, nil
+	return applied, rows.Err()
 }
 
-func getVersionFromFile(file string) (int64, error) {
-	base := filepath.Base(file)
-	parts := strings.Split(base, "_")
-	if len(parts) == 0 {
-		return 0, fmt.Errorf("invalid migration filename format")
+// ensureSchemaMigrationsTable creates the schema_migrations table, or adds
+// the columns missing from older versions of it. Dry runs skip it.
+func (m *Migrator) ensureSchemaMigrationsTable() error {
+	if m.dryRun != nil {
+		return nil
+	}
+
+	query := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY
+		);
+		ALTER TABLE schema_migrations
+			ADD COLUMN IF NOT EXISTS dirty BOOLEAN NOT NULL DEFAULT FALSE,
+			ADD COLUMN IF NOT EXISTS applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			ADD COLUMN IF NOT EXISTS checksum TEXT;
+	`
+	if m.dialect == DialectSQLite {
+		query = `
+			CREATE TABLE IF NOT EXISTS schema_migrations (
+				version BIGINT PRIMARY KEY,
+				dirty BOOLEAN NOT NULL DEFAULT FALSE,
+				applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+				checksum TEXT
+			);
+		`
+	}
+	if _, err := m.db.Exec(query); err != nil {
+		return fmt.Errorf("failed to ensure schema_migrations table: %w", err)
 	}
-	return strconv.ParseInt(parts[0], 10, 64)
+	return nil
 }
 
-func applyMigration(db *sql.DB, file string, version int64) error {
-	content, err := os.ReadFile(file)
-	if err != nil {
+// schemaMigrationsExists reports whether the schema_migrations table has
+// been created, for dry runs, which do not create it.
+func (m *Migrator) schemaMigrationsExists() (bool, error) {
+	query := "SELECT to_regclass('schema_migrations') IS NOT NULL"
+	if m.dialect == DialectSQLite {
+		query = "SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations')"
+	}
+	var exists bool
+	if err := m.db.QueryRow(query).Scan(&exists); err != nil {
+		return false, fmt.Errorf("failed to check for schema_migrations table: %w", err)
+	}
+	return exists, nil
+}
+
+func (m *Migrator) applyUp(mig Migration) error {
+	if m.dryRun != nil {
+		return printStep(m.dryRun, mig, mig.Up, "up")
+	}
+	log.Printf("Applying migration %s...", mig.Up.Source)
+	if err := m.applyStep(mig.Up, func(db Executor) error {
+		_, err := db.ExecContext(context.Background(), "INSERT INTO schema_migrations (version, dirty, checksum) VALUES ($1, TRUE, $2)", mig.Version, mig.Checksum)
+		return err
+	}, func(db Executor) error {
+		_, err := db.ExecContext(context.Background(), "UPDATE schema_migrations SET dirty = FALSE, applied_at = CURRENT_TIMESTAMP WHERE version = $1", mig.Version)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to apply migration %s: %w", mig.Up.Source, err)
+	}
+	log.Printf("Successfully applied migration %s", mig.Up.Source)
+	return nil
+}
+
+func (m *Migrator) applyDown(mig Migration) error {
+	if mig.Down == nil {
+		return fmt.Errorf("migration %d has no down file", mig.Version)
+	}
+	if m.dryRun != nil {
+		return printStep(m.dryRun, mig, mig.Down, "down")
+	}
+	log.Printf("Rolling back migration %s...", mig.Down.Source)
+	if err := m.applyStep(mig.Down, func(db Executor) error {
+		_, err := db.ExecContext(context.Background(), "UPDATE schema_migrations SET dirty = TRUE WHERE version = $1", mig.Version)
+		return err
+	}, func(db Executor) error {
+		_, err := db.ExecContext(context.Background(), "DELETE FROM schema_migrations WHERE version = $1", mig.Version)
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to roll back migration %s: %w", mig.Down.Source, err)
+	}
+	log.Printf("Successfully rolled back migration %s", mig.Down.Source)
+	return nil
+}
+
+// printStep writes the SQL of step for dry-run mode.
+func printStep(out io.Writer, mig Migration, step *Step, direction string) error {
+	body := step.SQL
+	if body == "" {
+		body = "-- Go migration, not shown\n"
+	}
+	_, err := fmt.Fprintf(out, "-- Migration %d %s (%s)\n%s\n", mig.Version, mig.Name, direction, strings.TrimRight(body, "\n")+"\n")
+	return err
+}
+
+// applyStep runs step between the before and after bookkeeping steps, which
+// mark the version dirty and then clean. The dirty mark is committed on its
+// own before the step runs, so a step that fails leaves the version dirty
+// even when its own transaction is rolled back. Transactional steps run
+// together with after in one transaction.
+func (m *Migrator) applyStep(step *Step, before, after func(db Executor) error) (err error) {
+	ctx := context.Background()
+
+	if err := before(m.db); err != nil {
 		return err
 	}
 
-	tx, err := db.Begin()
+	if step.NoTransaction {
+		if err := step.run(ctx, m.db); err != nil {
+			return err
+		}
+		return after(m.db)
+	}
+
+	tx, err := m.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -111,11 +590,11 @@ func applyMigration(db *sql.DB, file string, version int64) error {
 		}
 	}()
 
-	if _, err := tx.Exec(string(content)); err != nil {
+	if err = step.run(ctx, tx); err != nil {
 		return err
 	}
 
-	if _, err := tx.Exec("INSERT INTO schema_migrations (version) VALUES ($1)", version); err != nil {
+	if err = after(tx); err != nil {
 		return err
 	}
 
@@ -0,0 +1,332 @@
+package migrations
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"http-server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMigrations create a notes table, add a title column to it, then create
+// the tags and notes_tags tables.
+var testMigrations = map[string]string{
+	"000001_create_notes.up.sql":        "CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);",
+	"000001_create_notes.down.sql":      "DROP TABLE notes;",
+	"000002_add_notes_title.up.sql":     "ALTER TABLE notes ADD COLUMN title TEXT;",
+	"000002_add_notes_title.down.sql":   "ALTER TABLE notes DROP COLUMN title;",
+	"000003_create_tags.up.sql":         "CREATE TABLE tags (id INTEGER PRIMARY KEY);",
+	"000003_create_tags.down.sql":       "DROP TABLE tags;",
+	"000004_create_notes_tags.up.sql":   "CREATE TABLE notes_tags (note_id INTEGER, tag_id INTEGER);",
+	"000004_create_notes_tags.down.sql": "DROP TABLE notes_tags;",
+}
+
+// newTestMigrator returns a migrator over a temporary SQLite database and
+// the given migration files.
+func newTestMigrator(t *testing.T, files map[string]string) (*Migrator, *config.DatabaseConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	writeMigrationFiles(t, dir, files)
+	cfg := &config.DatabaseConfig{
+		Driver:     DialectSQLite,
+		SQLite:     config.SQLiteConfig{Path: filepath.Join(dir, "test.db")},
+		Migrations: config.MigrationsConfig{Dir: dir},
+	}
+	m, err := New(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = m.Close() })
+	return m, cfg
+}
+
+func writeMigrationFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, DialectSQLite), 0o755))
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, DialectSQLite, name), []byte(content), 0o644))
+	}
+}
+
+// withFiles returns a copy of testMigrations with files added or replaced.
+func withFiles(files map[string]string) map[string]string {
+	merged := make(map[string]string, len(testMigrations)+len(files))
+	for name, content := range testMigrations {
+		merged[name] = content
+	}
+	for name, content := range files {
+		merged[name] = content
+	}
+	return merged
+}
+
+// appliedVersions returns the applied versions in order, failing on dirty
+// ones.
+func appliedVersions(t *testing.T, m *Migrator) []int64 {
+	t.Helper()
+	statuses, err := m.Status()
+	require.NoError(t, err)
+	versions := []int64{}
+	for _, s := range statuses {
+		require.False(t, s.Dirty, "version %d is dirty", s.Version)
+		if s.Applied {
+			versions = append(versions, s.Version)
+		}
+	}
+	return versions
+}
+
+// tables returns the user tables of the database of m.
+func tables(t *testing.T, m *Migrator) []string {
+	t.Helper()
+	rows, err := m.db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name != 'schema_migrations' ORDER BY name")
+	require.NoError(t, err)
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		require.NoError(t, rows.Scan(&name))
+		names = append(names, name)
+	}
+	require.NoError(t, rows.Err())
+	return names
+}
+
+func TestMigrator(t *testing.T) {
+	t.Run("should apply all pending migrations, or the next n", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+
+		// Act
+		require.NoError(t, m.Up(2))
+		partial := appliedVersions(t, m)
+		require.NoError(t, m.Up(0))
+
+		// Assert
+		assert.Equal(t, []int64{1, 2}, partial)
+		assert.Equal(t, []int64{1, 2, 3, 4}, appliedVersions(t, m))
+		assert.Equal(t, []string{"notes", "notes_tags", "tags"}, tables(t, m))
+		pending, err := m.Pending()
+		require.NoError(t, err)
+		assert.Empty(t, pending)
+	})
+
+	t.Run("should roll back the last n migrations, or all of them", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+		require.NoError(t, m.Up(0))
+
+		// Act
+		require.NoError(t, m.Down(2))
+		partial := appliedVersions(t, m)
+		require.NoError(t, m.Down(0))
+
+		// Assert
+		assert.Equal(t, []int64{1, 2}, partial)
+		assert.Empty(t, appliedVersions(t, m))
+		assert.Empty(t, tables(t, m))
+	})
+
+	t.Run("should migrate up or down to a version", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+
+		// Act
+		require.NoError(t, m.Goto(3))
+		up := appliedVersions(t, m)
+		require.NoError(t, m.Goto(1))
+		down := appliedVersions(t, m)
+		err := m.Goto(9)
+
+		// Assert
+		assert.Equal(t, []int64{1, 2, 3}, up)
+		assert.Equal(t, []int64{1}, down)
+		assert.ErrorContains(t, err, "unknown migration version 9")
+	})
+
+	t.Run("should redo the last applied migration", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+		require.NoError(t, m.Up(2))
+		_, err := m.db.Exec("INSERT INTO notes (body, title) VALUES ('a', 'b')")
+		require.NoError(t, err)
+
+		// Act
+		err = m.Redo()
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+		var title *string
+		require.NoError(t, m.db.QueryRow("SELECT title FROM notes").Scan(&title))
+		assert.Nil(t, title)
+	})
+
+	t.Run("should leave a failing migration dirty until forced", func(t *testing.T) {
+		// Arrange
+		m, cfg := newTestMigrator(t, withFiles(map[string]string{
+			"000003_create_tags.up.sql": "CREATE TABLE tags (id INTEGER PRIMARY KEY);\nINSERT INTO missing (id) VALUES (1);",
+		}))
+
+		// Act
+		upErr := m.Up(0)
+		statuses, statusErr := m.Status()
+		retryErr := m.Up(0)
+
+		// Assert
+		require.Error(t, upErr)
+		require.NoError(t, statusErr)
+		require.Len(t, statuses, 4)
+		assert.True(t, statuses[2].Applied)
+		assert.True(t, statuses[2].Dirty)
+		assert.ErrorContains(t, retryErr, "database is dirty at version 3")
+		assert.Equal(t, []string{"notes"}, tables(t, m), "the failed transaction is rolled back")
+
+		// Act: fix the migration, then force the last good version
+		writeMigrationFiles(t, cfg.Migrations.Dir, testMigrations)
+		fixed, err := New(cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = fixed.Close() })
+		require.NoError(t, fixed.Force(2))
+		forced := appliedVersions(t, fixed)
+		require.NoError(t, fixed.Up(0))
+
+		// Assert
+		assert.Equal(t, []int64{1, 2}, forced)
+		assert.Equal(t, []int64{1, 2, 3, 4}, appliedVersions(t, fixed))
+	})
+
+	t.Run("should leave a failing rollback dirty", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, withFiles(map[string]string{
+			"000004_create_notes_tags.down.sql": "DROP TABLE missing;",
+		}))
+		require.NoError(t, m.Up(0))
+
+		// Act
+		err := m.Down(1)
+		statuses, statusErr := m.Status()
+
+		// Assert
+		require.Error(t, err)
+		require.NoError(t, statusErr)
+		assert.True(t, statuses[3].Dirty)
+	})
+
+	t.Run("should force a version without running migrations", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+		require.NoError(t, m.Up(1))
+
+		// Act
+		require.NoError(t, m.Force(3))
+		up := appliedVersions(t, m)
+		require.NoError(t, m.Force(0))
+		down := appliedVersions(t, m)
+		err := m.Force(9)
+
+		// Assert
+		assert.Equal(t, []int64{1, 3}, up)
+		assert.Empty(t, down)
+		assert.Equal(t, []string{"notes"}, tables(t, m))
+		assert.ErrorContains(t, err, "unknown migration version 9")
+	})
+
+	t.Run("should report modified migrations", func(t *testing.T) {
+		// Arrange
+		m, cfg := newTestMigrator(t, testMigrations)
+		require.NoError(t, m.Up(1))
+		writeMigrationFiles(t, cfg.Migrations.Dir, map[string]string{
+			"000001_create_notes.up.sql": "CREATE TABLE notes (id INTEGER PRIMARY KEY);",
+		})
+		modified, err := New(cfg)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = modified.Close() })
+
+		// Act
+		statuses, statusErr := modified.Status()
+		upErr := modified.Up(0)
+
+		// Assert
+		require.NoError(t, statusErr)
+		assert.True(t, statuses[0].Modified)
+		assert.ErrorContains(t, upErr, "was modified after it was applied")
+	})
+}
+
+// schema returns the definitions of every table and index of the database
+// of m.
+func schema(t *testing.T, m *Migrator) []string {
+	t.Helper()
+	rows, err := m.db.Query("SELECT sql FROM sqlite_master WHERE sql IS NOT NULL ORDER BY name")
+	require.NoError(t, err)
+	defer rows.Close()
+	defs := []string{}
+	for rows.Next() {
+		var def string
+		require.NoError(t, rows.Scan(&def))
+		defs = append(defs, def)
+	}
+	require.NoError(t, rows.Err())
+	return defs
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	t.Run("should print migrations without touching a new database", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+		var out bytes.Buffer
+		m.SetDryRun(&out)
+
+		// Act
+		upErr := m.Up(2)
+		statuses, statusErr := m.Status()
+		forceErr := m.Force(1)
+
+		// Assert
+		require.NoError(t, upErr)
+		require.NoError(t, statusErr)
+		require.NoError(t, forceErr)
+		assert.Len(t, statuses, 4)
+		assert.Empty(t, schema(t, m))
+		assert.Equal(t, `-- Migration 1 create_notes (up)
+CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT);
+
+-- Migration 2 add_notes_title (up)
+ALTER TABLE notes ADD COLUMN title TEXT;
+
+-- Force version 1
+DELETE FROM schema_migrations WHERE version > 1;
+UPDATE schema_migrations SET dirty = FALSE;
+INSERT INTO schema_migrations (version, checksum) VALUES (1, '`+m.find(1).Checksum+`') ON CONFLICT (version) DO NOTHING;
+`, out.String())
+	})
+
+	t.Run("should leave the schema and bookkeeping of a migrated database unchanged", func(t *testing.T) {
+		// Arrange
+		m, _ := newTestMigrator(t, testMigrations)
+		require.NoError(t, m.Up(2))
+		_, err := m.db.Exec("UPDATE schema_migrations SET checksum = NULL")
+		require.NoError(t, err)
+		before := schema(t, m)
+		var out bytes.Buffer
+		m.SetDryRun(&out)
+
+		// Act
+		require.NoError(t, m.Up(0))
+		require.NoError(t, m.Down(1))
+		require.NoError(t, m.Redo())
+		require.NoError(t, m.Force(4))
+
+		// Assert
+		assert.Equal(t, before, schema(t, m))
+		assert.Equal(t, []int64{1, 2}, appliedVersions(t, m))
+		var missing int
+		require.NoError(t, m.db.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE checksum IS NULL").Scan(&missing))
+		assert.Equal(t, 2, missing, "checksums are not backfilled")
+		assert.Contains(t, out.String(), "-- Migration 3 create_tags (up)")
+		assert.Contains(t, out.String(), "-- Migration 2 add_notes_title (down)")
+	})
+}
@@ -0,0 +1,5 @@
+-- +migrate notransaction
+-- Fails while a soft-deleted user shares its email with an active one.
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
+DROP INDEX CONCURRENTLY IF EXISTS users_deleted_at_idx;
+DROP INDEX CONCURRENTLY IF EXISTS users_email_active_key;
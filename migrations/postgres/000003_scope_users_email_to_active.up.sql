@@ -0,0 +1,5 @@
+-- +migrate notransaction
+-- Soft-deleted users keep their email, so only active users must be unique.
+CREATE UNIQUE INDEX CONCURRENTLY IF NOT EXISTS users_email_active_key ON users (email) WHERE deleted_at IS NULL;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE INDEX CONCURRENTLY IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
@@ -0,0 +1,236 @@
+package migrations
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"http-server/config"
+)
+
+// Dialects with their own migration directory.
+const (
+	DialectPostgres = "postgres"
+	DialectSQLite   = "sqlite"
+)
+
+// Dialects lists every supported dialect.
+var Dialects = []string{DialectPostgres, DialectSQLite}
+
+// embedded holds the SQL migrations of every dialect compiled into the
+// binary, so migrations can run regardless of the working directory.
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var embedded embed.FS
+
+// noTransactionDirective in a SQL file runs it outside of a transaction, as
+// required by statements such as CREATE INDEX CONCURRENTLY.
+const noTransactionDirective = "-- +migrate notransaction"
+
+// migrationFileRe matches migration file names: VERSION_name.(up|down).sql.
+var migrationFileRe = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Source returns the migration files of dialect: the dialect subdirectory
+// of dir when it is set, which is convenient while developing new
+// migrations, or the files embedded in the binary otherwise.
+func Source(dialect, dir string) (fs.FS, error) {
+	if !slices.Contains(Dialects, dialect) {
+		return nil, fmt.Errorf("unsupported migration dialect %q", dialect)
+	}
+	if dir != "" {
+		return os.DirFS(filepath.Join(dir, dialect)), nil
+	}
+	return fs.Sub(embedded, dialect)
+}
+
+// DialectOf returns the migration dialect of the configured database driver.
+func DialectOf(cfg *config.DatabaseConfig) string {
+	if cfg.Driver == "" {
+		return DialectPostgres
+	}
+	return cfg.Driver
+}
+
+// loadMigrations pairs the up and down files found in fsys with the
+// registered Go migrations, ordered by version.
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find migration files: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		version, name, direction, err := parseFileName(file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+		} else if mig.Name != name {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, mig.Name, name)
+		}
+
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		s := sqlStep(file, string(content))
+		if direction == "up" {
+			mig.Up = s
+			mig.Checksum = checksum(content)
+		} else {
+			mig.Down = s
+		}
+	}
+
+	for version, gm := range goMigrations {
+		if mig, ok := byVersion[version]; ok {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and Go migration %s", version, mig.Name, gm.name)
+		}
+		label := fmt.Sprintf("%d_%s (go)", version, gm.name)
+		mig := &Migration{
+			Version:  version,
+			Name:     gm.name,
+			Up:       &Step{Source: label, NoTransaction: gm.NoTransaction, run: gm.Up},
+			Checksum: checksum([]byte(label)),
+		}
+		if gm.Down != nil {
+			mig.Down = &Step{Source: label, NoTransaction: gm.NoTransaction, run: gm.Down}
+		}
+		byVersion[version] = mig
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up file", mig.Version)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// parseFileName validates a migration file name and splits it into its parts.
+func parseFileName(file string) (version int64, name, direction string, err error) {
+	match := migrationFileRe.FindStringSubmatch(path.Base(file))
+	if match == nil {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: expected VERSION_name.up.sql or VERSION_name.down.sql", file)
+	}
+	version, err = strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, "", "", fmt.Errorf("invalid migration file name %q: %w", file, err)
+	}
+	return version, match[2], match[3], nil
+}
+
+// sqlStep creates the step running the SQL script content.
+func sqlStep(file, content string) *Step {
+	s := &Step{Source: file, SQL: content, NoTransaction: hasNoTransactionDirective(content)}
+	s.run = func(ctx context.Context, db Executor) error {
+		if !s.NoTransaction {
+			_, err := db.ExecContext(ctx, content)
+			return err
+		}
+		// A multi-statement query runs in an implicit transaction, so
+		// statements have to be sent one at a time.
+		for _, stmt := range splitStatements(content) {
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return s
+}
+
+func hasNoTransactionDirective(content string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		if strings.TrimSpace(scanner.Text()) == noTransactionDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// splitStatements splits a SQL script on semicolons, ignoring those inside
+// quoted strings, identifiers, dollar-quoted bodies and comments.
+func splitStatements(script string) []string {
+	var (
+		stmts []string
+		start int
+	)
+	for i := 0; i < len(script); i++ {
+		switch {
+		case script[i] == '\'' || script[i] == '"':
+			if end := strings.IndexByte(script[i+1:], script[i]); end >= 0 {
+				i += end + 1
+			}
+		case strings.HasPrefix(script[i:], "--"):
+			if end := strings.IndexByte(script[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(script)
+			}
+		case strings.HasPrefix(script[i:], "/*"):
+			if end := strings.Index(script[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			}
+		case script[i] == '$':
+			if tag := dollarQuoteTagRe.FindString(script[i:]); tag != "" {
+				if end := strings.Index(script[i+len(tag):], tag); end >= 0 {
+					i += len(tag) + end + len(tag) - 1
+				}
+			}
+		case script[i] == ';':
+			stmts = appendStatement(stmts, script[start:i])
+			start = i + 1
+		}
+	}
+	return appendStatement(stmts, script[min(start, len(script)):])
+}
+
+var dollarQuoteTagRe = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+
+func appendStatement(stmts []string, stmt string) []string {
+	if hasCode(stmt) {
+		stmts = append(stmts, strings.TrimSpace(stmt))
+	}
+	return stmts
+}
+
+// hasCode reports whether stmt contains anything besides whitespace and
+// line comments.
+func hasCode(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return true
+		}
+	}
+	return false
+}
+
+// checksum returns the hex-encoded SHA-256 of a migration file.
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
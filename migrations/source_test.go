@@ -0,0 +1,93 @@
+package migrations
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("should pair up and down files ordered by version", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{
+			"000002_add_index.up.sql":            {Data: []byte("-- +migrate notransaction\nCREATE INDEX CONCURRENTLY idx ON users (name);")},
+			"000001_create_users_table.up.sql":   {Data: []byte("CREATE TABLE users (id INT);")},
+			"000001_create_users_table.down.sql": {Data: []byte("DROP TABLE users;")},
+		}
+
+		// Act
+		migrations, err := loadMigrations(fsys)
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, migrations, 2)
+		assert.Equal(t, int64(1), migrations[0].Version)
+		assert.Equal(t, "create_users_table", migrations[0].Name)
+		assert.NotNil(t, migrations[0].Down)
+		assert.False(t, migrations[0].Up.NoTransaction)
+		assert.Equal(t, int64(2), migrations[1].Version)
+		assert.Nil(t, migrations[1].Down)
+		assert.True(t, migrations[1].Up.NoTransaction)
+	})
+
+	t.Run("should reject malformed file names", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{"create_users.up.sql": {Data: []byte("SELECT 1;")}}
+
+		// Act
+		_, err := loadMigrations(fsys)
+
+		// Assert
+		assert.ErrorContains(t, err, "invalid migration file name")
+	})
+
+	t.Run("should reject duplicate versions", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{
+			"000001_create_users.up.sql":  {Data: []byte("SELECT 1;")},
+			"000001_create_orders.up.sql": {Data: []byte("SELECT 1;")},
+		}
+
+		// Act
+		_, err := loadMigrations(fsys)
+
+		// Assert
+		assert.ErrorContains(t, err, "duplicate migration version 1")
+	})
+
+	t.Run("should reject Go migrations reusing a SQL version", func(t *testing.T) {
+		// Arrange
+		fsys := fstest.MapFS{"000001_create_users.up.sql": {Data: []byte("SELECT 1;")}}
+		goMigrations[1] = registeredGoMigration{name: "backfill", GoMigration: GoMigration{
+			Up: func(ctx context.Context, db Executor) error { return nil },
+		}}
+		defer delete(goMigrations, 1)
+
+		// Act
+		_, err := loadMigrations(fsys)
+
+		// Assert
+		assert.ErrorContains(t, err, "duplicate migration version 1")
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `-- +migrate notransaction
+CREATE INDEX CONCURRENTLY idx_users_name ON users (name);
+INSERT INTO notes (body) VALUES ('a; b'), ('it''s');
+/* a; comment */
+CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+-- trailing comment;
+`
+
+	stmts := splitStatements(script)
+
+	assert.Equal(t, []string{
+		"-- +migrate notransaction\nCREATE INDEX CONCURRENTLY idx_users_name ON users (name)",
+		"INSERT INTO notes (body) VALUES ('a; b'), ('it''s')",
+		"/* a; comment */\nCREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql",
+	}, stmts)
+}
@@ -0,0 +1,4 @@
+-- Fails while a soft-deleted user shares its email with an active one.
+DROP INDEX users_deleted_at_idx;
+DROP INDEX users_email_active_key;
+CREATE UNIQUE INDEX users_email_key ON users (email);
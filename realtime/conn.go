@@ -0,0 +1,189 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxMessageSize is the size of the largest message read from clients.
+const maxMessageSize = 4096
+
+// conn is a WebSocket connection and its subscriptions. Messages to send
+// are queued, so that a slow client delays nobody but itself; when its
+// queue is full, it is closed.
+type conn struct {
+	ws   *websocket.Conn
+	send chan []byte
+
+	// closing is closed, once closeCode and closeText are set, to make
+	// the writer close the connection.
+	closing   chan struct{}
+	closeOnce sync.Once
+	closeCode int
+	closeText string
+
+	mu     sync.Mutex
+	topics map[string]bool
+}
+
+func newConn(ws *websocket.Conn, sendBuffer int) *conn {
+	return &conn{
+		ws:      ws,
+		send:    make(chan []byte, sendBuffer),
+		closing: make(chan struct{}),
+		topics:  make(map[string]bool),
+	}
+}
+
+// serve runs the connection until it is closed by either side.
+func (c *conn) serve(pingInterval, writeTimeout time.Duration) {
+	readerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		c.read(2 * pingInterval)
+	}()
+
+	c.write(pingInterval, writeTimeout)
+	// Give the client a chance to answer the close message
+	select {
+	case <-readerDone:
+	case <-time.After(writeTimeout):
+	}
+	_ = c.ws.Close()
+	<-readerDone
+}
+
+// close makes the writer send a close message with code and text, then
+// close the connection.
+func (c *conn) close(code int, text string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeText = text
+		close(c.closing)
+	})
+}
+
+// enqueue queues msg to be sent. It closes the connection when its queue is
+// full, and reports whether msg was queued.
+func (c *conn) enqueue(msg []byte) bool {
+	select {
+	case <-c.closing:
+		return false
+	default:
+	}
+	select {
+	case c.send <- msg:
+		return true
+	default:
+		slowConsumersTotal.Inc()
+		c.close(websocket.ClosePolicyViolation, "slow consumer")
+		return false
+	}
+}
+
+// reply queues msg, encoded as JSON.
+func (c *conn) reply(msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		c.close(websocket.CloseInternalServerErr, "")
+		return
+	}
+	c.enqueue(data)
+}
+
+// match returns the first of topics the connection is subscribed to, or ""
+// if none.
+func (c *conn) match(topics []string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		if c.topics[topic] {
+			return topic
+		}
+	}
+	return ""
+}
+
+// read handles the messages of the client until it closes the connection,
+// sends an invalid frame or stays silent for longer than timeout.
+func (c *conn) read(timeout time.Duration) {
+	defer c.close(websocket.CloseNormalClosure, "")
+
+	c.ws.SetReadLimit(maxMessageSize)
+	_ = c.ws.SetReadDeadline(time.Now().Add(timeout))
+	c.ws.SetPongHandler(func(string) error {
+		return c.ws.SetReadDeadline(time.Now().Add(timeout))
+	})
+	for {
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		_ = c.ws.SetReadDeadline(time.Now().Add(timeout))
+		c.handle(data)
+	}
+}
+
+// handle answers a message of the client.
+func (c *conn) handle(data []byte) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		c.reply(Message{Type: TypeError, Error: "Invalid message"})
+		return
+	}
+
+	switch msg.Type {
+	case TypeSubscribe:
+		if !validTopic(msg.Topic) {
+			c.reply(Message{Type: TypeError, Topic: msg.Topic, Error: "Unknown topic"})
+			return
+		}
+		c.mu.Lock()
+		full := len(c.topics) >= maxTopics && !c.topics[msg.Topic]
+		if !full {
+			c.topics[msg.Topic] = true
+		}
+		c.mu.Unlock()
+		if full {
+			c.reply(Message{Type: TypeError, Topic: msg.Topic, Error: "Too many topics"})
+			return
+		}
+		c.reply(Message{Type: TypeSubscribed, Topic: msg.Topic})
+	case TypeUnsubscribe:
+		c.mu.Lock()
+		delete(c.topics, msg.Topic)
+		c.mu.Unlock()
+		c.reply(Message{Type: TypeUnsubscribed, Topic: msg.Topic})
+	case TypePing:
+		c.reply(Message{Type: TypePong})
+	default:
+		c.reply(Message{Type: TypeError, Error: "Unknown message type"})
+	}
+}
+
+// write sends the queued messages and pings until the connection is
+// closing, then sends the close message.
+func (c *conn) write(pingInterval, writeTimeout time.Duration) {
+	ping := time.NewTicker(pingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg := <-c.send:
+			_ = c.ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				return
+			}
+		case <-c.closing:
+			_ = c.ws.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(c.closeCode, c.closeText), time.Now().Add(writeTimeout))
+			return
+		}
+	}
+}
@@ -0,0 +1,267 @@
+// Package realtime pushes user events to WebSocket clients. Clients
+// subscribe to topics with a small JSON protocol, and the Hub of each
+// instance forwards the events of the events.Broker to the connections
+// subscribed to them.
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/events"
+	"http-server/utils"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultMaxConnections = 1000
+	defaultSendBuffer     = 64
+	defaultPingInterval   = 30 * time.Second
+	defaultWriteTimeout   = 10 * time.Second
+	// resubscribeDelay is how long the hub waits before subscribing to the
+	// broker again after failing to.
+	resubscribeDelay = time.Second
+)
+
+var (
+	// ErrTooManyConnections is returned by Serve when the hub already
+	// serves its maximum number of connections.
+	ErrTooManyConnections = errors.New("too many connections")
+	// ErrHubStopped is returned by Serve once the hub is stopped.
+	ErrHubStopped = errors.New("hub stopped")
+)
+
+// Hub serves the WebSocket connections of an instance and forwards them the
+// events they subscribed to.
+type Hub struct {
+	broker       *events.Broker
+	upgrader     websocket.Upgrader
+	sendBuffer   int
+	pingInterval time.Duration
+	writeTimeout time.Duration
+	// slots holds a token per connection, bounding their number.
+	slots chan struct{}
+
+	mu      sync.RWMutex
+	conns   map[*conn]struct{}
+	stopped bool
+	// serving counts the running Serve calls.
+	serving sync.WaitGroup
+
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	done      chan struct{}
+}
+
+// NewHub creates a Hub forwarding the events of broker.
+func NewHub(broker *events.Broker, cfg *config.WebSocketConfig) *Hub {
+	maxConnections := cfg.MaxConnections
+	if maxConnections <= 0 {
+		maxConnections = defaultMaxConnections
+	}
+	sendBuffer := cfg.SendBuffer
+	if sendBuffer <= 0 {
+		sendBuffer = defaultSendBuffer
+	}
+	pingInterval := cfg.PingInterval
+	if pingInterval <= 0 {
+		pingInterval = defaultPingInterval
+	}
+	writeTimeout := cfg.WriteTimeout
+	if writeTimeout <= 0 {
+		writeTimeout = defaultWriteTimeout
+	}
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	return &Hub{
+		broker: broker,
+		upgrader: websocket.Upgrader{
+			HandshakeTimeout: writeTimeout,
+			CheckOrigin:      checkOrigin(cfg.AllowedOrigins),
+		},
+		sendBuffer:   sendBuffer,
+		pingInterval: pingInterval,
+		writeTimeout: writeTimeout,
+		slots:        make(chan struct{}, maxConnections),
+		conns:        make(map[*conn]struct{}),
+		runCtx:       runCtx,
+		cancelRun:    cancelRun,
+		done:         make(chan struct{}),
+	}
+}
+
+// Start starts forwarding events to the connections.
+func (h *Hub) Start() {
+	go h.loop()
+}
+
+// Stop closes every connection with a going away status and stops
+// forwarding events. It waits for the connections to close until ctx is
+// done.
+func (h *Hub) Stop(ctx context.Context) error {
+	h.mu.Lock()
+	h.stopped = true
+	for c := range h.conns {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+	h.mu.Unlock()
+	h.cancelRun()
+
+	closed := make(chan struct{})
+	go func() {
+		h.serving.Wait()
+		<-h.done
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Serve upgrades the request to a WebSocket connection and serves it until
+// it is closed. It returns ErrTooManyConnections or ErrHubStopped without
+// writing a response, so that the caller can. When the upgrade fails, the
+// upgrader has already responded with an error status.
+func (h *Hub) Serve(w http.ResponseWriter, r *http.Request) error {
+	select {
+	case h.slots <- struct{}{}:
+	default:
+		return ErrTooManyConnections
+	}
+	defer func() { <-h.slots }()
+
+	h.mu.RLock()
+	stopped := h.stopped
+	if !stopped {
+		h.serving.Add(1)
+	}
+	h.mu.RUnlock()
+	if stopped {
+		return ErrHubStopped
+	}
+	defer h.serving.Done()
+
+	ws, err := h.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return err
+	}
+	activeConnections.Inc()
+	defer activeConnections.Dec()
+
+	c := newConn(ws, h.sendBuffer)
+	h.mu.Lock()
+	if h.stopped {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	} else {
+		h.conns[c] = struct{}{}
+	}
+	h.mu.Unlock()
+	defer func() {
+		h.mu.Lock()
+		delete(h.conns, c)
+		h.mu.Unlock()
+	}()
+
+	c.serve(h.pingInterval, h.writeTimeout)
+	return nil
+}
+
+// loop subscribes to the broker and forwards its events until the hub is
+// stopped. After losing the subscription, it resumes from the last event
+// forwarded.
+func (h *Hub) loop() {
+	defer close(h.done)
+	lastEventID := ""
+	for {
+		sub, err := h.broker.Subscribe(h.runCtx, lastEventID)
+		if err == nil {
+			for e := range sub.Events() {
+				lastEventID = e.ID
+				h.dispatch(e)
+			}
+			_ = sub.Close()
+		} else if h.runCtx.Err() == nil {
+			utils.Logger.Error("Failed to subscribe to events", "error", err)
+		}
+
+		select {
+		case <-h.runCtx.Done():
+			return
+		case <-time.After(resubscribeDelay):
+		}
+	}
+}
+
+// dispatch queues e on every connection subscribed to one of its topics.
+// A connection subscribed to several of them receives it once, with the
+// most specific topic.
+func (h *Hub) dispatch(e event.Event) {
+	topics := eventTopics(e)
+	messages := make(map[string][]byte, len(topics))
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for c := range h.conns {
+		topic := c.match(topics)
+		if topic == "" {
+			continue
+		}
+		msg, ok := messages[topic]
+		if !ok {
+			var err error
+			msg, err = json.Marshal(Message{Type: TypeEvent, Topic: topic, Event: &e})
+			if err != nil {
+				utils.Logger.Error("Failed to encode event message", "error", err)
+				return
+			}
+			messages[topic] = msg
+		}
+		c.enqueue(msg)
+	}
+}
+
+// eventTopics returns the topics of e, the most specific first.
+func eventTopics(e event.Event) []string {
+	if !strings.HasPrefix(e.Type, "user.") {
+		return nil
+	}
+	var data struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(e.Data, &data); err != nil || data.ID <= 0 {
+		return []string{TopicUsers}
+	}
+	return []string{TopicUsers + ":" + strconv.Itoa(data.ID), TopicUsers}
+}
+
+// checkOrigin allows requests without an Origin header, from the host they
+// are sent to, or from one of allowed.
+func checkOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		u, err := url.Parse(origin)
+		if err == nil && strings.EqualFold(u.Host, r.Host) {
+			return true
+		}
+		for _, o := range allowed {
+			if strings.EqualFold(o, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -0,0 +1,182 @@
+package realtime
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/events"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+// newTestHub starts a hub on an httptest server and returns the broker
+// feeding it and the WebSocket URL of the server.
+func newTestHub(t *testing.T, cfg *config.WebSocketConfig) (*Hub, *events.Broker, string) {
+	t.Helper()
+	rdb := storagetest.NewRedisClient(t)
+	broker := events.NewBroker(rdb, &config.EventsConfig{})
+	hub := NewHub(broker, cfg)
+	hub.Start()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := hub.Serve(w, r); errors.Is(err, ErrTooManyConnections) || errors.Is(err, ErrHubStopped) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(func() {
+		_ = hub.Stop(context.Background())
+		server.Close()
+	})
+	return hub, broker, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func dial(t *testing.T, url string) *websocket.Conn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = ws.Close() })
+	return ws
+}
+
+// exchange sends msg and returns the next message received.
+func exchange(t *testing.T, ws *websocket.Conn, msg Message) Message {
+	t.Helper()
+	require.NoError(t, ws.WriteJSON(msg))
+	return next(t, ws)
+}
+
+func next(t *testing.T, ws *websocket.Conn) Message {
+	t.Helper()
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(time.Second)))
+	var msg Message
+	require.NoError(t, ws.ReadJSON(&msg))
+	return msg
+}
+
+func userEvent(t *testing.T, id int) event.Event {
+	t.Helper()
+	e, err := event.New(event.TypeUserDeleted, event.UserDeleted{ID: id})
+	require.NoError(t, err)
+	return e
+}
+
+func TestHub(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should answer pings and subscriptions", func(t *testing.T) {
+		// Arrange
+		_, _, url := newTestHub(t, &config.WebSocketConfig{})
+		ws := dial(t, url)
+
+		// Act
+		pong := exchange(t, ws, Message{Type: TypePing})
+		subscribed := exchange(t, ws, Message{Type: TypeSubscribe, Topic: "users:7"})
+		unknown := exchange(t, ws, Message{Type: TypeSubscribe, Topic: "users:007"})
+		unsubscribed := exchange(t, ws, Message{Type: TypeUnsubscribe, Topic: "users:7"})
+
+		// Assert
+		assert.Equal(t, Message{Type: TypePong}, pong)
+		assert.Equal(t, Message{Type: TypeSubscribed, Topic: "users:7"}, subscribed)
+		assert.Equal(t, Message{Type: TypeError, Topic: "users:007", Error: "Unknown topic"}, unknown)
+		assert.Equal(t, Message{Type: TypeUnsubscribed, Topic: "users:7"}, unsubscribed)
+	})
+
+	t.Run("should forward events to the connections subscribed to their topics", func(t *testing.T) {
+		// Arrange
+		_, broker, url := newTestHub(t, &config.WebSocketConfig{})
+		all, one := dial(t, url), dial(t, url)
+		exchange(t, all, Message{Type: TypeSubscribe, Topic: TopicUsers})
+		exchange(t, one, Message{Type: TypeSubscribe, Topic: "users:2"})
+		events := []event.Event{userEvent(t, 1), userEvent(t, 2)}
+
+		// Act
+		err := broker.Publish(ctx, events)
+
+		// Assert
+		require.NoError(t, err)
+		first, second := next(t, all), next(t, all)
+		assert.Equal(t, TypeEvent, first.Type)
+		assert.Equal(t, TopicUsers, first.Topic)
+		assert.Equal(t, events[0].ID, first.Event.ID)
+		assert.Equal(t, events[1].ID, second.Event.ID)
+		only := next(t, one)
+		assert.Equal(t, "users:2", only.Topic)
+		assert.Equal(t, events[1].ID, only.Event.ID)
+	})
+
+	t.Run("should refuse connections beyond the maximum", func(t *testing.T) {
+		// Arrange
+		_, _, url := newTestHub(t, &config.WebSocketConfig{MaxConnections: 1})
+		ws := dial(t, url)
+		exchange(t, ws, Message{Type: TypePing})
+
+		// Act
+		_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+
+		// Assert
+		require.ErrorIs(t, err, websocket.ErrBadHandshake)
+		assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	})
+
+	t.Run("should close connections with a going away status when stopped", func(t *testing.T) {
+		// Arrange
+		hub, _, url := newTestHub(t, &config.WebSocketConfig{})
+		ws := dial(t, url)
+		exchange(t, ws, Message{Type: TypePing})
+		require.NoError(t, ws.SetReadDeadline(time.Now().Add(time.Second)))
+		readErr := make(chan error, 1)
+		go func() {
+			_, _, err := ws.ReadMessage()
+			readErr <- err
+		}()
+
+		// Act
+		err := hub.Stop(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		err = <-readErr
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), "got %v", err)
+	})
+}
+
+func TestConnEnqueue(t *testing.T) {
+	t.Run("should close the connection when its send buffer is full", func(t *testing.T) {
+		// Arrange
+		c := newConn(nil, 1)
+
+		// Act
+		queued := c.enqueue([]byte("first"))
+		dropped := c.enqueue([]byte("second"))
+
+		// Assert
+		assert.True(t, queued)
+		assert.False(t, dropped)
+		assert.Equal(t, websocket.ClosePolicyViolation, c.closeCode)
+		select {
+		case <-c.closing:
+		default:
+			assert.Fail(t, "connection is not closing")
+		}
+	})
+}
@@ -0,0 +1,59 @@
+package realtime
+
+import (
+	"http-server/dto/event"
+	"strconv"
+	"strings"
+)
+
+// Message types sent by clients.
+const (
+	// TypeSubscribe subscribes the connection to Topic.
+	TypeSubscribe = "subscribe"
+	// TypeUnsubscribe unsubscribes the connection from Topic.
+	TypeUnsubscribe = "unsubscribe"
+	// TypePing asks for a TypePong message.
+	TypePing = "ping"
+)
+
+// Message types sent by the server.
+const (
+	// TypeSubscribed confirms a TypeSubscribe message.
+	TypeSubscribed = "subscribed"
+	// TypeUnsubscribed confirms a TypeUnsubscribe message.
+	TypeUnsubscribed = "unsubscribed"
+	// TypePong answers a TypePing message.
+	TypePong = "pong"
+	// TypeEvent carries an Event of Topic.
+	TypeEvent = "event"
+	// TypeError reports a message that could not be handled.
+	TypeError = "error"
+)
+
+// TopicUsers receives the events of every user. The events of a single
+// user are on TopicUsers + ":" + its ID, such as users:42.
+const TopicUsers = "users"
+
+// maxTopics is the number of topics a connection can subscribe to.
+const maxTopics = 100
+
+// Message is a message of the WebSocket protocol, in either direction.
+type Message struct {
+	Type  string       `json:"type"`
+	Topic string       `json:"topic,omitempty"`
+	Event *event.Event `json:"event,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// validTopic reports whether clients can subscribe to topic.
+func validTopic(topic string) bool {
+	if topic == TopicUsers {
+		return true
+	}
+	id, ok := strings.CutPrefix(topic, TopicUsers+":")
+	if !ok {
+		return false
+	}
+	n, err := strconv.Atoi(id)
+	return err == nil && n > 0 && strconv.Itoa(n) == id
+}
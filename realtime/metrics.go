@@ -0,0 +1,23 @@
+package realtime
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	activeConnections = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "websocket_active_connections",
+			Help: "Number of WebSocket connections currently served by this instance.",
+		},
+	)
+	slowConsumersTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "websocket_slow_consumers_total",
+			Help: "Total number of WebSocket connections closed because their send buffer was full.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(activeConnections)
+	prometheus.MustRegister(slowConsumersTotal)
+}
@@ -0,0 +1,41 @@
+package scheduler
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var (
+	taskRunsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "scheduler_task_runs_total",
+			Help: "Total number of scheduled task runs executed by this instance.",
+		},
+		[]string{"task", "result"},
+	)
+	taskDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "scheduler_task_duration_seconds",
+			Help: "Duration of scheduled task runs executed by this instance.",
+		},
+		[]string{"task"},
+	)
+	taskLastRun = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scheduler_task_last_run_timestamp_seconds",
+			Help: "Unix time of the last run of a scheduled task executed by this instance.",
+		},
+		[]string{"task"},
+	)
+	taskNextRun = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "scheduler_task_next_run_timestamp_seconds",
+			Help: "Unix time of the next scheduled run of a task.",
+		},
+		[]string{"task"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(taskRunsTotal)
+	prometheus.MustRegister(taskDuration)
+	prometheus.MustRegister(taskLastRun)
+	prometheus.MustRegister(taskNextRun)
+}
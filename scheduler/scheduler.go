@@ -0,0 +1,331 @@
+// Package scheduler runs periodic tasks on cron schedules. Every instance
+// runs the schedules, and a lock in Redis lets a single instance execute
+// each run.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"http-server/config"
+	"http-server/storage"
+	"http-server/utils"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+)
+
+const defaultLease = 30 * time.Second
+
+// Redis key prefixes of the scheduler.
+const (
+	// lockKeyPrefix prefixes the lock held by the instance running a task.
+	lockKeyPrefix = "scheduler:lock:"
+	// statusKeyPrefix prefixes the hash holding the outcome of the last run
+	// of a task, whichever instance ran it.
+	statusKeyPrefix = "scheduler:status:"
+)
+
+// renewScript extends the lock of a task while the instance running it
+// still holds it, and returns 0 otherwise.
+//
+// KEYS: lock. ARGV: lock token, lease in milliseconds.
+var renewScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// TaskFunc is the work of a task. Its context is cancelled when the
+// scheduler stops or the instance loses the lock of the run.
+type TaskFunc func(ctx context.Context) error
+
+// TaskStatus describes a task, as reported by the admin endpoint.
+type TaskStatus struct {
+	Name string `json:"name" example:"purge_deleted_users"`
+	// Schedule is the cron expression of the task, empty when disabled.
+	Schedule string     `json:"schedule" example:"@hourly"`
+	NextRun  *time.Time `json:"next_run,omitempty"`
+	LastRun  *time.Time `json:"last_run,omitempty"`
+	// LastDuration is the duration of the last run in seconds.
+	LastDuration float64 `json:"last_duration,omitempty" example:"0.25"`
+	LastError    string  `json:"last_error,omitempty"`
+	// LastInstance identifies the instance that ran the task last.
+	LastInstance string `json:"last_instance,omitempty"`
+}
+
+type task struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	fn       TaskFunc
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Scheduler runs registered tasks on the schedules of its configuration.
+type Scheduler struct {
+	rdb      *storage.RedisClient
+	lease    time.Duration
+	specs    map[string]string
+	instance string
+
+	mu    sync.Mutex
+	tasks map[string]*task
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	// runCtx is passed to running tasks and cancelled when Stop stops
+	// waiting for them.
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// New creates a Scheduler storing its locks in rdb.
+func New(rdb *storage.RedisClient, cfg *config.SchedulerConfig) *Scheduler {
+	lease := cfg.Lease
+	if lease <= 0 {
+		lease = defaultLease
+	}
+	runCtx, cancelRun := context.WithCancel(context.Background())
+	return &Scheduler{
+		rdb:       rdb,
+		lease:     lease,
+		specs:     cfg.Tasks,
+		instance:  uuid.NewString(),
+		tasks:     make(map[string]*task),
+		stop:      make(chan struct{}),
+		runCtx:    runCtx,
+		cancelRun: cancelRun,
+	}
+}
+
+// Register adds a task run on the schedule configured for name. It panics if
+// name is registered twice.
+func (s *Scheduler) Register(name string, fn TaskFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, dup := s.tasks[name]; dup {
+		panic(fmt.Sprintf("scheduler: task %q registered twice", name))
+	}
+	s.tasks[name] = &task{name: name, spec: s.specs[name], fn: fn}
+}
+
+// Start parses the schedules and starts running the tasks. It fails for
+// invalid cron expressions and for schedules of unregistered tasks.
+func (s *Scheduler) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range s.specs {
+		if _, ok := s.tasks[name]; !ok {
+			return fmt.Errorf("scheduler: no task registered for schedule %q", name)
+		}
+	}
+	for _, t := range s.tasks {
+		if t.spec == "" {
+			continue
+		}
+		schedule, err := cron.ParseStandard(t.spec)
+		if err != nil {
+			return fmt.Errorf("scheduler: invalid schedule %q for task %q: %w", t.spec, t.name, err)
+		}
+		t.schedule = schedule
+	}
+
+	for _, t := range s.tasks {
+		if t.schedule == nil {
+			utils.Logger.Info("Scheduled task disabled", "task", t.name)
+			continue
+		}
+		s.wg.Add(1)
+		go s.loop(t)
+	}
+	return nil
+}
+
+// Stop stops scheduling runs and waits for the running ones to finish.
+// When ctx is done first, the running tasks are cancelled.
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() { close(s.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		s.cancelRun()
+		return nil
+	case <-ctx.Done():
+		s.cancelRun()
+		return ctx.Err()
+	}
+}
+
+// Tasks returns the status of every registered task, ordered by name.
+func (s *Scheduler) Tasks(ctx context.Context) ([]TaskStatus, error) {
+	s.mu.Lock()
+	tasks := make([]*task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	s.mu.Unlock()
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].name < tasks[j].name })
+
+	cmds := make([]*redis.StringStringMapCmd, len(tasks))
+	_, err := s.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, t := range tasks {
+			cmds[i] = pipe.HGetAll(ctx, statusKeyPrefix+t.name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]TaskStatus, len(tasks))
+	for i, t := range tasks {
+		status := TaskStatus{Name: t.name, Schedule: t.spec}
+		t.mu.Lock()
+		if !t.next.IsZero() {
+			next := t.next
+			status.NextRun = &next
+		}
+		t.mu.Unlock()
+
+		last := cmds[i].Val()
+		if lastRun, err := time.Parse(time.RFC3339Nano, last["last_run"]); err == nil {
+			status.LastRun = &lastRun
+		}
+		status.LastDuration, _ = strconv.ParseFloat(last["last_duration"], 64)
+		status.LastError = last["last_error"]
+		status.LastInstance = last["instance"]
+		statuses[i] = status
+	}
+	return statuses, nil
+}
+
+// loop runs t at every time of its schedule until the scheduler stops.
+// Runs missed while t was running are skipped.
+func (s *Scheduler) loop(t *task) {
+	defer s.wg.Done()
+
+	for {
+		next := t.schedule.Next(time.Now())
+		t.mu.Lock()
+		t.next = next
+		t.mu.Unlock()
+		taskNextRun.WithLabelValues(t.name).Set(float64(next.Unix()))
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(t, next)
+	}
+}
+
+// run executes the run of t scheduled at at, unless another instance holds
+// its lock. The lock is renewed while t runs and left to expire after it,
+// so instances whose clocks are a little late do not run it again.
+func (s *Scheduler) run(t *task, at time.Time) {
+	logger := utils.Logger.With("task", t.name)
+	key := lockKeyPrefix + t.name
+	token := fmt.Sprintf("%s:%d", s.instance, at.UnixMilli())
+
+	acquired, err := s.rdb.SetNX(s.runCtx, key, token, s.lease).Result()
+	if err != nil {
+		logger.Error("Failed to lock scheduled task", "error", err)
+		return
+	}
+	if !acquired {
+		logger.Debug("Scheduled task run by another instance")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(utils.ContextWithLogger(s.runCtx, logger))
+	defer cancel()
+	go s.renew(ctx, cancel, key, token)
+
+	t0 := time.Now()
+	err = call(ctx, t.fn)
+	duration := time.Since(t0)
+
+	result := "success"
+	lastError := ""
+	if err != nil {
+		result = "error"
+		lastError = err.Error()
+		logger.Error("Scheduled task failed", "error", err, "latency", duration)
+	} else {
+		logger.Info("Scheduled task succeeded", "latency", duration)
+	}
+	taskRunsTotal.WithLabelValues(t.name, result).Inc()
+	taskDuration.WithLabelValues(t.name).Observe(duration.Seconds())
+	taskLastRun.WithLabelValues(t.name).Set(float64(t0.Unix()))
+
+	// Record the outcome even when ctx was cancelled by Stop.
+	err = s.rdb.HSet(context.WithoutCancel(ctx), statusKeyPrefix+t.name,
+		"last_run", t0.UTC().Format(time.RFC3339Nano),
+		"last_duration", strconv.FormatFloat(duration.Seconds(), 'f', -1, 64),
+		"last_error", lastError,
+		"instance", s.instance,
+	).Err()
+	if err != nil {
+		logger.Error("Failed to record scheduled task status", "error", err)
+	}
+}
+
+// renew extends the lock of a run every third of the lease until ctx is
+// done. It cancels the run when the lock was lost, for example because
+// Redis could not be reached for a whole lease.
+func (s *Scheduler) renew(ctx context.Context, cancel context.CancelFunc, key, token string) {
+	ticker := time.NewTicker(s.lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		held, err := renewScript.Run(ctx, s.rdb, []string{key}, token, s.lease.Milliseconds()).Int()
+		if errors.Is(err, context.Canceled) {
+			return
+		}
+		if err != nil {
+			utils.LoggerFromContext(ctx).Warn("Failed to renew scheduled task lock", "error", err)
+			continue
+		}
+		if held == 0 {
+			utils.LoggerFromContext(ctx).Error("Lost scheduled task lock, cancelling the run")
+			cancel()
+			return
+		}
+	}
+}
+
+// call runs fn, turning panics into errors.
+func call(ctx context.Context, fn TaskFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
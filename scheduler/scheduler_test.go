@@ -0,0 +1,146 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+func TestScheduler(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should run each scheduled time on a single instance", func(t *testing.T) {
+		// Arrange
+		rdb := storagetest.NewRedisClient(t)
+		cfg := &config.SchedulerConfig{Tasks: map[string]string{"count": "@hourly"}}
+		var runs atomic.Int32
+		count := func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		}
+		first, second := New(rdb, cfg), New(rdb, cfg)
+		first.Register("count", count)
+		second.Register("count", count)
+		at := time.Now().Truncate(time.Hour)
+
+		// Act
+		first.run(first.tasks["count"], at)
+		second.run(second.tasks["count"], at)
+
+		// Assert
+		assert.Equal(t, int32(1), runs.Load())
+	})
+
+	t.Run("should record the outcome of the last run", func(t *testing.T) {
+		// Arrange
+		rdb := storagetest.NewRedisClient(t)
+		s := New(rdb, &config.SchedulerConfig{Tasks: map[string]string{"fail": "@hourly"}})
+		s.Register("fail", func(ctx context.Context) error { return errors.New("boom") })
+		s.Register("idle", func(ctx context.Context) error { return nil })
+
+		// Act
+		s.run(s.tasks["fail"], time.Now())
+		tasks, err := s.Tasks(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, tasks, 2)
+		assert.Equal(t, "fail", tasks[0].Name)
+		assert.Equal(t, "@hourly", tasks[0].Schedule)
+		assert.Equal(t, "boom", tasks[0].LastError)
+		assert.Equal(t, s.instance, tasks[0].LastInstance)
+		assert.NotNil(t, tasks[0].LastRun)
+		assert.Equal(t, TaskStatus{Name: "idle"}, tasks[1])
+	})
+
+	t.Run("should cancel the run when the lock is lost", func(t *testing.T) {
+		// Arrange
+		rdb := storagetest.NewRedisClient(t)
+		s := New(rdb, &config.SchedulerConfig{Lease: 30 * time.Millisecond})
+		s.Register("stuck", func(ctx context.Context) error {
+			require.NoError(t, rdb.Del(ctx, lockKeyPrefix+"stuck").Err())
+			<-ctx.Done()
+			return ctx.Err()
+		})
+
+		// Act
+		done := make(chan struct{})
+		go func() {
+			s.run(s.tasks["stuck"], time.Now())
+			close(done)
+		}()
+
+		// Assert
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("run was not cancelled")
+		}
+		tasks, err := s.Tasks(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, context.Canceled.Error(), tasks[0].LastError)
+	})
+
+	t.Run("should run tasks on their schedule until stopped", func(t *testing.T) {
+		// Arrange
+		rdb := storagetest.NewRedisClient(t)
+		s := New(rdb, &config.SchedulerConfig{Lease: 100 * time.Millisecond, Tasks: map[string]string{"tick": "@every 1s"}})
+		var runs atomic.Int32
+		s.Register("tick", func(ctx context.Context) error {
+			runs.Add(1)
+			return nil
+		})
+
+		// Act
+		require.NoError(t, s.Start())
+
+		// Assert
+		assert.Eventually(t, func() bool { return runs.Load() > 0 }, 3*time.Second, 10*time.Millisecond)
+		tasks, err := s.Tasks(ctx)
+		require.NoError(t, err)
+		assert.NotNil(t, tasks[0].NextRun)
+		assert.NoError(t, s.Stop(ctx))
+	})
+
+	t.Run("should refuse schedules of unregistered tasks", func(t *testing.T) {
+		// Arrange
+		s := New(storagetest.NewRedisClient(t), &config.SchedulerConfig{Tasks: map[string]string{"unknown": "@hourly"}})
+
+		// Act
+		err := s.Start()
+
+		// Assert
+		assert.ErrorContains(t, err, "unknown")
+	})
+
+	t.Run("should refuse invalid cron expressions", func(t *testing.T) {
+		// Arrange
+		s := New(storagetest.NewRedisClient(t), &config.SchedulerConfig{Tasks: map[string]string{"task": "every minute"}})
+		s.Register("task", func(ctx context.Context) error { return nil })
+
+		// Act
+		err := s.Start()
+
+		// Assert
+		assert.ErrorContains(t, err, "invalid schedule")
+	})
+}
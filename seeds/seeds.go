@@ -0,0 +1,158 @@
+// Package seeds loads fixture data into the database through the
+// repository layer, so local environments start with usable data.
+package seeds
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	user "http-server/dto/user"
+	"http-server/storage"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Result counts the fixture rows created and the ones skipped because they
+// already existed.
+type Result struct {
+	Created int
+	Skipped int
+}
+
+// Run loads every fixture file in dir (for example seeds/development) into
+// the database. Files are named after their table, as TABLE.yaml,
+// TABLE.yml or TABLE.json, and hold a list of rows. Rows that already exist
+// are skipped, so Run can be repeated safely.
+func Run(ctx context.Context, dir string, users storage.UserRepository) (map[string]Result, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read seeds directory: %w", err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	results := make(map[string]Result)
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml" && ext != ".json") {
+			continue
+		}
+		table := strings.TrimSuffix(entry.Name(), ext)
+		file := filepath.Join(dir, entry.Name())
+
+		switch table {
+		case "users":
+			var fixtures []user.CreateUserRequest
+			if err := readFixtures(file, &fixtures); err != nil {
+				return nil, err
+			}
+			result, err := SeedUsers(ctx, users, fixtures)
+			if err != nil {
+				return nil, fmt.Errorf("failed to seed %s: %w", file, err)
+			}
+			results[table] = result
+		default:
+			return nil, fmt.Errorf("no seeder for table %q (%s)", table, file)
+		}
+	}
+	return results, nil
+}
+
+// SeedUsers creates fixtures, skipping users whose email already exists.
+// Every fixture is validated first, so a malformed one seeds nothing.
+func SeedUsers(ctx context.Context, users storage.UserRepository, fixtures []user.CreateUserRequest) (Result, error) {
+	for i := range fixtures {
+		if err := validateUser(&fixtures[i]); err != nil {
+			return Result{}, fmt.Errorf("row %d: %w", i+1, err)
+		}
+	}
+
+	var result Result
+	for i := range fixtures {
+		_, err := users.CreateUser(ctx, &fixtures[i])
+		switch {
+		case errors.Is(err, storage.ErrEmailTaken):
+			result.Skipped++
+		case err != nil:
+			return result, err
+		default:
+			result.Created++
+		}
+	}
+	return result, nil
+}
+
+// validateUser trims the fields of a user fixture and checks that they
+// hold a name and a plain email address.
+func validateUser(req *user.CreateUserRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Email = strings.TrimSpace(req.Email)
+	switch {
+	case req.Name == "":
+		return errors.New("name is required")
+	case req.Email == "":
+		return errors.New("email is required")
+	}
+	if addr, err := mail.ParseAddress(req.Email); err != nil || addr.Address != req.Email {
+		return fmt.Errorf("invalid email %q", req.Email)
+	}
+	return nil
+}
+
+// readFixtures decodes file into v, rejecting unknown fields so that
+// misspelled columns are not silently dropped.
+func readFixtures(file string, v any) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if filepath.Ext(file) == ".json" {
+		dec := json.NewDecoder(f)
+		dec.DisallowUnknownFields()
+		err = dec.Decode(v)
+	} else {
+		dec := yaml.NewDecoder(f)
+		dec.KnownFields(true)
+		err = dec.Decode(v)
+		if errors.Is(err, io.EOF) {
+			// An empty file holds no rows
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	return nil
+}
+
+var (
+	firstNames = []string{"Olivia", "Liam", "Emma", "Noah", "Amelia", "Oliver", "Ava", "Elijah", "Sophia", "Mateo", "Isabella", "Lucas", "Mia", "Levi", "Aiko", "Kenji", "Priya", "Arjun", "Fatima", "Omar", "Chloe", "Hugo", "Ingrid", "Sven"}
+	lastNames  = []string{"Smith", "Johnson", "Garcia", "Martinez", "Brown", "Davis", "Lopez", "Wilson", "Anderson", "Tanaka", "Sato", "Patel", "Sharma", "Khan", "Haddad", "Dubois", "Martin", "Larsen", "Nilsson", "Rossi"}
+	domains    = []string{"example.com", "example.org", "example.net"}
+)
+
+// FakeUsers generates n random users with realistic names and unique
+// example.* email addresses, for load testing.
+func FakeUsers(n int) []user.CreateUserRequest {
+	users := make([]user.CreateUserRequest, n)
+	for i := range users {
+		first := firstNames[rand.IntN(len(firstNames))]
+		last := lastNames[rand.IntN(len(lastNames))]
+		users[i] = user.CreateUserRequest{
+			Name: first + " " + last,
+			// The random suffix keeps emails unique across runs.
+			Email: fmt.Sprintf("%s.%s.%08x@%s", strings.ToLower(first), strings.ToLower(last), rand.Uint32(), domains[rand.IntN(len(domains))]),
+		}
+	}
+	return users
+}
@@ -0,0 +1,169 @@
+package seeds
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	user "http-server/dto/user"
+	"http-server/storage"
+	"http-server/storage/storagetest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSQLiteUsers returns a user repository over a migrated temporary SQLite
+// database.
+func newSQLiteUsers(t *testing.T) storage.UserRepository {
+	t.Helper()
+	return storage.NewSQLiteUserRepository(storagetest.OpenSQLite(t))
+}
+
+// writeFixtures writes the given files to a temporary seeds directory.
+func writeFixtures(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+	}
+	return dir
+}
+
+func emails(t *testing.T, users storage.UserRepository) []string {
+	t.Helper()
+	all, err := users.GetUsers(context.Background(), storage.UserFilter{})
+	require.NoError(t, err)
+	emails := make([]string, len(all))
+	for i, u := range all {
+		emails[i] = u.Email
+	}
+	return emails
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should seed fixtures once and skip them on later runs", func(t *testing.T) {
+		// Arrange
+		users := newSQLiteUsers(t)
+		dir := writeFixtures(t, map[string]string{
+			"users.yaml": "- name: Alice\n  email: alice@example.com\n- name: Bob\n  email: bob@example.com\n",
+			"README.md":  "ignored",
+		})
+
+		// Act
+		first, err1 := Run(ctx, dir, users)
+		second, err2 := Run(ctx, dir, users)
+
+		// Assert
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.Equal(t, map[string]Result{"users": {Created: 2}}, first)
+		assert.Equal(t, map[string]Result{"users": {Skipped: 2}}, second)
+		assert.Equal(t, []string{"alice@example.com", "bob@example.com"}, emails(t, users))
+	})
+
+	t.Run("should load JSON fixtures", func(t *testing.T) {
+		// Arrange
+		users := newSQLiteUsers(t)
+		dir := writeFixtures(t, map[string]string{
+			"users.json": `[{"name": "Carol", "email": "carol@example.com"}]`,
+		})
+
+		// Act
+		results, err := Run(ctx, dir, users)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, map[string]Result{"users": {Created: 1}}, results)
+	})
+
+	t.Run("should seed the bundled development fixtures", func(t *testing.T) {
+		// Arrange
+		users := newSQLiteUsers(t)
+
+		// Act
+		results, err := Run(ctx, "development", users)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Positive(t, results["users"].Created)
+	})
+
+	t.Run("should reject malformed fixtures without seeding any row", func(t *testing.T) {
+		for name, fixtures := range map[string]string{
+			"missing email":   "- name: Alice\n  email: alice@example.com\n- name: Bob\n",
+			"invalid email":   "- name: Alice\n  email: Alice <alice@example.com>\n",
+			"blank name":      "- name: '  '\n  email: alice@example.com\n",
+			"unknown field":   "- name: Alice\n  mail: alice@example.com\n",
+			"not a list":      "name: Alice\n",
+			"unknown table":   "",
+			"unparsable YAML": "- name: [Alice\n",
+		} {
+			t.Run(name, func(t *testing.T) {
+				// Arrange
+				users := newSQLiteUsers(t)
+				file := "users.yaml"
+				if name == "unknown table" {
+					file = "accounts.yaml"
+				}
+				dir := writeFixtures(t, map[string]string{file: fixtures})
+
+				// Act
+				_, err := Run(ctx, dir, users)
+
+				// Assert
+				assert.Error(t, err)
+				assert.Empty(t, emails(t, users))
+			})
+		}
+	})
+}
+
+func TestSeedUsers(t *testing.T) {
+	t.Run("should trim fixtures and report the row of invalid ones", func(t *testing.T) {
+		// Arrange
+		users := newSQLiteUsers(t)
+
+		// Act
+		result, err := SeedUsers(context.Background(), users, []user.CreateUserRequest{
+			{Name: " Alice ", Email: " alice@example.com "},
+			{Name: "Bob", Email: "not-an-email"},
+		})
+
+		// Assert
+		assert.ErrorContains(t, err, "row 2: invalid email")
+		assert.Equal(t, Result{}, result)
+		assert.Empty(t, emails(t, users))
+	})
+}
+
+func TestFakeUsers(t *testing.T) {
+	t.Run("should generate valid users with unique emails", func(t *testing.T) {
+		// Act
+		fakes := FakeUsers(200)
+
+		// Assert
+		require.Len(t, fakes, 200)
+		seen := make(map[string]bool)
+		for i := range fakes {
+			require.NoError(t, validateUser(&fakes[i]))
+			assert.False(t, seen[fakes[i].Email], "duplicate email %s", fakes[i].Email)
+			seen[fakes[i].Email] = true
+		}
+	})
+
+	t.Run("should be seeded like fixtures", func(t *testing.T) {
+		// Arrange
+		users := newSQLiteUsers(t)
+
+		// Act
+		result, err := SeedUsers(context.Background(), users, FakeUsers(10))
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, Result{Created: 10}, result)
+	})
+}
@@ -1,18 +1,31 @@
 package services
 
 import (
+	"context"
 	user "http-server/dto/user"
 	"http-server/storage"
+	"time"
 )
 
 type UserService interface {
-	GetUsers() ([]user.User, error)
-	GetUser(id int) (*user.User, error)
-	CreateUser(req *user.CreateUserRequest) (*user.User, error)
-	DeleteUser(id int) error
+	GetUsers(ctx context.Context, filter storage.UserFilter) ([]user.User, error)
+	GetUser(ctx context.Context, id int, filter storage.UserFilter) (*user.User, error)
+	GetUsersByIDs(ctx context.Context, ids []int, filter storage.UserFilter) ([]user.User, error)
+	ListUsers(ctx context.Context, q storage.UserQuery) ([]user.User, error)
+	CountUsers(ctx context.Context, q storage.UserQuery) (int, error)
+	CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error)
+	ImportUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error)
+	ExportUsers(ctx context.Context, filter storage.UserFilter, fn func(u *user.User) error) error
+	UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error)
+	DeleteUser(ctx context.Context, id int, expectedVersion int) error
+	RestoreUser(ctx context.Context, id int) (*user.User, error)
+	PurgeUser(ctx context.Context, id int, expectedVersion int) error
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
+	WarmCache(ctx context.Context) error
 }
 
-// NewUserService creates a new UserService.
-func NewUserService(repo storage.UserRepository, redisClient *storage.RedisClient) UserService {
-	return &userServiceImpl{repo: repo, redisClient: redisClient}
+// NewUserService creates a new UserService. Writes run in transactions of
+// txManager, which also append their events to outbox.
+func NewUserService(repo storage.UserRepository, outbox storage.OutboxRepository, txManager storage.TxManager, redisClient *storage.RedisClient) UserService {
+	return &userServiceImpl{repo: repo, outbox: outbox, txManager: txManager, redisClient: redisClient}
 }
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"time"
 
+	"http-server/dto/event"
 	user "http-server/dto/user"
 	"http-server/storage"
 	"http-server/utils"
@@ -14,98 +15,304 @@ import (
 // UserService provides user-related business logic.
 type userServiceImpl struct {
 	repo        storage.UserRepository
+	outbox      storage.OutboxRepository
+	txManager   storage.TxManager
 	redisClient *storage.RedisClient
 }
 
-// GetUsers returns all users.
-func (s *userServiceImpl) GetUsers() ([]user.User, error) {
-	ctx := context.Background()
+// cacheHold marks the cache entries invalidated by a write. It is not JSON,
+// so reads treat it as a miss, and it keeps them from refilling the entry
+// for cacheHoldPeriod: until then, a read served by a lagging replica could
+// cache the data from before the write.
+const cacheHold = "hold"
+
+// cacheHoldPeriod covers the replication lag of read replicas, like the
+// default read-your-writes window.
+const cacheHoldPeriod = 5 * time.Second
+
+// invalidate clears the cache entries of keys and holds them off for
+// cacheHoldPeriod.
+func (s *userServiceImpl) invalidate(ctx context.Context, keys ...string) {
+	for _, key := range keys {
+		s.redisClient.Set(ctx, key, cacheHold, cacheHoldPeriod)
+	}
+}
+
+// fillCache caches v under key unless the entry is held or already set.
+func (s *userServiceImpl) fillCache(ctx context.Context, key string, v any) {
+	data, err := json.Marshal(v)
+	if err == nil {
+		s.redisClient.SetNX(ctx, key, data, 1*time.Minute) // Cache for 1 minute
+	}
+}
+
+// withEvents calls fn and appends the events it returns to the outbox in the
+// same transaction, so an event is stored if and only if its change is.
+func (s *userServiceImpl) withEvents(ctx context.Context, fn func(ctx context.Context) ([]event.Event, error)) error {
+	return s.txManager.WithinTx(ctx, func(ctx context.Context) error {
+		events, err := fn(ctx)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		return s.outbox.Append(ctx, events...)
+	})
+}
+
+// userEvent creates an event of the given type for a user change.
+func userEvent(eventType string, data any) ([]event.Event, error) {
+	e, err := event.New(eventType, data)
+	if err != nil {
+		return nil, err
+	}
+	return []event.Event{e}, nil
+}
+
+// GetUsers returns all users. Only reads of active users are cached, and
+// reads pinned to the primary bypass the cache to see their own writes.
+func (s *userServiceImpl) GetUsers(ctx context.Context, filter storage.UserFilter) ([]user.User, error) {
+	if filter.IncludeDeleted {
+		return s.repo.GetUsers(ctx, filter)
+	}
 	cacheKey := "all_users"
 
 	// Try to get from cache
-	val, err := s.redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
+	if val, ok := s.cachedValue(ctx, cacheKey); ok {
 		var users []user.User
 		if err := json.Unmarshal([]byte(val), &users); err == nil {
-			utils.Logger.Info("Cache hit for all users")
+			utils.LoggerFromContext(ctx).Info("Cache hit for all users")
 			return users, nil
 		}
 	}
 
 	// Get from DB
-	users, err := s.repo.GetUsers()
+	users, err := s.repo.GetUsers(ctx, filter)
 	if err != nil {
-		utils.Logger.Error(err.Error())
+		utils.LoggerFromContext(ctx).Error(err.Error())
 		return nil, err
 	}
 
 	// Store in cache
-	data, err := json.Marshal(users)
-	if err == nil {
-		s.redisClient.Set(ctx, cacheKey, data, 1*time.Minute) // Cache for 1 minute
-	}
+	s.fillCache(ctx, cacheKey, users)
 
 	return users, nil
 }
 
-// GetUser returns a user by ID.
-func (s *userServiceImpl) GetUser(id int) (*user.User, error) {
-	ctx := context.Background()
+// GetUser returns a user by ID. Only reads of active users are cached, and
+// reads pinned to the primary bypass the cache to see their own writes.
+func (s *userServiceImpl) GetUser(ctx context.Context, id int, filter storage.UserFilter) (*user.User, error) {
+	if filter.IncludeDeleted {
+		return s.repo.GetUser(ctx, id, filter)
+	}
 	cacheKey := fmt.Sprintf("user:%d", id)
 
 	// Try to get from cache
-	val, err := s.redisClient.Get(ctx, cacheKey).Result()
-	if err == nil {
+	if val, ok := s.cachedValue(ctx, cacheKey); ok {
 		var u user.User
 		if err := json.Unmarshal([]byte(val), &u); err == nil {
-			utils.Logger.Info("Cache hit for user", "id", id)
+			utils.LoggerFromContext(ctx).Info("Cache hit for user", "id", id)
 			return &u, nil
 		}
 	}
 
 	// Get from DB
-	u, err := s.repo.GetUser(id)
+	u, err := s.repo.GetUser(ctx, id, filter)
 	if err != nil {
-		utils.Logger.Error(err.Error())
+		utils.LoggerFromContext(ctx).Error(err.Error())
 		return nil, err
 	}
 
 	// Store in cache
-	data, err := json.Marshal(u)
-	if err == nil {
-		s.redisClient.Set(ctx, cacheKey, data, 1*time.Minute) // Cache for 1 minute
-	}
+	s.fillCache(ctx, cacheKey, u)
 
 	return u, nil
 }
 
+// cachedValue returns the cache entry of key. Contexts pinned to the primary
+// always miss.
+func (s *userServiceImpl) cachedValue(ctx context.Context, key string) (string, bool) {
+	if storage.UsesPrimary(ctx) {
+		return "", false
+	}
+	val, err := s.redisClient.Get(ctx, key).Result()
+	return val, err == nil
+}
+
+// GetUsersByIDs returns the users of ids in ID order, skipping unknown ones,
+// with a single query. It is meant for batched lookups, which are not
+// cached.
+func (s *userServiceImpl) GetUsersByIDs(ctx context.Context, ids []int, filter storage.UserFilter) ([]user.User, error) {
+	return s.repo.GetUsersByIDs(ctx, ids, filter)
+}
+
+// ListUsers returns a page of users in ID order. Pages are not cached.
+func (s *userServiceImpl) ListUsers(ctx context.Context, q storage.UserQuery) ([]user.User, error) {
+	return s.repo.ListUsers(ctx, q)
+}
+
+// CountUsers returns the number of users matching the filter and search of q.
+func (s *userServiceImpl) CountUsers(ctx context.Context, q storage.UserQuery) (int, error) {
+	return s.repo.CountUsers(ctx, q)
+}
+
 // CreateUser creates a new user.
-func (s *userServiceImpl) CreateUser(req *user.CreateUserRequest) (*user.User, error) {
-	createdUser, err := s.repo.CreateUser(req)
+func (s *userServiceImpl) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error) {
+	var createdUser *user.User
+	err := s.withEvents(ctx, func(ctx context.Context) ([]event.Event, error) {
+		var err error
+		if createdUser, err = s.repo.CreateUser(ctx, req); err != nil {
+			return nil, err
+		}
+		return userEvent(event.TypeUserCreated, createdUser)
+	})
 	if err != nil {
-		utils.Logger.Error(err.Error())
+		utils.LoggerFromContext(ctx).Error(err.Error())
 		return nil, err
 	}
 
 	// Invalidate cache for all users and the specific user
-	ctx := context.Background()
-	s.redisClient.Del(ctx, "all_users")
-	s.redisClient.Del(ctx, fmt.Sprintf("user:%d", createdUser.ID))
+	s.invalidate(ctx, "all_users", fmt.Sprintf("user:%d", createdUser.ID))
 
 	return createdUser, nil
 }
 
-// DeleteUser deletes a user by ID.
-func (s *userServiceImpl) DeleteUser(id int) error {
-	if err := s.repo.DeleteUser(id); err != nil {
-		utils.Logger.Error(err.Error())
+// ImportUsers creates a batch of users. The result is parallel to reqs and
+// holds nil for users whose email was already taken.
+func (s *userServiceImpl) ImportUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error) {
+	var users []*user.User
+	err := s.withEvents(ctx, func(ctx context.Context) ([]event.Event, error) {
+		var err error
+		if users, err = s.repo.CreateUsers(ctx, reqs); err != nil {
+			return nil, err
+		}
+		events := []event.Event{}
+		for _, u := range users {
+			if u == nil {
+				continue
+			}
+			e, err := event.New(event.TypeUserCreated, u)
+			if err != nil {
+				return nil, err
+			}
+			events = append(events, e)
+		}
+		return events, nil
+	})
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	// Invalidate cache for all users; new users have no cache entry yet
+	s.invalidate(ctx, "all_users")
+
+	return users, nil
+}
+
+// ExportUsers calls fn for every user, streamed from the database. The
+// cache is bypassed.
+func (s *userServiceImpl) ExportUsers(ctx context.Context, filter storage.UserFilter, fn func(u *user.User) error) error {
+	return s.repo.StreamUsers(ctx, filter, fn)
+}
+
+// UpdateUser replaces a user if its version is still expectedVersion, or
+// unconditionally if expectedVersion is 0.
+func (s *userServiceImpl) UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+	var updatedUser *user.User
+	err := s.withEvents(ctx, func(ctx context.Context) ([]event.Event, error) {
+		var err error
+		if updatedUser, err = s.repo.UpdateUser(ctx, id, req, expectedVersion); err != nil {
+			return nil, err
+		}
+		return userEvent(event.TypeUserUpdated, updatedUser)
+	})
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	// Invalidate cache for all users and the specific user
+	s.invalidate(ctx, "all_users", fmt.Sprintf("user:%d", id))
+
+	return updatedUser, nil
+}
+
+// DeleteUser soft-deletes a user by ID.
+func (s *userServiceImpl) DeleteUser(ctx context.Context, id int, expectedVersion int) error {
+	err := s.withEvents(ctx, func(ctx context.Context) ([]event.Event, error) {
+		if err := s.repo.DeleteUser(ctx, id, expectedVersion); err != nil {
+			return nil, err
+		}
+		return userEvent(event.TypeUserDeleted, event.UserDeleted{ID: id})
+	})
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
 		return err
 	}
 
 	// Invalidate cache for all users and the specific user
-	ctx := context.Background()
-	s.redisClient.Del(ctx, "all_users")
-	s.redisClient.Del(ctx, fmt.Sprintf("user:%d", id))
+	s.invalidate(ctx, "all_users", fmt.Sprintf("user:%d", id))
 
 	return nil
 }
+
+// RestoreUser undoes the soft deletion of a user.
+func (s *userServiceImpl) RestoreUser(ctx context.Context, id int) (*user.User, error) {
+	var u *user.User
+	err := s.withEvents(ctx, func(ctx context.Context) ([]event.Event, error) {
+		var err error
+		if u, err = s.repo.RestoreUser(ctx, id); err != nil {
+			return nil, err
+		}
+		return userEvent(event.TypeUserUpdated, u)
+	})
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+
+	// Invalidate cache for all users and the specific user
+	s.invalidate(ctx, "all_users", fmt.Sprintf("user:%d", id))
+
+	return u, nil
+}
+
+// PurgeUser permanently deletes a user by ID.
+func (s *userServiceImpl) PurgeUser(ctx context.Context, id int, expectedVersion int) error {
+	err := s.withEvents(ctx, func(ctx context.Context) ([]event.Event, error) {
+		if err := s.repo.PurgeUser(ctx, id, expectedVersion); err != nil {
+			return nil, err
+		}
+		return userEvent(event.TypeUserDeleted, event.UserDeleted{ID: id, Permanent: true})
+	})
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return err
+	}
+
+	// Invalidate cache for all users and the specific user
+	s.invalidate(ctx, "all_users", fmt.Sprintf("user:%d", id))
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently deletes the users soft-deleted before
+// before. They are not cached, so no cache entry is invalidated. No event
+// is emitted, as user.deleted was emitted when they were soft-deleted.
+func (s *userServiceImpl) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	return s.repo.PurgeDeletedUsers(ctx, before)
+}
+
+// WarmCache loads the active users into the cache of GetUsers.
+func (s *userServiceImpl) WarmCache(ctx context.Context) error {
+	users, err := s.repo.GetUsers(ctx, storage.UserFilter{})
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return err
+	}
+
+	data, err := json.Marshal(users)
+	if err != nil {
+		return err
+	}
+	return s.redisClient.Set(ctx, "all_users", data, 1*time.Minute).Err() // Cache for 1 minute
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/go-redis/redismock/v8"
+	"http-server/dto/event"
 	user "http-server/dto/user"
 	"http-server/storage"
 	"http-server/utils"
@@ -18,48 +20,124 @@ import (
 
 func TestMain(m *testing.M) {
 	// Initialize logger for tests
-	utils.InitLogger("debug")
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
 	// Run tests
 	os.Exit(m.Run())
 }
 
 // MockUserRepository is a mock implementation of the UserRepository interface.
 type MockUserRepository struct {
-	GetUsersFunc   func() ([]user.User, error)
-	GetUserFunc    func(id int) (*user.User, error)
-	CreateUserFunc func(user *user.CreateUserRequest) (*user.User, error)
-	DeleteUserFunc func(id int) error
+	GetUsersFunc          func() ([]user.User, error)
+	GetUserFunc           func(id int) (*user.User, error)
+	GetUsersByIDsFunc     func(ids []int) ([]user.User, error)
+	ListUsersFunc         func(q storage.UserQuery) ([]user.User, error)
+	CountUsersFunc        func(q storage.UserQuery) (int, error)
+	CreateUserFunc        func(user *user.CreateUserRequest) (*user.User, error)
+	CreateUsersFunc       func(reqs []user.CreateUserRequest) ([]*user.User, error)
+	StreamUsersFunc       func(fn func(u *user.User) error) error
+	UpdateUserFunc        func(id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error)
+	DeleteUserFunc        func(id int) error
+	RestoreUserFunc       func(id int) (*user.User, error)
+	PurgeUserFunc         func(id int) error
+	PurgeDeletedUsersFunc func(before time.Time) (int64, error)
 }
 
-func (m *MockUserRepository) GetUsers() ([]user.User, error) {
+func (m *MockUserRepository) GetUsers(ctx context.Context, filter storage.UserFilter) ([]user.User, error) {
 	if m.GetUsersFunc != nil {
 		return m.GetUsersFunc()
 	}
 	return nil, errors.New("GetUsersFunc not implemented")
 }
 
-func (m *MockUserRepository) GetUser(id int) (*user.User, error) {
+func (m *MockUserRepository) GetUser(ctx context.Context, id int, filter storage.UserFilter) (*user.User, error) {
 	if m.GetUserFunc != nil {
 		return m.GetUserFunc(id)
 	}
 	return nil, errors.New("GetUserFunc not implemented")
 }
 
-func (m *MockUserRepository) CreateUser(req *user.CreateUserRequest) (*user.User, error) {
+func (m *MockUserRepository) GetUsersByIDs(ctx context.Context, ids []int, filter storage.UserFilter) ([]user.User, error) {
+	if m.GetUsersByIDsFunc != nil {
+		return m.GetUsersByIDsFunc(ids)
+	}
+	return nil, errors.New("GetUsersByIDsFunc not implemented")
+}
+
+func (m *MockUserRepository) ListUsers(ctx context.Context, q storage.UserQuery) ([]user.User, error) {
+	if m.ListUsersFunc != nil {
+		return m.ListUsersFunc(q)
+	}
+	return nil, errors.New("ListUsersFunc not implemented")
+}
+
+func (m *MockUserRepository) CountUsers(ctx context.Context, q storage.UserQuery) (int, error) {
+	if m.CountUsersFunc != nil {
+		return m.CountUsersFunc(q)
+	}
+	return 0, errors.New("CountUsersFunc not implemented")
+}
+
+func (m *MockUserRepository) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error) {
 	if m.CreateUserFunc != nil {
 		return m.CreateUserFunc(req)
 	}
 	return nil, errors.New("CreateUserFunc not implemented")
 }
 
-func (m *MockUserRepository) DeleteUser(id int) error {
+func (m *MockUserRepository) CreateUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error) {
+	if m.CreateUsersFunc != nil {
+		return m.CreateUsersFunc(reqs)
+	}
+	return nil, errors.New("CreateUsersFunc not implemented")
+}
+
+func (m *MockUserRepository) StreamUsers(ctx context.Context, filter storage.UserFilter, fn func(u *user.User) error) error {
+	if m.StreamUsersFunc != nil {
+		return m.StreamUsersFunc(fn)
+	}
+	return errors.New("StreamUsersFunc not implemented")
+}
+
+func (m *MockUserRepository) UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+	if m.UpdateUserFunc != nil {
+		return m.UpdateUserFunc(id, req, expectedVersion)
+	}
+	return nil, errors.New("UpdateUserFunc not implemented")
+}
+
+func (m *MockUserRepository) DeleteUser(ctx context.Context, id int, expectedVersion int) error {
 	if m.DeleteUserFunc != nil {
 		return m.DeleteUserFunc(id)
 	}
 	return errors.New("DeleteUserFunc not implemented")
 }
 
+func (m *MockUserRepository) RestoreUser(ctx context.Context, id int) (*user.User, error) {
+	if m.RestoreUserFunc != nil {
+		return m.RestoreUserFunc(id)
+	}
+	return nil, errors.New("RestoreUserFunc not implemented")
+}
+
+func (m *MockUserRepository) PurgeUser(ctx context.Context, id int, expectedVersion int) error {
+	if m.PurgeUserFunc != nil {
+		return m.PurgeUserFunc(id)
+	}
+	return errors.New("PurgeUserFunc not implemented")
+}
+
+func (m *MockUserRepository) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	if m.PurgeDeletedUsersFunc != nil {
+		return m.PurgeDeletedUsersFunc(before)
+	}
+	return 0, errors.New("PurgeDeletedUsersFunc not implemented")
+}
+
 func TestGetUsers(t *testing.T) {
+	ctx := context.Background()
+
 	t.Run("should return users from cache when cache hit", func(t *testing.T) {
 		// Arrange
 		expectedUsers := []user.User{{ID: 1, Name: "Test User", Email: "test@example.com"}}
@@ -71,10 +149,10 @@ func TestGetUsers(t *testing.T) {
 		mock.ExpectGet("all_users").SetVal(string(usersJSON))
 
 		repo := &MockUserRepository{}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		users, err := service.GetUsers()
+		users, err := service.GetUsers(ctx, storage.UserFilter{})
 
 		// Assert
 		assert.NoError(t, err)
@@ -91,17 +169,17 @@ func TestGetUsers(t *testing.T) {
 		redisClient := &storage.RedisClient{Client: db}
 
 		mock.ExpectGet("all_users").RedisNil()
-		mock.ExpectSet("all_users", usersJSON, 1*time.Minute).SetVal("OK")
+		mock.ExpectSetNX("all_users", usersJSON, 1*time.Minute).SetVal(true)
 
 		repo := &MockUserRepository{
 			GetUsersFunc: func() ([]user.User, error) {
 				return expectedUsers, nil
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		users, err := service.GetUsers()
+		users, err := service.GetUsers(ctx, storage.UserFilter{})
 
 		// Assert
 		assert.NoError(t, err)
@@ -123,10 +201,10 @@ func TestGetUsers(t *testing.T) {
 				return nil, dbErr
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		users, err := service.GetUsers()
+		users, err := service.GetUsers(ctx, storage.UserFilter{})
 
 		// Assert
 		assert.Error(t, err)
@@ -137,6 +215,7 @@ func TestGetUsers(t *testing.T) {
 }
 
 func TestGetUser(t *testing.T) {
+	ctx := context.Background()
 	userID := 1
 	cacheKey := fmt.Sprintf("user:%d", userID)
 
@@ -151,10 +230,10 @@ func TestGetUser(t *testing.T) {
 		mock.ExpectGet(cacheKey).SetVal(string(userJSON))
 
 		repo := &MockUserRepository{}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		u, err := service.GetUser(userID)
+		u, err := service.GetUser(ctx, userID, storage.UserFilter{})
 
 		// Assert
 		assert.NoError(t, err)
@@ -171,7 +250,7 @@ func TestGetUser(t *testing.T) {
 		redisClient := &storage.RedisClient{Client: db}
 
 		mock.ExpectGet(cacheKey).RedisNil()
-		mock.ExpectSet(cacheKey, userJSON, 1*time.Minute).SetVal("OK")
+		mock.ExpectSetNX(cacheKey, userJSON, 1*time.Minute).SetVal(true)
 
 		repo := &MockUserRepository{
 			GetUserFunc: func(id int) (*user.User, error) {
@@ -179,10 +258,10 @@ func TestGetUser(t *testing.T) {
 				return expectedUser, nil
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		u, err := service.GetUser(userID)
+		u, err := service.GetUser(ctx, userID, storage.UserFilter{})
 
 		// Assert
 		assert.NoError(t, err)
@@ -204,10 +283,10 @@ func TestGetUser(t *testing.T) {
 				return nil, dbErr
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		u, err := service.GetUser(userID)
+		u, err := service.GetUser(ctx, userID, storage.UserFilter{})
 
 		// Assert
 		assert.Error(t, err)
@@ -215,9 +294,65 @@ func TestGetUser(t *testing.T) {
 		assert.Equal(t, dbErr, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
+
+	t.Run("should bypass the cache for contexts pinned to the primary", func(t *testing.T) {
+		// Arrange
+		freshUser := &user.User{ID: userID, Name: "Renamed User", Email: "test@example.com", Version: 2}
+		freshJSON, _ := json.Marshal(freshUser)
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		// A stale entry is cached, so the entry is not replaced
+		mock.ExpectSetNX(cacheKey, freshJSON, 1*time.Minute).SetVal(false)
+
+		repo := &MockUserRepository{
+			GetUserFunc: func(id int) (*user.User, error) {
+				return freshUser, nil
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		u, err := service.GetUser(storage.WithPrimary(ctx), userID, storage.UserFilter{})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, freshUser, u)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should read held entries from db without refilling them", func(t *testing.T) {
+		// Arrange
+		staleUser := &user.User{ID: userID, Name: "Test User", Email: "test@example.com", Version: 1}
+		staleJSON, _ := json.Marshal(staleUser)
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		mock.ExpectGet(cacheKey).SetVal(cacheHold)
+		mock.ExpectSetNX(cacheKey, staleJSON, 1*time.Minute).SetVal(false)
+
+		repo := &MockUserRepository{
+			GetUserFunc: func(id int) (*user.User, error) {
+				// A lagging replica still returns the user from before the write
+				return staleUser, nil
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		u, err := service.GetUser(ctx, userID, storage.UserFilter{})
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, staleUser, u)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
 }
 
 func TestCreateUser(t *testing.T) {
+	ctx := context.Background()
 	createUserReq := &user.CreateUserRequest{Name: "New User", Email: "new@example.com"}
 	createdUser := &user.User{ID: 2, Name: "New User", Email: "new@example.com"}
 
@@ -226,8 +361,8 @@ func TestCreateUser(t *testing.T) {
 		db, mock := redismock.NewClientMock()
 		redisClient := &storage.RedisClient{Client: db}
 
-		mock.ExpectDel("all_users").SetVal(1)
-		mock.ExpectDel(fmt.Sprintf("user:%d", createdUser.ID)).SetVal(1)
+		mock.ExpectSet("all_users", cacheHold, cacheHoldPeriod).SetVal("OK")
+		mock.ExpectSet(fmt.Sprintf("user:%d", createdUser.ID), cacheHold, cacheHoldPeriod).SetVal("OK")
 
 		repo := &MockUserRepository{
 			CreateUserFunc: func(req *user.CreateUserRequest) (*user.User, error) {
@@ -235,15 +370,23 @@ func TestCreateUser(t *testing.T) {
 				return createdUser, nil
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		outbox := storage.NewMemoryOutboxRepository()
+		service := NewUserService(repo, outbox, storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		u, err := service.CreateUser(createUserReq)
+		u, err := service.CreateUser(ctx, createUserReq)
 
 		// Assert
 		assert.NoError(t, err)
 		assert.Equal(t, createdUser, u)
 		assert.NoError(t, mock.ExpectationsWereMet())
+		events, err := outbox.Pending(ctx, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, event.TypeUserCreated, events[0].Type)
+			assert.NotEmpty(t, events[0].ID)
+			assert.JSONEq(t, `{"id":2,"name":"New User","email":"new@example.com","version":0}`, string(events[0].Data))
+		}
 	})
 
 	t.Run("should return error when db fails", func(t *testing.T) {
@@ -258,20 +401,143 @@ func TestCreateUser(t *testing.T) {
 				return nil, dbErr
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		outbox := storage.NewMemoryOutboxRepository()
+		service := NewUserService(repo, outbox, storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		u, err := service.CreateUser(createUserReq)
+		u, err := service.CreateUser(ctx, createUserReq)
 
 		// Assert
 		assert.Error(t, err)
 		assert.Nil(t, u)
 		assert.Equal(t, dbErr, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
+		events, err := outbox.Pending(ctx, 10)
+		assert.NoError(t, err)
+		assert.Empty(t, events)
+	})
+}
+
+func TestImportUsers(t *testing.T) {
+	ctx := context.Background()
+	reqs := []user.CreateUserRequest{
+		{Name: "Alice", Email: "alice@example.com"},
+		{Name: "Bob", Email: "taken@example.com"},
+	}
+
+	t.Run("should import users and invalidate cache", func(t *testing.T) {
+		// Arrange
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		mock.ExpectSet("all_users", cacheHold, cacheHoldPeriod).SetVal("OK")
+
+		created := []*user.User{{ID: 1, Name: "Alice", Email: "alice@example.com", Version: 1}, nil}
+		repo := &MockUserRepository{
+			CreateUsersFunc: func(got []user.CreateUserRequest) ([]*user.User, error) {
+				assert.Equal(t, reqs, got)
+				return created, nil
+			},
+		}
+		outbox := storage.NewMemoryOutboxRepository()
+		service := NewUserService(repo, outbox, storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		users, err := service.ImportUsers(ctx, reqs)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, created, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+		events, err := outbox.Pending(ctx, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, event.TypeUserCreated, events[0].Type)
+		}
+	})
+
+	t.Run("should return error without touching the cache when db fails", func(t *testing.T) {
+		// Arrange
+		dbErr := errors.New("database error")
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		repo := &MockUserRepository{
+			CreateUsersFunc: func(got []user.CreateUserRequest) ([]*user.User, error) {
+				return nil, dbErr
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		users, err := service.ImportUsers(ctx, reqs)
+
+		// Assert
+		assert.Equal(t, dbErr, err)
+		assert.Nil(t, users)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestUpdateUser(t *testing.T) {
+	ctx := context.Background()
+	userID := 1
+	updateUserReq := &user.UpdateUserRequest{Name: "New Name", Email: "new@example.com"}
+
+	t.Run("should update user and invalidate cache", func(t *testing.T) {
+		// Arrange
+		expectedUser := &user.User{ID: userID, Name: "New Name", Email: "new@example.com", Version: 3}
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		mock.ExpectSet("all_users", cacheHold, cacheHoldPeriod).SetVal("OK")
+		mock.ExpectSet(fmt.Sprintf("user:%d", userID), cacheHold, cacheHoldPeriod).SetVal("OK")
+
+		repo := &MockUserRepository{
+			UpdateUserFunc: func(id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+				assert.Equal(t, userID, id)
+				assert.Equal(t, updateUserReq, req)
+				assert.Equal(t, 2, expectedVersion)
+				return expectedUser, nil
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		u, err := service.UpdateUser(ctx, userID, updateUserReq, 2)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUser, u)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return version mismatch without touching the cache", func(t *testing.T) {
+		// Arrange
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		repo := &MockUserRepository{
+			UpdateUserFunc: func(id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+				return nil, storage.ErrVersionMismatch
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		u, err := service.UpdateUser(ctx, userID, updateUserReq, 1)
+
+		// Assert
+		assert.ErrorIs(t, err, storage.ErrVersionMismatch)
+		assert.Nil(t, u)
+		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
 
 func TestDeleteUser(t *testing.T) {
+	ctx := context.Background()
 	userID := 1
 
 	t.Run("should delete user and invalidate cache", func(t *testing.T) {
@@ -279,8 +545,8 @@ func TestDeleteUser(t *testing.T) {
 		db, mock := redismock.NewClientMock()
 		redisClient := &storage.RedisClient{Client: db}
 
-		mock.ExpectDel("all_users").SetVal(1)
-		mock.ExpectDel(fmt.Sprintf("user:%d", userID)).SetVal(1)
+		mock.ExpectSet("all_users", cacheHold, cacheHoldPeriod).SetVal("OK")
+		mock.ExpectSet(fmt.Sprintf("user:%d", userID), cacheHold, cacheHoldPeriod).SetVal("OK")
 
 		repo := &MockUserRepository{
 			DeleteUserFunc: func(id int) error {
@@ -288,14 +554,21 @@ func TestDeleteUser(t *testing.T) {
 				return nil
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		outbox := storage.NewMemoryOutboxRepository()
+		service := NewUserService(repo, outbox, storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		err := service.DeleteUser(userID)
+		err := service.DeleteUser(ctx, userID, 0)
 
 		// Assert
 		assert.NoError(t, err)
 		assert.NoError(t, mock.ExpectationsWereMet())
+		events, err := outbox.Pending(ctx, 10)
+		assert.NoError(t, err)
+		if assert.Len(t, events, 1) {
+			assert.Equal(t, event.TypeUserDeleted, events[0].Type)
+			assert.JSONEq(t, `{"id":1,"permanent":false}`, string(events[0].Data))
+		}
 	})
 
 	t.Run("should return error when db fails", func(t *testing.T) {
@@ -310,10 +583,10 @@ func TestDeleteUser(t *testing.T) {
 				return dbErr
 			},
 		}
-		service := NewUserService(repo, redisClient)
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
 
 		// Act
-		err := service.DeleteUser(userID)
+		err := service.DeleteUser(ctx, userID, 0)
 
 		// Assert
 		assert.Error(t, err)
@@ -321,3 +594,107 @@ func TestDeleteUser(t *testing.T) {
 		assert.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+func TestRestoreUser(t *testing.T) {
+	ctx := context.Background()
+	userID := 1
+
+	t.Run("should restore user and invalidate cache", func(t *testing.T) {
+		// Arrange
+		expectedUser := &user.User{ID: userID, Name: "Test User", Email: "test@example.com"}
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		mock.ExpectSet("all_users", cacheHold, cacheHoldPeriod).SetVal("OK")
+		mock.ExpectSet(fmt.Sprintf("user:%d", userID), cacheHold, cacheHoldPeriod).SetVal("OK")
+
+		repo := &MockUserRepository{
+			RestoreUserFunc: func(id int) (*user.User, error) {
+				assert.Equal(t, userID, id)
+				return expectedUser, nil
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		u, err := service.RestoreUser(ctx, userID)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, expectedUser, u)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should not touch the cache when the email was taken", func(t *testing.T) {
+		// Arrange
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		repo := &MockUserRepository{
+			RestoreUserFunc: func(id int) (*user.User, error) {
+				return nil, storage.ErrEmailTaken
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		u, err := service.RestoreUser(ctx, userID)
+
+		// Assert
+		assert.ErrorIs(t, err, storage.ErrEmailTaken)
+		assert.Nil(t, u)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
+
+func TestWarmCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should cache the users from db", func(t *testing.T) {
+		// Arrange
+		expectedUsers := []user.User{{ID: 1, Name: "Test User", Email: "test@example.com"}}
+		expectedUsersJSON, _ := json.Marshal(expectedUsers)
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		mock.ExpectSet("all_users", expectedUsersJSON, 1*time.Minute).SetVal("OK")
+
+		repo := &MockUserRepository{
+			GetUsersFunc: func() ([]user.User, error) {
+				return expectedUsers, nil
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		err := service.WarmCache(ctx)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+
+	t.Run("should return error when db fails", func(t *testing.T) {
+		// Arrange
+		dbErr := errors.New("database error")
+
+		db, mock := redismock.NewClientMock()
+		redisClient := &storage.RedisClient{Client: db}
+
+		repo := &MockUserRepository{
+			GetUsersFunc: func() ([]user.User, error) {
+				return nil, dbErr
+			},
+		}
+		service := NewUserService(repo, storage.NewMemoryOutboxRepository(), storage.NewNoopTxManager(), redisClient)
+
+		// Act
+		err := service.WarmCache(ctx)
+
+		// Assert
+		assert.Equal(t, dbErr, err)
+		assert.NoError(t, mock.ExpectationsWereMet())
+	})
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"http-server/utils"
+)
+
+// PurgeDeletedUsersTask returns a scheduler task permanently deleting the
+// users that have been soft-deleted for longer than retention. A zero
+// retention keeps soft-deleted users forever.
+func PurgeDeletedUsersTask(service UserService, retention time.Duration) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if retention <= 0 {
+			return nil
+		}
+		n, err := service.PurgeDeletedUsers(ctx, time.Now().Add(-retention))
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			utils.LoggerFromContext(ctx).Info("Purged deleted users", "count", n, "retention", retention.String())
+		}
+		return nil
+	}
+}
+
+// WarmUserCacheTask returns a scheduler task refreshing the cached list of
+// users, so that reads rarely miss the cache.
+func WarmUserCacheTask(service UserService) func(ctx context.Context) error {
+	return service.WarmCache
+}
@@ -0,0 +1,21 @@
+package services
+
+import (
+	"context"
+	"http-server/dto/webhook"
+	"http-server/storage"
+)
+
+type WebhookService interface {
+	GetWebhooks(ctx context.Context) ([]webhook.Webhook, error)
+	GetWebhook(ctx context.Context, id int) (*webhook.Webhook, error)
+	CreateWebhook(ctx context.Context, req *webhook.CreateWebhookRequest) (*webhook.Webhook, error)
+	UpdateWebhook(ctx context.Context, id int, req *webhook.UpdateWebhookRequest) (*webhook.Webhook, error)
+	DeleteWebhook(ctx context.Context, id int) error
+	GetDeliveries(ctx context.Context, id int, limit int) ([]webhook.Delivery, error)
+}
+
+// NewWebhookService creates a new WebhookService.
+func NewWebhookService(repo storage.WebhookRepository) WebhookService {
+	return &webhookServiceImpl{repo: repo}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"http-server/dto/webhook"
+	"http-server/storage"
+	"http-server/utils"
+)
+
+// secretPrefix marks generated webhook secrets, so that they are easy to
+// recognise in configuration files and leak scanners.
+const secretPrefix = "whsec_"
+
+// webhookServiceImpl provides webhook-related business logic.
+type webhookServiceImpl struct {
+	repo storage.WebhookRepository
+}
+
+// GetWebhooks returns all webhooks.
+func (s *webhookServiceImpl) GetWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	webhooks, err := s.repo.GetWebhooks(ctx)
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return webhooks, nil
+}
+
+// GetWebhook returns a webhook by ID.
+func (s *webhookServiceImpl) GetWebhook(ctx context.Context, id int) (*webhook.Webhook, error) {
+	w, err := s.repo.GetWebhook(ctx, id)
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return w, nil
+}
+
+// CreateWebhook creates a webhook, generating its secret unless req has
+// one.
+func (s *webhookServiceImpl) CreateWebhook(ctx context.Context, req *webhook.CreateWebhookRequest) (*webhook.Webhook, error) {
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		req.Secret = secretPrefix + hex.EncodeToString(secret)
+	}
+	w, err := s.repo.CreateWebhook(ctx, req)
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return w, nil
+}
+
+// UpdateWebhook replaces a webhook.
+func (s *webhookServiceImpl) UpdateWebhook(ctx context.Context, id int, req *webhook.UpdateWebhookRequest) (*webhook.Webhook, error) {
+	w, err := s.repo.UpdateWebhook(ctx, id, req)
+	if err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return nil, err
+	}
+	return w, nil
+}
+
+// DeleteWebhook deletes a webhook by ID. Its pending deliveries are
+// dropped.
+func (s *webhookServiceImpl) DeleteWebhook(ctx context.Context, id int) error {
+	if err := s.repo.DeleteWebhook(ctx, id); err != nil {
+		utils.LoggerFromContext(ctx).Error(err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetDeliveries returns the latest deliveries of a webhook, newest first.
+func (s *webhookServiceImpl) GetDeliveries(ctx context.Context, id int, limit int) ([]webhook.Delivery, error) {
+	if _, err := s.repo.GetWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.GetDeliveries(ctx, id, limit)
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"http-server/dto/webhook"
+	"http-server/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should generate a secret when none is given", func(t *testing.T) {
+		// Arrange
+		service := NewWebhookService(storage.NewMemoryWebhookRepository())
+
+		// Act
+		first, err1 := service.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: "https://example.com/hook"})
+		second, err2 := service.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: "https://example.com/hook"})
+
+		// Assert
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.Regexp(t, `^whsec_[0-9a-f]{64}$`, first.Secret)
+		assert.NotEqual(t, first.Secret, second.Secret)
+	})
+
+	t.Run("should keep the given secret", func(t *testing.T) {
+		// Arrange
+		service := NewWebhookService(storage.NewMemoryWebhookRepository())
+
+		// Act
+		created, err := service.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: "https://example.com/hook", Secret: "shared"})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "shared", created.Secret)
+	})
+}
+
+func TestGetDeliveries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should return ErrWebhookNotFound for unknown webhooks", func(t *testing.T) {
+		// Arrange
+		service := NewWebhookService(storage.NewMemoryWebhookRepository())
+
+		// Act
+		deliveries, err := service.GetDeliveries(ctx, 42, 10)
+
+		// Assert
+		assert.ErrorIs(t, err, storage.ErrWebhookNotFound)
+		assert.Nil(t, deliveries)
+	})
+}
@@ -4,17 +4,179 @@ import (
 	"context"
 	"fmt"
 	"http-server/config"
+	"http-server/utils"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-// InitDB initializes the database connection.
-func InitDB(cfg *config.DatabaseConfig) (*pgxpool.Pool, error) {
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%d/%s?sslmode=disable", cfg.User, cfg.Password, cfg.Host, cfg.Port, cfg.DBName)
-	pool, err := pgxpool.Connect(context.Background(), connStr)
+const defaultReplicaHealthCheckPeriod = 10 * time.Second
+
+// DB routes queries between the primary pool and its read replicas.
+type DB struct {
+	Primary  *pgxpool.Pool
+	replicas []*replica
+	next     atomic.Uint64
+	stop     context.CancelFunc
+}
+
+type replica struct {
+	name    string
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// InitDB initializes the connection pools of the primary and of every
+// configured read replica. It fails when the primary is unreachable, while
+// unreachable replicas start ejected until a health check reaches them.
+func InitDB(cfg *config.DatabaseConfig) (*DB, error) {
+	primary, err := newPool(cfg.ConnString(), &cfg.Pool, false)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{Primary: primary}
+
+	period := cfg.ReplicaHealthCheckPeriod
+	if period <= 0 {
+		period = defaultReplicaHealthCheckPeriod
+	}
+	for i, dsn := range cfg.Replicas {
+		pool, err := newPool(dsn, &cfg.Pool, true)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("replica %d: %w", i, err)
+		}
+		r := &replica{name: "replica_" + strconv.Itoa(i), pool: pool}
+		pingCtx, cancel := context.WithTimeout(context.Background(), period/2)
+		err = pool.Ping(pingCtx)
+		cancel()
+		if err != nil {
+			utils.Logger.Warn("Database replica ejected", "replica", r.name, "error", err)
+		}
+		r.healthy.Store(err == nil)
+		db.replicas = append(db.replicas, r)
+	}
+
+	if len(db.replicas) > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		db.stop = cancel
+		go db.checkReplicas(ctx, period)
+	}
+
+	return db, nil
+}
+
+// newPool opens a pool on connStr. A lazy pool connects on first use
+// instead of failing when the database is unreachable.
+func newPool(connStr string, cfg *config.PoolConfig, lazy bool) (*pgxpool.Pool, error) {
+	poolCfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	if cfg.MaxConns > 0 {
+		poolCfg.MaxConns = cfg.MaxConns
+	}
+	if cfg.MinConns > 0 {
+		poolCfg.MinConns = cfg.MinConns
+	}
+	if cfg.MaxConnLifetime > 0 {
+		poolCfg.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+	if cfg.MaxConnIdleTime > 0 {
+		poolCfg.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+	if cfg.HealthCheckPeriod > 0 {
+		poolCfg.HealthCheckPeriod = cfg.HealthCheckPeriod
+	}
+
+	poolCfg.LazyConnect = lazy
+
+	pool, err := pgxpool.ConnectConfig(context.Background(), poolCfg)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
 
 	return pool, nil
 }
+
+// Reader returns the pool reads should use: the next healthy replica in
+// round-robin order, or the primary when ctx is pinned to it or no replica
+// is healthy.
+func (db *DB) Reader(ctx context.Context) *pgxpool.Pool {
+	if len(db.replicas) == 0 || UsesPrimary(ctx) {
+		return db.Primary
+	}
+	start := db.next.Add(1)
+	for i := range uint64(len(db.replicas)) {
+		r := db.replicas[(start+i)%uint64(len(db.replicas))]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+	return db.Primary
+}
+
+// PoolStatsCollectors returns a metrics collector for every pool.
+func (db *DB) PoolStatsCollectors() []*PoolStatsCollector {
+	collectors := []*PoolStatsCollector{NewPoolStatsCollector("primary", db.Primary)}
+	for _, r := range db.replicas {
+		collectors = append(collectors, NewPoolStatsCollector(r.name, r.pool))
+	}
+	return collectors
+}
+
+// Close stops the replica health checks and closes every pool.
+func (db *DB) Close() {
+	if db.stop != nil {
+		db.stop()
+	}
+	for _, r := range db.replicas {
+		r.pool.Close()
+	}
+	db.Primary.Close()
+}
+
+// checkReplicas periodically pings every replica, ejecting unreachable ones
+// from the read rotation until they recover.
+func (db *DB) checkReplicas(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range db.replicas {
+			pingCtx, cancel := context.WithTimeout(ctx, period/2)
+			err := r.pool.Ping(pingCtx)
+			cancel()
+
+			healthy := err == nil
+			if r.healthy.Swap(healthy) != healthy {
+				if healthy {
+					utils.Logger.Info("Database replica recovered", "replica", r.name)
+				} else {
+					utils.Logger.Warn("Database replica ejected", "replica", r.name, "error", err)
+				}
+			}
+		}
+	}
+}
+
+type primaryCtxKey struct{}
+
+// WithPrimary returns a copy of ctx whose reads are routed to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryCtxKey{}, true)
+}
+
+// UsesPrimary reports whether the reads of ctx are routed to the primary.
+func UsesPrimary(ctx context.Context) bool {
+	pinned, _ := ctx.Value(primaryCtxKey{}).(bool)
+	return pinned
+}
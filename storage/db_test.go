@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/utils"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+// newUnreachablePool returns a pool that connects lazily to a port nothing
+// listens on, so that every ping fails.
+func newUnreachablePool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	cfg, err := pgxpool.ParseConfig("postgres://postgres@127.0.0.1:1/postgres?connect_timeout=1")
+	require.NoError(t, err)
+	cfg.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), cfg)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// newTestDB returns a DB over unreachable pools with the given number of
+// replicas, all healthy.
+func newTestDB(t *testing.T, replicas int) *DB {
+	t.Helper()
+	db := &DB{Primary: newUnreachablePool(t)}
+	for range replicas {
+		r := &replica{name: "replica", pool: newUnreachablePool(t)}
+		r.healthy.Store(true)
+		db.replicas = append(db.replicas, r)
+	}
+	return db
+}
+
+func TestInitDB(t *testing.T) {
+	t.Run("should start with an unreachable replica ejected", func(t *testing.T) {
+		// Arrange
+		url := os.Getenv("TEST_DATABASE_URL")
+		if url == "" {
+			t.Skip("TEST_DATABASE_URL is not set")
+		}
+		primary, err := pgxpool.ParseConfig(url)
+		require.NoError(t, err)
+		cfg := &config.DatabaseConfig{
+			Host:     primary.ConnConfig.Host,
+			Port:     int(primary.ConnConfig.Port),
+			User:     primary.ConnConfig.User,
+			Password: primary.ConnConfig.Password,
+			DBName:   primary.ConnConfig.Database,
+			Replicas: []string{"postgres://postgres@127.0.0.1:1/postgres?connect_timeout=1"},
+		}
+
+		// Act
+		db, err := InitDB(cfg)
+
+		// Assert
+		require.NoError(t, err)
+		t.Cleanup(db.Close)
+		require.Len(t, db.replicas, 1)
+		assert.False(t, db.replicas[0].healthy.Load())
+		assert.Same(t, db.Primary, db.Reader(context.Background()))
+	})
+}
+
+func TestDBReader(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should use the primary without replicas", func(t *testing.T) {
+		// Arrange
+		db := newTestDB(t, 0)
+
+		// Act
+		reader := db.Reader(ctx)
+
+		// Assert
+		assert.Same(t, db.Primary, reader)
+	})
+
+	t.Run("should rotate reads across replicas", func(t *testing.T) {
+		// Arrange
+		db := newTestDB(t, 3)
+
+		// Act
+		var readers []*pgxpool.Pool
+		for range 6 {
+			readers = append(readers, db.Reader(ctx))
+		}
+
+		// Assert
+		first, second, third := db.replicas[1].pool, db.replicas[2].pool, db.replicas[0].pool
+		assert.Equal(t, []*pgxpool.Pool{first, second, third, first, second, third}, readers)
+	})
+
+	t.Run("should skip unhealthy replicas", func(t *testing.T) {
+		// Arrange
+		db := newTestDB(t, 3)
+		db.replicas[1].healthy.Store(false)
+
+		// Act
+		var readers []*pgxpool.Pool
+		for range 3 {
+			readers = append(readers, db.Reader(ctx))
+		}
+
+		// Assert
+		healthy0, healthy2 := db.replicas[0].pool, db.replicas[2].pool
+		assert.Equal(t, []*pgxpool.Pool{healthy2, healthy2, healthy0}, readers)
+	})
+
+	t.Run("should fall back to the primary when every replica is unhealthy", func(t *testing.T) {
+		// Arrange
+		db := newTestDB(t, 2)
+		for _, r := range db.replicas {
+			r.healthy.Store(false)
+		}
+
+		// Act
+		reader := db.Reader(ctx)
+
+		// Assert
+		assert.Same(t, db.Primary, reader)
+	})
+
+	t.Run("should use the primary for contexts pinned to it", func(t *testing.T) {
+		// Arrange
+		db := newTestDB(t, 2)
+
+		// Act
+		reader := db.Reader(WithPrimary(ctx))
+
+		// Assert
+		assert.Same(t, db.Primary, reader)
+	})
+}
+
+func TestDBCheckReplicas(t *testing.T) {
+	t.Run("should eject unreachable replicas and route reads to the primary", func(t *testing.T) {
+		// Arrange
+		db := newTestDB(t, 2)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+
+		// Act
+		go func() {
+			defer close(done)
+			db.checkReplicas(ctx, 50*time.Millisecond)
+		}()
+
+		// Assert
+		assert.Eventually(t, func() bool {
+			return !db.replicas[0].healthy.Load() && !db.replicas[1].healthy.Load()
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Same(t, db.Primary, db.Reader(context.Background()))
+		cancel()
+		<-done
+	})
+}
@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+var (
+	// ErrEmailTaken is returned when creating a user whose email already exists.
+	ErrEmailTaken = errors.New("email already taken")
+	// ErrUserNotFound is returned when no user has the requested ID.
+	ErrUserNotFound = errors.New("user not found")
+	// ErrVersionMismatch is returned when a write expects a version of the
+	// user other than its current one.
+	ErrVersionMismatch = errors.New("user version mismatch")
+	// ErrWebhookNotFound is returned when no webhook has the requested ID.
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// uniqueViolation is the PostgreSQL SQLSTATE for unique constraint violations.
+const uniqueViolation = "23505"
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == uniqueViolation
+	}
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
@@ -0,0 +1,29 @@
+package storage
+
+import (
+	"context"
+	"http-server/dto/event"
+	"time"
+)
+
+// OutboxRepository stores domain events until the outbox relay has
+// published them. Appending events with the context of a TxManager.WithinTx
+// call commits them together with the change they describe.
+type OutboxRepository interface {
+	// Append adds events to the outbox.
+	Append(ctx context.Context, events ...event.Event) error
+	// Pending returns up to limit unsent events in the order they were
+	// appended. Within a transaction, PostgreSQL keeps them locked until it
+	// ends, so concurrent relays do not publish them twice.
+	Pending(ctx context.Context, limit int) ([]event.Event, error)
+	// MarkSent marks the events with the given IDs as published.
+	MarkSent(ctx context.Context, ids []string) error
+	// PurgeSent deletes the events published before the given time and
+	// returns how many were deleted.
+	PurgeSent(ctx context.Context, before time.Time) (int64, error)
+}
+
+// NewOutboxRepository creates the PostgreSQL OutboxRepository.
+func NewOutboxRepository(db *DB) OutboxRepository {
+	return &outboxRepositoryImpl{db: db}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"http-server/dto/event"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// outboxRepositoryImpl is the PostgreSQL implementation of the
+// OutboxRepository. It always uses the primary, and the transaction of ctx
+// when there is one.
+type outboxRepositoryImpl struct {
+	db *DB
+}
+
+// Append inserts events with a single batch of statements.
+func (r *outboxRepositoryImpl) Append(ctx context.Context, events ...event.Event) error {
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		batch.Queue("INSERT INTO outbox (event_id, type, data, occurred_at) VALUES ($1, $2, $3, $4)", e.ID, e.Type, []byte(e.Data), e.OccurredAt)
+	}
+	return r.db.writer(ctx).SendBatch(ctx, batch).Close()
+}
+
+// Pending selects the oldest unsent events FOR UPDATE.
+func (r *outboxRepositoryImpl) Pending(ctx context.Context, limit int) ([]event.Event, error) {
+	rows, err := r.db.writer(ctx).Query(ctx, "SELECT event_id::text, type, data, occurred_at FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []event.Event{}
+	for rows.Next() {
+		var e event.Event
+		var data []byte
+		if err := rows.Scan(&e.ID, &e.Type, &data, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		e.Data = data
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// MarkSent sets the sending time of events.
+func (r *outboxRepositoryImpl) MarkSent(ctx context.Context, ids []string) error {
+	_, err := r.db.writer(ctx).Exec(ctx, "UPDATE outbox SET sent_at = $1 WHERE event_id = ANY($2::uuid[])", time.Now().UTC(), ids)
+	return err
+}
+
+// PurgeSent deletes events sent before before.
+func (r *outboxRepositoryImpl) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.writer(ctx).Exec(ctx, "DELETE FROM outbox WHERE sent_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
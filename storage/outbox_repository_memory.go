@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"context"
+	"http-server/dto/event"
+	"sync"
+	"time"
+)
+
+type memoryOutboxEntry struct {
+	event  event.Event
+	sentAt *time.Time
+}
+
+// memoryOutboxRepository is an in-memory implementation of the
+// OutboxRepository. Without transactions, a change and its events are not
+// stored atomically.
+type memoryOutboxRepository struct {
+	mu      sync.Mutex
+	entries []memoryOutboxEntry
+}
+
+// NewMemoryOutboxRepository creates an empty in-memory OutboxRepository.
+func NewMemoryOutboxRepository() OutboxRepository {
+	return &memoryOutboxRepository{}
+}
+
+// Append adds events to the end of the outbox.
+func (r *memoryOutboxRepository) Append(ctx context.Context, events ...event.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, e := range events {
+		r.entries = append(r.entries, memoryOutboxEntry{event: e})
+	}
+	return nil
+}
+
+// Pending returns the oldest unsent events.
+func (r *memoryOutboxRepository) Pending(ctx context.Context, limit int) ([]event.Event, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := []event.Event{}
+	for _, entry := range r.entries {
+		if len(events) == limit {
+			break
+		}
+		if entry.sentAt == nil {
+			events = append(events, entry.event)
+		}
+	}
+	return events, nil
+}
+
+// MarkSent sets the sending time of events.
+func (r *memoryOutboxRepository) MarkSent(ctx context.Context, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sent := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		sent[id] = true
+	}
+	now := time.Now().UTC()
+	for i := range r.entries {
+		if sent[r.entries[i].event.ID] && r.entries[i].sentAt == nil {
+			r.entries[i].sentAt = &now
+		}
+	}
+	return nil
+}
+
+// PurgeSent removes events sent before before.
+func (r *memoryOutboxRepository) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	kept := r.entries[:0]
+	for _, entry := range r.entries {
+		if entry.sentAt == nil || !entry.sentAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	n := int64(len(r.entries) - len(kept))
+	r.entries = kept
+	return n, nil
+}
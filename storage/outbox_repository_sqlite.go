@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"http-server/dto/event"
+	"strings"
+	"time"
+)
+
+// sqliteOutboxRepository is the SQLite implementation of the
+// OutboxRepository.
+type sqliteOutboxRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteOutboxRepository creates an OutboxRepository backed by db, which
+// must have been migrated with the sqlite migrations.
+func NewSQLiteOutboxRepository(db *sql.DB) OutboxRepository {
+	return &sqliteOutboxRepository{db: db}
+}
+
+// Append inserts events one by one.
+func (r *sqliteOutboxRepository) Append(ctx context.Context, events ...event.Event) error {
+	for _, e := range events {
+		_, err := sqlConn(ctx, r.db).ExecContext(ctx, "INSERT INTO outbox (event_id, type, data, occurred_at) VALUES ($1, $2, $3, $4)", e.ID, e.Type, string(e.Data), e.OccurredAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending selects the oldest unsent events. SQLite has a single writer, so
+// no rows are locked.
+func (r *sqliteOutboxRepository) Pending(ctx context.Context, limit int) ([]event.Event, error) {
+	rows, err := sqlConn(ctx, r.db).QueryContext(ctx, "SELECT event_id, type, data, occurred_at FROM outbox WHERE sent_at IS NULL ORDER BY id LIMIT $1", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []event.Event{}
+	for rows.Next() {
+		var e event.Event
+		var data string
+		if err := rows.Scan(&e.ID, &e.Type, &data, &e.OccurredAt); err != nil {
+			return nil, err
+		}
+		e.Data = []byte(data)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// MarkSent sets the sending time of events.
+func (r *sqliteOutboxRepository) MarkSent(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	args := []any{time.Now().UTC()}
+	placeholders := make([]string, len(ids))
+	for i, id := range ids {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", i+2)
+	}
+	_, err := sqlConn(ctx, r.db).ExecContext(ctx, "UPDATE outbox SET sent_at = $1 WHERE event_id IN ("+strings.Join(placeholders, ", ")+")", args...)
+	return err
+}
+
+// PurgeSent deletes events sent before before.
+func (r *sqliteOutboxRepository) PurgeSent(ctx context.Context, before time.Time) (int64, error) {
+	res, err := sqlConn(ctx, r.db).ExecContext(ctx, "DELETE FROM outbox WHERE sent_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
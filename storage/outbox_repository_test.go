@@ -0,0 +1,31 @@
+package storage_test
+
+import (
+	"testing"
+
+	"http-server/storage"
+	"http-server/storage/storagetest"
+)
+
+func TestMemoryOutboxRepository(t *testing.T) {
+	storagetest.RunOutboxRepositoryTests(t, func(t *testing.T) storage.OutboxRepository {
+		return storage.NewMemoryOutboxRepository()
+	})
+}
+
+func TestSQLiteOutboxRepository(t *testing.T) {
+	storagetest.RunOutboxRepositoryTests(t, func(t *testing.T) storage.OutboxRepository {
+		return storage.NewSQLiteOutboxRepository(storagetest.OpenSQLite(t))
+	})
+}
+
+// TestPostgresOutboxRepository runs against the migrated database in
+// TEST_DATABASE_URL. The outbox table is truncated before every test.
+func TestPostgresOutboxRepository(t *testing.T) {
+	db := storagetest.ConnectPostgres(t)
+
+	storagetest.RunOutboxRepositoryTests(t, func(t *testing.T) storage.OutboxRepository {
+		storagetest.TruncatePostgres(t, db, "outbox")
+		return storage.NewOutboxRepository(db)
+	})
+}
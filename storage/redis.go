@@ -28,8 +28,9 @@ func NewRedisClient(cfg *config.RedisConfig) (*RedisClient, error) {
 
 	_, err := rdb.Ping(ctx).Result()
 	if err != nil {
+		_ = rdb.Close()
 		return nil, fmt.Errorf("could not connect to Redis: %w", err)
 	}
 
-	return &RedisClient{rdb}, nil
+	return &RedisClient{Client: rdb}, nil
 }
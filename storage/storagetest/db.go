@@ -0,0 +1,54 @@
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"http-server/config"
+	"http-server/migrations"
+	"http-server/storage"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// OpenSQLite returns a migrated SQLite database in a temporary directory,
+// closed at the end of t.
+func OpenSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg := &config.DatabaseConfig{
+		Driver: "sqlite",
+		SQLite: config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "test.db")},
+	}
+	require.NoError(t, migrations.Run(cfg))
+	db, err := storage.OpenSQLite(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// ConnectPostgres connects to the migrated database in TEST_DATABASE_URL
+// for the duration of t, and skips t when the variable is not set.
+func ConnectPostgres(t *testing.T) *storage.DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	pool, err := pgxpool.Connect(context.Background(), url)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+	return &storage.DB{Primary: pool}
+}
+
+// TruncatePostgres empties the given tables of db and restarts their IDs.
+// Never point TEST_DATABASE_URL at a database holding real data.
+func TruncatePostgres(t *testing.T, db *storage.DB, tables ...string) {
+	t.Helper()
+	_, err := db.Primary.Exec(context.Background(), "TRUNCATE "+strings.Join(tables, ", ")+" RESTART IDENTITY")
+	require.NoError(t, err)
+}
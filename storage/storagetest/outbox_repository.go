@@ -0,0 +1,102 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"http-server/dto/event"
+	"http-server/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunOutboxRepositoryTests runs the conformance suite against the
+// repositories returned by newRepo, which must be empty for every call.
+func RunOutboxRepositoryTests(t *testing.T, newRepo func(t *testing.T) storage.OutboxRepository) {
+	ctx := context.Background()
+
+	newEvent := func(t *testing.T, id int) event.Event {
+		t.Helper()
+		e, err := event.New(event.TypeUserDeleted, event.UserDeleted{ID: id})
+		require.NoError(t, err)
+		return e
+	}
+	ids := func(events []event.Event) []string {
+		ids := make([]string, len(events))
+		for i, e := range events {
+			ids[i] = e.ID
+		}
+		return ids
+	}
+
+	t.Run("should return pending events in the order they were appended", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		first, second, third := newEvent(t, 1), newEvent(t, 2), newEvent(t, 3)
+		require.NoError(t, repo.Append(ctx, first, second))
+		require.NoError(t, repo.Append(ctx, third))
+
+		// Act
+		events, err := repo.Pending(ctx, 10)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []string{first.ID, second.ID, third.ID}, ids(events))
+		assert.Equal(t, event.TypeUserDeleted, events[0].Type)
+		assert.JSONEq(t, `{"id":1,"permanent":false}`, string(events[0].Data))
+		assert.WithinDuration(t, first.OccurredAt, events[0].OccurredAt, time.Millisecond)
+	})
+
+	t.Run("should return at most limit events", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		first, second := newEvent(t, 1), newEvent(t, 2)
+		require.NoError(t, repo.Append(ctx, first, second))
+
+		// Act
+		events, err := repo.Pending(ctx, 1)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, []string{first.ID}, ids(events))
+	})
+
+	t.Run("should not return events marked as sent", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		first, second := newEvent(t, 1), newEvent(t, 2)
+		require.NoError(t, repo.Append(ctx, first, second))
+
+		// Act
+		err := repo.MarkSent(ctx, []string{first.ID})
+
+		// Assert
+		require.NoError(t, err)
+		events, err := repo.Pending(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{second.ID}, ids(events))
+	})
+
+	t.Run("should purge only events sent before the given time", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		sent, pending := newEvent(t, 1), newEvent(t, 2)
+		require.NoError(t, repo.Append(ctx, sent, pending))
+		require.NoError(t, repo.MarkSent(ctx, []string{sent.ID}))
+
+		// Act
+		kept, errKept := repo.PurgeSent(ctx, time.Now().Add(-time.Hour))
+		purged, errPurged := repo.PurgeSent(ctx, time.Now().Add(time.Hour))
+
+		// Assert
+		require.NoError(t, errKept)
+		require.NoError(t, errPurged)
+		assert.Equal(t, int64(0), kept)
+		assert.Equal(t, int64(1), purged)
+		events, err := repo.Pending(ctx, 10)
+		require.NoError(t, err)
+		assert.Equal(t, []string{pending.ID}, ids(events))
+	})
+}
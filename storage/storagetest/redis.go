@@ -0,0 +1,25 @@
+package storagetest
+
+import (
+	"strconv"
+	"testing"
+
+	"http-server/config"
+	"http-server/storage"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// NewRedisClient starts an in-process Redis server for the duration of t
+// and returns a client connected to it.
+func NewRedisClient(t *testing.T) *storage.RedisClient {
+	t.Helper()
+	server := miniredis.RunT(t)
+	port, err := strconv.Atoi(server.Port())
+	require.NoError(t, err)
+	rdb, err := storage.NewRedisClient(&config.RedisConfig{Host: server.Host(), Port: port})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = rdb.Close() })
+	return rdb
+}
@@ -0,0 +1,447 @@
+// Package storagetest provides conformance tests that every implementation
+// of the storage repositories must pass.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	user "http-server/dto/user"
+	"http-server/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunUserRepositoryTests runs the conformance suite against the repositories
+// returned by newRepo, which must be empty for every call.
+func RunUserRepositoryTests(t *testing.T, newRepo func(t *testing.T) storage.UserRepository) {
+	ctx := context.Background()
+
+	t.Run("should assign increasing IDs on create", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+
+		// Act
+		first, err1 := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		second, err2 := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Bob", Email: "bob@example.com"})
+
+		// Assert
+		require.NoError(t, err1)
+		require.NoError(t, err2)
+		assert.Equal(t, "Alice", first.Name)
+		assert.Equal(t, "alice@example.com", first.Email)
+		assert.Greater(t, second.ID, first.ID)
+	})
+
+	t.Run("should return the created user by ID", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+
+		// Act
+		got, err := repo.GetUser(ctx, created.ID, storage.UserFilter{})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, created, got)
+	})
+
+	t.Run("should list users ordered by ID", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		var want []user.User
+		for _, name := range []string{"Carol", "Alice", "Bob"} {
+			u, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: name, Email: name + "@example.com"})
+			require.NoError(t, err)
+			want = append(want, *u)
+		}
+
+		// Act
+		users, err := repo.GetUsers(ctx, storage.UserFilter{})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, want, users)
+	})
+
+	t.Run("should return an empty list when there are no users", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+
+		// Act
+		users, err := repo.GetUsers(ctx, storage.UserFilter{})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Empty(t, users)
+	})
+
+	t.Run("should reject duplicate emails", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		_, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+
+		// Act
+		_, err = repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Other Alice", Email: "alice@example.com"})
+
+		// Assert
+		assert.ErrorIs(t, err, storage.ErrEmailTaken)
+	})
+
+	t.Run("should return ErrUserNotFound for unknown IDs", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+
+		// Act
+		_, getErr := repo.GetUser(ctx, 4242, storage.UserFilter{})
+		deleteErr := repo.DeleteUser(ctx, 4242, 0)
+
+		// Assert
+		assert.ErrorIs(t, getErr, storage.ErrUserNotFound)
+		assert.ErrorIs(t, deleteErr, storage.ErrUserNotFound)
+	})
+
+	t.Run("should delete users and free their email", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+
+		// Act
+		err = repo.DeleteUser(ctx, created.ID, 0)
+		require.NoError(t, err)
+		_, getErr := repo.GetUser(ctx, created.ID, storage.UserFilter{})
+		recreated, createErr := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+
+		// Assert
+		assert.ErrorIs(t, getErr, storage.ErrUserNotFound)
+		require.NoError(t, createErr)
+		assert.Greater(t, recreated.ID, created.ID, "IDs must not be reused")
+	})
+
+	t.Run("should hide soft-deleted users unless asked to include them", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteUser(ctx, created.ID, 0))
+
+		// Act
+		active, activeErr := repo.GetUsers(ctx, storage.UserFilter{})
+		all, allErr := repo.GetUsers(ctx, storage.UserFilter{IncludeDeleted: true})
+		deleted, getErr := repo.GetUser(ctx, created.ID, storage.UserFilter{IncludeDeleted: true})
+		deleteAgainErr := repo.DeleteUser(ctx, created.ID, 0)
+
+		// Assert
+		require.NoError(t, activeErr)
+		require.NoError(t, allErr)
+		require.NoError(t, getErr)
+		assert.Empty(t, active)
+		require.Len(t, all, 1)
+		assert.NotNil(t, all[0].DeletedAt)
+		assert.NotNil(t, deleted.DeletedAt)
+		assert.ErrorIs(t, deleteAgainErr, storage.ErrUserNotFound)
+	})
+
+	t.Run("should get users by IDs in ID order, skipping unknown ones", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		var created []*user.User
+		for _, name := range []string{"Alice", "Bob", "Carol"} {
+			u, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: name, Email: name + "@example.com"})
+			require.NoError(t, err)
+			created = append(created, u)
+		}
+		alice, bob, carol := created[0], created[1], created[2]
+		require.NoError(t, repo.DeleteUser(ctx, bob.ID, 0))
+		ids := []int{carol.ID, alice.ID, carol.ID + 100, alice.ID, bob.ID}
+
+		// Act
+		active, activeErr := repo.GetUsersByIDs(ctx, ids, storage.UserFilter{})
+		all, allErr := repo.GetUsersByIDs(ctx, ids, storage.UserFilter{IncludeDeleted: true})
+		none, noneErr := repo.GetUsersByIDs(ctx, nil, storage.UserFilter{})
+
+		// Assert
+		require.NoError(t, activeErr)
+		require.NoError(t, allErr)
+		require.NoError(t, noneErr)
+		assert.Equal(t, []user.User{*alice, *carol}, active)
+		require.Len(t, all, 3)
+		assert.Equal(t, bob.ID, all[1].ID)
+		assert.NotNil(t, all[1].DeletedAt)
+		assert.Empty(t, none)
+	})
+
+	t.Run("should list and count users by keyset, filter and search", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		var created []*user.User
+		for _, name := range []string{"Alice", "Bob", "Carol", "Dave", "Al_ex"} {
+			u, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: name, Email: strings.ToLower(name) + "@example.com"})
+			require.NoError(t, err)
+			created = append(created, u)
+		}
+		alice, bob, carol, dave, alex := created[0], created[1], created[2], created[3], created[4]
+		require.NoError(t, repo.DeleteUser(ctx, carol.ID, 0))
+
+		// Act
+		all, allErr := repo.ListUsers(ctx, storage.UserQuery{})
+		page, pageErr := repo.ListUsers(ctx, storage.UserQuery{AfterID: alice.ID, Limit: 2})
+		deleted, deletedErr := repo.ListUsers(ctx, storage.UserQuery{Filter: storage.UserFilter{IncludeDeleted: true}, AfterID: bob.ID, Limit: 1})
+		search, searchErr := repo.ListUsers(ctx, storage.UserQuery{Search: "AL"})
+		wildcard, wildcardErr := repo.ListUsers(ctx, storage.UserQuery{Search: "_"})
+		count, countErr := repo.CountUsers(ctx, storage.UserQuery{Search: "AL", AfterID: alex.ID, Limit: 1})
+
+		// Assert
+		require.NoError(t, allErr)
+		require.NoError(t, pageErr)
+		require.NoError(t, deletedErr)
+		require.NoError(t, searchErr)
+		require.NoError(t, wildcardErr)
+		require.NoError(t, countErr)
+		assert.Equal(t, []user.User{*alice, *bob, *dave, *alex}, all)
+		assert.Equal(t, []user.User{*bob, *dave}, page)
+		require.Len(t, deleted, 1)
+		assert.Equal(t, carol.ID, deleted[0].ID)
+		assert.Equal(t, []user.User{*alice, *alex}, search)
+		assert.Equal(t, []user.User{*alex}, wildcard)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("should restore soft-deleted users", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteUser(ctx, created.ID, 0))
+
+		// Act
+		restored, err := repo.RestoreUser(ctx, created.ID)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Nil(t, restored.DeletedAt)
+		got, err := repo.GetUser(ctx, created.ID, storage.UserFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, restored, got)
+	})
+
+	t.Run("should refuse to restore a user whose email was taken", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteUser(ctx, created.ID, 0))
+		_, err = repo.CreateUser(ctx, &user.CreateUserRequest{Name: "New Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+
+		// Act
+		_, restoreErr := repo.RestoreUser(ctx, created.ID)
+		_, unknownErr := repo.RestoreUser(ctx, 4242)
+
+		// Assert
+		assert.ErrorIs(t, restoreErr, storage.ErrEmailTaken)
+		assert.ErrorIs(t, unknownErr, storage.ErrUserNotFound)
+	})
+
+	t.Run("should purge users permanently", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		active, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		deleted, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Bob", Email: "bob@example.com"})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteUser(ctx, deleted.ID, 0))
+
+		// Act
+		notYet, notYetErr := repo.PurgeDeletedUsers(ctx, time.Now().Add(-time.Hour))
+		purged, purgeErr := repo.PurgeDeletedUsers(ctx, time.Now().Add(time.Hour))
+		purgeUserErr := repo.PurgeUser(ctx, active.ID, 0)
+
+		// Assert
+		require.NoError(t, notYetErr)
+		require.NoError(t, purgeErr)
+		require.NoError(t, purgeUserErr)
+		assert.Equal(t, int64(0), notYet)
+		assert.Equal(t, int64(1), purged)
+		all, err := repo.GetUsers(ctx, storage.UserFilter{IncludeDeleted: true})
+		require.NoError(t, err)
+		assert.Empty(t, all)
+		assert.ErrorIs(t, repo.PurgeUser(ctx, active.ID, 0), storage.ErrUserNotFound)
+	})
+
+	t.Run("should update users and increment their version", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+
+		// Act
+		updated, err := repo.UpdateUser(ctx, created.ID, &user.UpdateUserRequest{Name: "Alice Smith", Email: "alice.smith@example.com"}, created.Version)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, 1, created.Version)
+		assert.Equal(t, "Alice Smith", updated.Name)
+		assert.Equal(t, "alice.smith@example.com", updated.Email)
+		assert.Equal(t, created.Version+1, updated.Version)
+		got, err := repo.GetUser(ctx, created.ID, storage.UserFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, updated, got)
+	})
+
+	t.Run("should reject writes expecting a stale version", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		_, err = repo.UpdateUser(ctx, created.ID, &user.UpdateUserRequest{Name: "Alice Smith", Email: "alice@example.com"}, 0)
+		require.NoError(t, err)
+
+		// Act
+		_, updateErr := repo.UpdateUser(ctx, created.ID, &user.UpdateUserRequest{Name: "Alice Jones", Email: "alice@example.com"}, created.Version)
+		deleteErr := repo.DeleteUser(ctx, created.ID, created.Version)
+		purgeErr := repo.PurgeUser(ctx, created.ID, created.Version)
+		_, missingErr := repo.UpdateUser(ctx, 4242, &user.UpdateUserRequest{Name: "Nobody", Email: "nobody@example.com"}, 1)
+
+		// Assert
+		assert.ErrorIs(t, updateErr, storage.ErrVersionMismatch)
+		assert.ErrorIs(t, deleteErr, storage.ErrVersionMismatch)
+		assert.ErrorIs(t, purgeErr, storage.ErrVersionMismatch)
+		assert.ErrorIs(t, missingErr, storage.ErrUserNotFound)
+		got, err := repo.GetUser(ctx, created.ID, storage.UserFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, "Alice Smith", got.Name)
+	})
+
+	t.Run("should reject updates to a taken email", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		alice, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		_, err = repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Bob", Email: "bob@example.com"})
+		require.NoError(t, err)
+
+		// Act
+		_, err = repo.UpdateUser(ctx, alice.ID, &user.UpdateUserRequest{Name: "Alice", Email: "bob@example.com"}, 0)
+
+		// Assert
+		assert.ErrorIs(t, err, storage.ErrEmailTaken)
+	})
+
+	t.Run("should create users in a batch and skip taken emails", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		_, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+		require.NoError(t, err)
+		reqs := []user.CreateUserRequest{
+			{Name: "Bob", Email: "bob@example.com"},
+			{Name: "Alice Again", Email: "alice@example.com"},
+			{Name: "Carol", Email: "carol@example.com"},
+			{Name: "Bob Again", Email: "bob@example.com"},
+		}
+
+		// Act
+		created, err := repo.CreateUsers(ctx, reqs)
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, created, len(reqs))
+		assert.Nil(t, created[1])
+		assert.Nil(t, created[3])
+		require.NotNil(t, created[0])
+		require.NotNil(t, created[2])
+		assert.Equal(t, "Bob", created[0].Name)
+		assert.Equal(t, 1, created[0].Version)
+		assert.Greater(t, created[2].ID, created[0].ID)
+		users, err := repo.GetUsers(ctx, storage.UserFilter{})
+		require.NoError(t, err)
+		assert.Len(t, users, 3)
+	})
+
+	t.Run("should stream users ordered by ID", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		reqs := make([]user.CreateUserRequest, 1234)
+		for i := range reqs {
+			reqs[i] = user.CreateUserRequest{Name: "User", Email: fmt.Sprintf("user%d@example.com", i)}
+		}
+		_, err := repo.CreateUsers(ctx, reqs)
+		require.NoError(t, err)
+		want, err := repo.GetUsers(ctx, storage.UserFilter{})
+		require.NoError(t, err)
+		require.NoError(t, repo.DeleteUser(ctx, want[0].ID, 0))
+
+		// Act
+		var got []user.User
+		err = repo.StreamUsers(ctx, storage.UserFilter{}, func(u *user.User) error {
+			got = append(got, *u)
+			return nil
+		})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, want[1:], got)
+	})
+
+	t.Run("should stop streaming at the first error", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		for _, name := range []string{"Alice", "Bob"} {
+			_, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: name, Email: name + "@example.com"})
+			require.NoError(t, err)
+		}
+		stop := errors.New("stop")
+
+		// Act
+		calls := 0
+		err := repo.StreamUsers(ctx, storage.UserFilter{}, func(u *user.User) error {
+			calls++
+			return stop
+		})
+
+		// Assert
+		assert.ErrorIs(t, err, stop)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("should be safe for concurrent use", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		const n = 20
+		var wg sync.WaitGroup
+		ids := make(chan int, n)
+
+		// Act
+		for i := range n {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				u, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "User", Email: fmt.Sprintf("user%d@example.com", i)})
+				if assert.NoError(t, err) {
+					ids <- u.ID
+				}
+			}()
+		}
+		wg.Wait()
+		close(ids)
+
+		// Assert
+		seen := make(map[int]bool)
+		for id := range ids {
+			assert.False(t, seen[id], "duplicate ID %d", id)
+			seen[id] = true
+		}
+		users, err := repo.GetUsers(ctx, storage.UserFilter{})
+		require.NoError(t, err)
+		assert.Len(t, users, n)
+	})
+}
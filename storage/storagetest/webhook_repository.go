@@ -0,0 +1,213 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"http-server/dto/webhook"
+	"http-server/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunWebhookRepositoryTests runs the conformance suite against the
+// repositories returned by newRepo, which must be empty for every call.
+func RunWebhookRepositoryTests(t *testing.T, newRepo func(t *testing.T) storage.WebhookRepository) {
+	ctx := context.Background()
+
+	create := func(t *testing.T, repo storage.WebhookRepository, types ...string) *webhook.Webhook {
+		t.Helper()
+		w, err := repo.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: "https://example.com/hook", EventTypes: types, Secret: "secret"})
+		require.NoError(t, err)
+		return w
+	}
+	deliver := func(t *testing.T, repo storage.WebhookRepository, webhookID int, succeeded bool, disableAfter int) (*webhook.Delivery, bool) {
+		t.Helper()
+		d := &webhook.Delivery{WebhookID: webhookID, EventID: uuid.NewString(), EventType: "user.created", Attempt: 1, DurationMs: 12, Succeeded: succeeded}
+		if succeeded {
+			d.StatusCode = 204
+		} else {
+			d.Error = "connection refused"
+		}
+		disabled, err := repo.RecordDelivery(ctx, d, disableAfter)
+		require.NoError(t, err)
+		return d, disabled
+	}
+
+	t.Run("should create active webhooks and return them by ID", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+
+		// Act
+		created := create(t, repo, "user.created", "user.deleted")
+		got, err := repo.GetWebhook(ctx, created.ID)
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.com/hook", got.URL)
+		assert.Equal(t, []string{"user.created", "user.deleted"}, got.EventTypes)
+		assert.Equal(t, "secret", got.Secret)
+		assert.True(t, got.Active)
+		assert.Zero(t, got.ConsecutiveFailures)
+		assert.False(t, got.CreatedAt.IsZero())
+		assert.Equal(t, created.ID, got.ID)
+	})
+
+	t.Run("should store no event types as an empty list", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+
+		// Act
+		created := create(t, repo)
+
+		// Assert
+		assert.NotNil(t, created.EventTypes)
+		assert.Empty(t, created.EventTypes)
+	})
+
+	t.Run("should list webhooks ordered by ID", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		first, second := create(t, repo), create(t, repo)
+
+		// Act
+		webhooks, err := repo.GetWebhooks(ctx)
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, webhooks, 2)
+		assert.Equal(t, first.ID, webhooks[0].ID)
+		assert.Equal(t, second.ID, webhooks[1].ID)
+	})
+
+	t.Run("should return ErrWebhookNotFound for unknown IDs", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+
+		// Act
+		_, errGet := repo.GetWebhook(ctx, 42)
+		_, errUpdate := repo.UpdateWebhook(ctx, 42, &webhook.UpdateWebhookRequest{URL: "https://example.com"})
+		errDelete := repo.DeleteWebhook(ctx, 42)
+		_, errRecord := repo.RecordDelivery(ctx, &webhook.Delivery{WebhookID: 42, EventID: uuid.NewString(), EventType: "user.created", Attempt: 1}, 0)
+
+		// Assert
+		assert.ErrorIs(t, errGet, storage.ErrWebhookNotFound)
+		assert.ErrorIs(t, errUpdate, storage.ErrWebhookNotFound)
+		assert.ErrorIs(t, errDelete, storage.ErrWebhookNotFound)
+		assert.ErrorIs(t, errRecord, storage.ErrWebhookNotFound)
+	})
+
+	t.Run("should update webhooks", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created := create(t, repo, "user.created")
+
+		// Act
+		updated, err := repo.UpdateWebhook(ctx, created.ID, &webhook.UpdateWebhookRequest{URL: "https://example.org/hook", EventTypes: []string{"user.updated"}, Active: false})
+
+		// Assert
+		require.NoError(t, err)
+		assert.Equal(t, "https://example.org/hook", updated.URL)
+		assert.Equal(t, []string{"user.updated"}, updated.EventTypes)
+		assert.False(t, updated.Active)
+		assert.Equal(t, "secret", updated.Secret)
+	})
+
+	t.Run("should delete webhooks with their deliveries", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created := create(t, repo)
+		deliver(t, repo, created.ID, true, 0)
+
+		// Act
+		err := repo.DeleteWebhook(ctx, created.ID)
+
+		// Assert
+		require.NoError(t, err)
+		_, err = repo.GetWebhook(ctx, created.ID)
+		assert.ErrorIs(t, err, storage.ErrWebhookNotFound)
+		deliveries, err := repo.GetDeliveries(ctx, created.ID, 10)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+
+	t.Run("should return the latest deliveries first", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created := create(t, repo)
+		first, _ := deliver(t, repo, created.ID, false, 0)
+		second, _ := deliver(t, repo, created.ID, true, 0)
+		third, _ := deliver(t, repo, created.ID, true, 0)
+
+		// Act
+		deliveries, err := repo.GetDeliveries(ctx, created.ID, 2)
+
+		// Assert
+		require.NoError(t, err)
+		require.Len(t, deliveries, 2)
+		assert.Equal(t, third.ID, deliveries[0].ID)
+		assert.Equal(t, second.ID, deliveries[1].ID)
+		assert.Greater(t, second.ID, first.ID)
+		assert.Equal(t, second.EventID, deliveries[1].EventID)
+		assert.Equal(t, 204, deliveries[1].StatusCode)
+		assert.Equal(t, 12, deliveries[1].DurationMs)
+		assert.True(t, deliveries[1].Succeeded)
+		assert.False(t, deliveries[1].CreatedAt.IsZero())
+	})
+
+	t.Run("should disable webhooks after consecutive failures", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created := create(t, repo)
+		deliver(t, repo, created.ID, false, 3)
+		deliver(t, repo, created.ID, true, 3)
+		deliver(t, repo, created.ID, false, 3)
+		_, disabledEarly := deliver(t, repo, created.ID, false, 3)
+
+		// Act
+		_, disabled := deliver(t, repo, created.ID, false, 3)
+		_, disabledAgain := deliver(t, repo, created.ID, false, 3)
+
+		// Assert
+		assert.False(t, disabledEarly)
+		assert.True(t, disabled)
+		assert.False(t, disabledAgain)
+		got, err := repo.GetWebhook(ctx, created.ID)
+		require.NoError(t, err)
+		assert.False(t, got.Active)
+		assert.Equal(t, 4, got.ConsecutiveFailures)
+	})
+
+	t.Run("should reset failures when a webhook is enabled again", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created := create(t, repo)
+		deliver(t, repo, created.ID, false, 1)
+
+		// Act
+		updated, err := repo.UpdateWebhook(ctx, created.ID, &webhook.UpdateWebhookRequest{URL: created.URL, Active: true})
+
+		// Assert
+		require.NoError(t, err)
+		assert.True(t, updated.Active)
+		assert.Zero(t, updated.ConsecutiveFailures)
+	})
+
+	t.Run("should never disable webhooks without a limit", func(t *testing.T) {
+		// Arrange
+		repo := newRepo(t)
+		created := create(t, repo)
+
+		// Act
+		for range 5 {
+			deliver(t, repo, created.ID, false, 0)
+		}
+
+		// Assert
+		got, err := repo.GetWebhook(ctx, created.ID)
+		require.NoError(t, err)
+		assert.True(t, got.Active)
+	})
+}
@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"http-server/config"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// serializationFailure is the PostgreSQL SQLSTATE of transactions aborted
+// because they could not be serialized with concurrent ones.
+const serializationFailure = "40001"
+
+const (
+	defaultTxMaxRetries = 3
+	txRetryBackoff      = 10 * time.Millisecond
+)
+
+// TxManager runs a unit of work in a single database transaction. Repository
+// calls made with the context passed to fn use that transaction, so their
+// writes commit or roll back together.
+type TxManager interface {
+	// WithinTx calls fn in a transaction that is committed if fn returns nil
+	// and rolled back otherwise. Calls nested in fn join the outer
+	// transaction.
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type txCtxKey struct{}
+
+// pgQuerier is implemented by both *pgxpool.Pool and pgx.Tx.
+type pgQuerier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// pgTxManager is the PostgreSQL implementation of the TxManager.
+type pgTxManager struct {
+	db         *DB
+	isoLevel   pgx.TxIsoLevel
+	maxRetries int
+}
+
+// NewTxManager creates a TxManager running transactions on the primary with
+// the isolation level of cfg. Transactions failing with a serialization
+// failure are retried up to cfg.MaxRetries times.
+func NewTxManager(db *DB, cfg *config.TxConfig) (TxManager, error) {
+	isoLevel := pgx.TxIsoLevel(cfg.IsolationLevel)
+	switch isoLevel {
+	case "":
+		isoLevel = pgx.ReadCommitted
+	case pgx.ReadCommitted, pgx.RepeatableRead, pgx.Serializable:
+	default:
+		return nil, fmt.Errorf("unsupported transaction isolation level %q", cfg.IsolationLevel)
+	}
+	maxRetries := cfg.MaxRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultTxMaxRetries
+	}
+	return &pgTxManager{db: db, isoLevel: isoLevel, maxRetries: maxRetries}, nil
+}
+
+// WithinTx runs fn in a transaction, retrying it on serialization failures.
+func (m *pgTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txCtxKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+	return retrySerializationFailures(ctx, m.maxRetries, func() error {
+		return m.db.Primary.BeginTxFunc(ctx, pgx.TxOptions{IsoLevel: m.isoLevel}, func(tx pgx.Tx) error {
+			return fn(context.WithValue(ctx, txCtxKey{}, tx))
+		})
+	})
+}
+
+// retrySerializationFailures calls fn until it does not fail with a
+// serialization failure, at most maxRetries more times.
+func retrySerializationFailures(ctx context.Context, maxRetries int, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		var pgErr *pgconn.PgError
+		if attempt >= maxRetries || !errors.As(err, &pgErr) || pgErr.Code != serializationFailure {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(time.Duration(attempt+1) * txRetryBackoff):
+		}
+	}
+}
+
+// writer returns the transaction of ctx, or the primary pool.
+func (db *DB) writer(ctx context.Context) pgQuerier {
+	if tx, ok := ctx.Value(txCtxKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db.Primary
+}
+
+// reader returns the transaction of ctx, so reads see its uncommitted
+// writes, or the pool selected by Reader.
+func (db *DB) reader(ctx context.Context) pgQuerier {
+	if tx, ok := ctx.Value(txCtxKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return db.Reader(ctx)
+}
+
+// sqlExecutor is implemented by both *sql.DB and *sql.Tx.
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// sqlTxManager is the TxManager of database/sql databases such as SQLite.
+// SQLite transactions are always serializable, so no isolation level is
+// configured.
+type sqlTxManager struct {
+	db *sql.DB
+}
+
+// NewSQLiteTxManager creates a TxManager for the SQLite database db.
+func NewSQLiteTxManager(db *sql.DB) TxManager {
+	return &sqlTxManager{db: db}
+}
+
+// WithinTx runs fn in a transaction.
+func (m *sqlTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	if _, ok := ctx.Value(txCtxKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	if err = fn(context.WithValue(ctx, txCtxKey{}, tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqlConn returns the transaction of ctx, or db.
+func sqlConn(ctx context.Context, db *sql.DB) sqlExecutor {
+	if tx, ok := ctx.Value(txCtxKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// noopTxManager runs functions without a transaction, for storage that has
+// none, such as the in-memory repository.
+type noopTxManager struct{}
+
+// NewNoopTxManager creates a TxManager that calls fn directly. Writes made by
+// a failing fn are not rolled back.
+func NewNoopTxManager() TxManager {
+	return noopTxManager{}
+}
+
+// WithinTx calls fn.
+func (noopTxManager) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
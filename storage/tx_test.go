@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"http-server/config"
+	"http-server/dto/event"
+	user "http-server/dto/user"
+	"http-server/migrations"
+
+	"github.com/jackc/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrySerializationFailures(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should retry serialization failures until fn succeeds", func(t *testing.T) {
+		// Arrange
+		calls := 0
+		fn := func() error {
+			calls++
+			if calls < 3 {
+				return &pgconn.PgError{Code: serializationFailure}
+			}
+			return nil
+		}
+
+		// Act
+		err := retrySerializationFailures(ctx, 3, fn)
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should give up after maxRetries", func(t *testing.T) {
+		// Arrange
+		calls := 0
+		fn := func() error {
+			calls++
+			return &pgconn.PgError{Code: serializationFailure}
+		}
+
+		// Act
+		err := retrySerializationFailures(ctx, 2, fn)
+
+		// Assert
+		assert.Error(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("should not retry other errors", func(t *testing.T) {
+		// Arrange
+		calls := 0
+		fn := func() error {
+			calls++
+			return errors.New("boom")
+		}
+
+		// Act
+		err := retrySerializationFailures(ctx, 3, fn)
+
+		// Assert
+		assert.EqualError(t, err, "boom")
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func TestSQLiteTxManager(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.DatabaseConfig{
+		Driver: "sqlite",
+		SQLite: config.SQLiteConfig{Path: filepath.Join(t.TempDir(), "tx.db")},
+	}
+	require.NoError(t, migrations.Run(cfg))
+	db, err := OpenSQLite(cfg)
+	require.NoError(t, err)
+	defer db.Close()
+	repo := NewSQLiteUserRepository(db)
+	outbox := NewSQLiteOutboxRepository(db)
+	tm := NewSQLiteTxManager(db)
+
+	t.Run("should roll back every write when fn fails", func(t *testing.T) {
+		// Act
+		err := tm.WithinTx(ctx, func(ctx context.Context) error {
+			if _, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"}); err != nil {
+				return err
+			}
+			e, err := event.New(event.TypeUserCreated, map[string]string{"name": "Alice"})
+			if err != nil {
+				return err
+			}
+			if err := outbox.Append(ctx, e); err != nil {
+				return err
+			}
+			return tm.WithinTx(ctx, func(ctx context.Context) error {
+				_, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Alice", Email: "alice@example.com"})
+				return err
+			})
+		})
+
+		// Assert
+		assert.ErrorIs(t, err, ErrEmailTaken)
+		users, err := repo.GetUsers(ctx, UserFilter{})
+		require.NoError(t, err)
+		assert.Empty(t, users)
+		events, err := outbox.Pending(ctx, 10)
+		require.NoError(t, err)
+		assert.Empty(t, events)
+	})
+
+	t.Run("should commit writes when fn succeeds", func(t *testing.T) {
+		// Act
+		err := tm.WithinTx(ctx, func(ctx context.Context) error {
+			_, err := repo.CreateUser(ctx, &user.CreateUserRequest{Name: "Bob", Email: "bob@example.com"})
+			return err
+		})
+
+		// Assert
+		require.NoError(t, err)
+		users, err := repo.GetUsers(ctx, UserFilter{})
+		require.NoError(t, err)
+		assert.Len(t, users, 1)
+	})
+}
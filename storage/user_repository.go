@@ -1,20 +1,114 @@
 package storage
 
 import (
+	"context"
 	user "http-server/dto/user"
-
-	"github.com/jackc/pgx/v4/pgxpool"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// UserFilter narrows the users returned by reads.
+type UserFilter struct {
+	// IncludeDeleted also returns soft-deleted users.
+	IncludeDeleted bool
+}
+
+// UserQuery selects a page of users for keyset pagination.
+type UserQuery struct {
+	Filter UserFilter
+	// Search keeps the users whose name or email contains it, ignoring case.
+	Search string
+	// AfterID keeps the users with a greater ID.
+	AfterID int
+	// Limit caps the number of users returned. Zero returns them all.
+	Limit int
+}
+
+// where returns the WHERE clause of q and its arguments, using like as the
+// case-insensitive LIKE operator of the dialect. AfterID is left out when
+// withAfter is false.
+func (q UserQuery) where(like string, withAfter bool) (string, []any) {
+	var conds []string
+	var args []any
+	if !q.Filter.IncludeDeleted {
+		conds = append(conds, "deleted_at IS NULL")
+	}
+	if q.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(q.Search)+"%")
+		n := "$" + strconv.Itoa(len(args))
+		conds = append(conds, "(name "+like+" "+n+" ESCAPE '\\' OR email "+like+" "+n+" ESCAPE '\\')")
+	}
+	if withAfter && q.AfterID > 0 {
+		args = append(args, q.AfterID)
+		conds = append(conds, "id > $"+strconv.Itoa(len(args)))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// list returns the query selecting the page of q and its arguments.
+func (q UserQuery) list(like string) (string, []any) {
+	where, args := q.where(like, true)
+	query := "SELECT " + userColumns + " FROM users" + where + " ORDER BY id"
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+	return query, args
+}
+
+// count returns the query counting the users matching q, ignoring AfterID
+// and Limit, and its arguments.
+func (q UserQuery) count(like string) (string, []any) {
+	where, args := q.where(like, false)
+	return "SELECT COUNT(*) FROM users" + where, args
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
 // UserRepository defines the interface for user data storage.
+//
+// Writes taking an expectedVersion fail with ErrVersionMismatch when the
+// user's current version differs from it. An expectedVersion of 0 skips
+// the check.
 type UserRepository interface {
-	GetUsers() ([]user.User, error)
-	GetUser(id int) (*user.User, error)
-	CreateUser(user *user.CreateUserRequest) (*user.User, error)
-	DeleteUser(id int) error
+	GetUsers(ctx context.Context, filter UserFilter) ([]user.User, error)
+	GetUser(ctx context.Context, id int, filter UserFilter) (*user.User, error)
+	// GetUsersByIDs returns the users of ids in ID order, with a single
+	// query. Unknown IDs are skipped.
+	GetUsersByIDs(ctx context.Context, ids []int, filter UserFilter) ([]user.User, error)
+	// ListUsers returns the users selected by q in ID order.
+	ListUsers(ctx context.Context, q UserQuery) ([]user.User, error)
+	// CountUsers returns the number of users matching the filter and search
+	// of q. AfterID and Limit are ignored.
+	CountUsers(ctx context.Context, q UserQuery) (int, error)
+	CreateUser(ctx context.Context, user *user.CreateUserRequest) (*user.User, error)
+	// CreateUsers inserts users in a single batch. The returned slice is
+	// parallel to reqs and holds nil for users whose email was already
+	// taken, by an existing user or an earlier entry of reqs.
+	CreateUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error)
+	// StreamUsers calls fn for every user in ID order without loading them
+	// all into memory, and stops at the first error returned by fn.
+	StreamUsers(ctx context.Context, filter UserFilter, fn func(u *user.User) error) error
+	// UpdateUser replaces the fields of an active user.
+	UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error)
+	// DeleteUser soft-deletes a user, which RestoreUser undoes.
+	DeleteUser(ctx context.Context, id int, expectedVersion int) error
+	// RestoreUser undoes the soft deletion of a user. It fails with
+	// ErrEmailTaken when an active user took the email in the meantime.
+	RestoreUser(ctx context.Context, id int) (*user.User, error)
+	// PurgeUser permanently deletes a user, soft-deleted or not.
+	PurgeUser(ctx context.Context, id int, expectedVersion int) error
+	// PurgeDeletedUsers permanently deletes the users soft-deleted before
+	// the given time and returns how many were deleted.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error)
 }
 
 // UserRepository creates a new UserRepository.
-func NewUserRepository(db *pgxpool.Pool) UserRepository {
+func NewUserRepository(db *DB) UserRepository {
 	return &userRepositoryImpl{db: db}
 }
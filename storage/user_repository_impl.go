@@ -2,58 +2,247 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	user "http-server/dto/user"
+	"time"
 
-	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/jackc/pgx/v4"
 )
 
+const userColumns = "id, name, email, version, deleted_at"
+
+// streamFetchSize is the number of rows StreamUsers fetches from its cursor
+// at a time.
+const streamFetchSize = 500
+
 // userRepository is the PostgreSQL implementation of the UserRepository.
+// Reads are served by DB.Reader, writes always go to the primary. Both use
+// the transaction started by TxManager.WithinTx when ctx carries one.
 type userRepositoryImpl struct {
-	db *pgxpool.Pool
+	db *DB
 }
 
 // GetUsers retrieves all users from the database.
-func (r *userRepositoryImpl) GetUsers() ([]user.User, error) {
-	rows, err := r.db.Query(context.Background(), "SELECT id, name, email FROM users")
+func (r *userRepositoryImpl) GetUsers(ctx context.Context, filter UserFilter) ([]user.User, error) {
+	query := "SELECT " + userColumns + " FROM users"
+	if !filter.IncludeDeleted {
+		query += " WHERE deleted_at IS NULL"
+	}
+	return r.queryUsers(ctx, query+" ORDER BY id")
+}
+
+// GetUser retrieves a single user by ID from the database.
+func (r *userRepositoryImpl) GetUser(ctx context.Context, id int, filter UserFilter) (*user.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1"
+	if !filter.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	return scanUser(r.db.reader(ctx).QueryRow(ctx, query, id))
+}
+
+// GetUsersByIDs retrieves the users of ids from the database.
+func (r *userRepositoryImpl) GetUsersByIDs(ctx context.Context, ids []int, filter UserFilter) ([]user.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = ANY($1)"
+	if !filter.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	return r.queryUsers(ctx, query+" ORDER BY id", ids)
+}
+
+// ListUsers retrieves a page of users from the database.
+func (r *userRepositoryImpl) ListUsers(ctx context.Context, q UserQuery) ([]user.User, error) {
+	query, args := q.list("ILIKE")
+	return r.queryUsers(ctx, query, args...)
+}
+
+// CountUsers counts the users matching q in the database.
+func (r *userRepositoryImpl) CountUsers(ctx context.Context, q UserQuery) (int, error) {
+	query, args := q.count("ILIKE")
+	var n int
+	err := r.db.reader(ctx).QueryRow(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+// queryUsers runs a query returning userColumns on the reader of ctx.
+func (r *userRepositoryImpl) queryUsers(ctx context.Context, query string, args ...any) ([]user.User, error) {
+	rows, err := r.db.reader(ctx).Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var users []user.User
+	users := []user.User{}
 	for rows.Next() {
 		var u user.User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email); err != nil {
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt); err != nil {
 			return nil, err
 		}
 		users = append(users, u)
 	}
 
-	return users, nil
+	return users, rows.Err()
 }
 
-// GetUser retrieves a single user by ID from the database.
-func (r *userRepositoryImpl) GetUser(id int) (*user.User, error) {
-	var u user.User
-	err := r.db.QueryRow(context.Background(), "SELECT id, name, email FROM users WHERE id = $1", id).Scan(&u.ID, &u.Name, &u.Email)
+// CreateUser inserts a new user into the database.
+func (r *userRepositoryImpl) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error) {
+	u, err := scanUser(r.db.writer(ctx).QueryRow(ctx, "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING "+userColumns, req.Name, req.Email))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	return u, err
+}
+
+// CreateUsers inserts users with a single batch of statements. Conflicting
+// inserts do nothing, so a taken email does not abort the batch.
+func (r *userRepositoryImpl) CreateUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error) {
+	batch := &pgx.Batch{}
+	for i := range reqs {
+		batch.Queue("INSERT INTO users (name, email) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING "+userColumns, reqs[i].Name, reqs[i].Email)
+	}
+	results := r.db.writer(ctx).SendBatch(ctx, batch)
+	defer results.Close()
+
+	users := make([]*user.User, len(reqs))
+	for i := range reqs {
+		u, err := scanUser(results.QueryRow())
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		users[i] = u
+	}
+	return users, results.Close()
+}
+
+// StreamUsers reads users through a server-side cursor, streamFetchSize
+// rows at a time. The cursor lives in a read-only transaction, or in a
+// savepoint when ctx carries a transaction.
+func (r *userRepositoryImpl) StreamUsers(ctx context.Context, filter UserFilter, fn func(u *user.User) error) error {
+	query := "SELECT " + userColumns + " FROM users"
+	if !filter.IncludeDeleted {
+		query += " WHERE deleted_at IS NULL"
+	}
+	tx, err := r.db.reader(ctx).Begin(ctx)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	// Nothing is written, so rolling back also closes the cursor.
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, "DECLARE users_stream NO SCROLL CURSOR FOR "+query+" ORDER BY id"); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH %d FROM users_stream", streamFetchSize)
+	for {
+		n, err := r.fetchUsers(ctx, tx, fetch, fn)
+		if err != nil {
+			return err
+		}
+		if n < streamFetchSize {
+			return nil
+		}
 	}
-	return &u, nil
 }
 
-// CreateUser inserts a new user into the database.
-func (r *userRepositoryImpl) CreateUser(req *user.CreateUserRequest) (*user.User, error) {
+// fetchUsers runs a FETCH statement and calls fn for every user it returns.
+func (r *userRepositoryImpl) fetchUsers(ctx context.Context, tx pgx.Tx, fetch string, fn func(u *user.User) error) (int, error) {
+	rows, err := tx.Query(ctx, fetch)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	n := 0
+	for rows.Next() {
+		var u user.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt); err != nil {
+			return n, err
+		}
+		n++
+		if err := fn(&u); err != nil {
+			return n, err
+		}
+	}
+	return n, rows.Err()
+}
+
+// UpdateUser replaces the name and email of an active user.
+func (r *userRepositoryImpl) UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+	u, err := scanUser(r.db.writer(ctx).QueryRow(ctx, "UPDATE users SET name = $2, email = $3, version = version + 1 WHERE id = $1 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) RETURNING "+userColumns, id, req.Name, req.Email, expectedVersion))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, r.missingOrMismatch(ctx, id, UserFilter{})
+	}
+	return u, err
+}
+
+// DeleteUser soft-deletes a user.
+func (r *userRepositoryImpl) DeleteUser(ctx context.Context, id int, expectedVersion int) error {
+	tag, err := r.db.writer(ctx).Exec(ctx, "UPDATE users SET deleted_at = $2, version = version + 1 WHERE id = $1 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)", id, time.Now().UTC(), expectedVersion)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return r.missingOrMismatch(ctx, id, UserFilter{})
+	}
+	return nil
+}
+
+// RestoreUser clears the deletion time of a user. Restoring an active user
+// returns it unchanged.
+func (r *userRepositoryImpl) RestoreUser(ctx context.Context, id int) (*user.User, error) {
+	u, err := scanUser(r.db.writer(ctx).QueryRow(ctx, "UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL RETURNING "+userColumns, id))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		return r.GetUser(WithPrimary(ctx), id, UserFilter{})
+	}
+	return u, err
+}
+
+// PurgeUser permanently deletes a user from the database.
+func (r *userRepositoryImpl) PurgeUser(ctx context.Context, id int, expectedVersion int) error {
+	tag, err := r.db.writer(ctx).Exec(ctx, "DELETE FROM users WHERE id = $1 AND ($2 = 0 OR version = $2)", id, expectedVersion)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return r.missingOrMismatch(ctx, id, UserFilter{IncludeDeleted: true})
+	}
+	return nil
+}
+
+// missingOrMismatch explains why a conditional write changed no rows.
+func (r *userRepositoryImpl) missingOrMismatch(ctx context.Context, id int, filter UserFilter) error {
+	if _, err := r.GetUser(WithPrimary(ctx), id, filter); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// PurgeDeletedUsers permanently deletes users soft-deleted before before.
+func (r *userRepositoryImpl) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.writer(ctx).Exec(ctx, "DELETE FROM users WHERE deleted_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func scanUser(row pgx.Row) (*user.User, error) {
 	var u user.User
-	err := r.db.QueryRow(context.Background(), "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id, name, email", req.Name, req.Email).Scan(&u.ID, &u.Name, &u.Email)
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
 	return &u, nil
 }
-
-// DeleteUser deletes a user from the database.
-func (r *userRepositoryImpl) DeleteUser(id int) error {
-	_, err := r.db.Exec(context.Background(), "DELETE FROM users WHERE id = $1", id)
-	return err
-}
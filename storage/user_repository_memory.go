@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"context"
+	user "http-server/dto/user"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryUserRepository is an in-memory implementation of the UserRepository
+// with the same semantics as the PostgreSQL one: auto-increment IDs that are
+// never reused, emails unique among active users and ErrUserNotFound for
+// unknown IDs.
+type memoryUserRepository struct {
+	mu     sync.RWMutex
+	nextID int
+	users  map[int]user.User
+	// emails maps the emails of active users to their ID.
+	emails map[string]int
+}
+
+// NewMemoryUserRepository creates an empty in-memory UserRepository.
+func NewMemoryUserRepository() UserRepository {
+	return &memoryUserRepository{
+		nextID: 1,
+		users:  make(map[int]user.User),
+		emails: make(map[string]int),
+	}
+}
+
+// GetUsers returns all users ordered by ID.
+func (r *memoryUserRepository) GetUsers(ctx context.Context, filter UserFilter) ([]user.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]user.User, 0, len(r.users))
+	for _, u := range r.users {
+		if u.DeletedAt == nil || filter.IncludeDeleted {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// GetUser returns a single user by ID.
+func (r *memoryUserRepository) GetUser(ctx context.Context, id int, filter UserFilter) (*user.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	u, ok := r.users[id]
+	if !ok || (u.DeletedAt != nil && !filter.IncludeDeleted) {
+		return nil, ErrUserNotFound
+	}
+	return &u, nil
+}
+
+// GetUsersByIDs returns the users of ids ordered by ID.
+func (r *memoryUserRepository) GetUsersByIDs(ctx context.Context, ids []int, filter UserFilter) ([]user.User, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	users := make([]user.User, 0, len(ids))
+	seen := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		u, ok := r.users[id]
+		if !ok || seen[id] || (u.DeletedAt != nil && !filter.IncludeDeleted) {
+			continue
+		}
+		seen[id] = true
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// ListUsers returns a page of users ordered by ID.
+func (r *memoryUserRepository) ListUsers(ctx context.Context, q UserQuery) ([]user.User, error) {
+	users := r.matchUsers(q)
+	if q.AfterID > 0 {
+		start := sort.Search(len(users), func(i int) bool { return users[i].ID > q.AfterID })
+		users = users[start:]
+	}
+	if q.Limit > 0 && len(users) > q.Limit {
+		users = users[:q.Limit]
+	}
+	return users, nil
+}
+
+// CountUsers returns the number of users matching q.
+func (r *memoryUserRepository) CountUsers(ctx context.Context, q UserQuery) (int, error) {
+	return len(r.matchUsers(q)), nil
+}
+
+// matchUsers returns the users matching the filter and search of q ordered
+// by ID.
+func (r *memoryUserRepository) matchUsers(q UserQuery) []user.User {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	search := strings.ToLower(q.Search)
+	users := make([]user.User, 0, len(r.users))
+	for _, u := range r.users {
+		if u.DeletedAt != nil && !q.Filter.IncludeDeleted {
+			continue
+		}
+		if strings.Contains(strings.ToLower(u.Name), search) || strings.Contains(strings.ToLower(u.Email), search) {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users
+}
+
+// CreateUser stores a new user under the next ID.
+func (r *memoryUserRepository) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, taken := r.emails[req.Email]; taken {
+		return nil, ErrEmailTaken
+	}
+	u := user.User{ID: r.nextID, Name: req.Name, Email: req.Email, Version: 1}
+	r.nextID++
+	r.users[u.ID] = u
+	r.emails[u.Email] = u.ID
+	return &u, nil
+}
+
+// CreateUsers stores new users under consecutive IDs, skipping taken
+// emails.
+func (r *memoryUserRepository) CreateUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	users := make([]*user.User, len(reqs))
+	for i, req := range reqs {
+		if _, taken := r.emails[req.Email]; taken {
+			continue
+		}
+		u := user.User{ID: r.nextID, Name: req.Name, Email: req.Email, Version: 1}
+		r.nextID++
+		r.users[u.ID] = u
+		r.emails[u.Email] = u.ID
+		users[i] = &u
+	}
+	return users, nil
+}
+
+// StreamUsers calls fn for a snapshot of the users, taken so that fn can
+// use the repository.
+func (r *memoryUserRepository) StreamUsers(ctx context.Context, filter UserFilter, fn func(u *user.User) error) error {
+	users, err := r.GetUsers(ctx, filter)
+	if err != nil {
+		return err
+	}
+	for i := range users {
+		if err := fn(&users[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateUser replaces the name and email of an active user.
+func (r *memoryUserRepository) UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.DeletedAt != nil {
+		return nil, ErrUserNotFound
+	}
+	if expectedVersion != 0 && u.Version != expectedVersion {
+		return nil, ErrVersionMismatch
+	}
+	if owner, taken := r.emails[req.Email]; taken && owner != id {
+		return nil, ErrEmailTaken
+	}
+	delete(r.emails, u.Email)
+	u.Name, u.Email = req.Name, req.Email
+	u.Version++
+	r.users[id] = u
+	r.emails[u.Email] = id
+	return &u, nil
+}
+
+// DeleteUser soft-deletes a user.
+func (r *memoryUserRepository) DeleteUser(ctx context.Context, id int, expectedVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok || u.DeletedAt != nil {
+		return ErrUserNotFound
+	}
+	if expectedVersion != 0 && u.Version != expectedVersion {
+		return ErrVersionMismatch
+	}
+	now := time.Now().UTC()
+	u.DeletedAt = &now
+	u.Version++
+	r.users[id] = u
+	delete(r.emails, u.Email)
+	return nil
+}
+
+// RestoreUser clears the deletion time of a user.
+func (r *memoryUserRepository) RestoreUser(ctx context.Context, id int) (*user.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return nil, ErrUserNotFound
+	}
+	if u.DeletedAt != nil {
+		if _, taken := r.emails[u.Email]; taken {
+			return nil, ErrEmailTaken
+		}
+		u.DeletedAt = nil
+		u.Version++
+		r.users[id] = u
+		r.emails[u.Email] = id
+	}
+	return &u, nil
+}
+
+// PurgeUser permanently removes a user.
+func (r *memoryUserRepository) PurgeUser(ctx context.Context, id int, expectedVersion int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	if expectedVersion != 0 && u.Version != expectedVersion {
+		return ErrVersionMismatch
+	}
+	delete(r.users, id)
+	if u.DeletedAt == nil {
+		delete(r.emails, u.Email)
+	}
+	return nil
+}
+
+// PurgeDeletedUsers permanently removes users soft-deleted before before.
+func (r *memoryUserRepository) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n int64
+	for id, u := range r.users {
+		if u.DeletedAt != nil && u.DeletedAt.Before(before) {
+			delete(r.users, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,253 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"http-server/config"
+	user "http-server/dto/user"
+	"time"
+
+	_ "modernc.org/sqlite" // SQLite driver, no cgo required
+)
+
+// OpenSQLite opens the SQLite database configured in cfg.SQLite.
+func OpenSQLite(cfg *config.DatabaseConfig) (*sql.DB, error) {
+	if cfg.SQLite.Path == "" {
+		return nil, errors.New("database.sqlite.path is not set")
+	}
+	db, err := sql.Open("sqlite", cfg.SQLiteDSN())
+	if err != nil {
+		return nil, fmt.Errorf("invalid database configuration: %w", err)
+	}
+	if err := db.PingContext(context.Background()); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+	return db, nil
+}
+
+// sqliteUserRepository is the SQLite implementation of the UserRepository.
+// It uses the transaction started by TxManager.WithinTx when ctx carries one.
+type sqliteUserRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteUserRepository creates a UserRepository backed by db, which must
+// have been migrated with the sqlite migrations.
+func NewSQLiteUserRepository(db *sql.DB) UserRepository {
+	return &sqliteUserRepository{db: db}
+}
+
+// GetUsers retrieves all users from the database.
+func (r *sqliteUserRepository) GetUsers(ctx context.Context, filter UserFilter) ([]user.User, error) {
+	query := "SELECT " + userColumns + " FROM users"
+	if !filter.IncludeDeleted {
+		query += " WHERE deleted_at IS NULL"
+	}
+	return r.queryUsers(ctx, query+" ORDER BY id")
+}
+
+// GetUser retrieves a single user by ID from the database.
+func (r *sqliteUserRepository) GetUser(ctx context.Context, id int, filter UserFilter) (*user.User, error) {
+	query := "SELECT " + userColumns + " FROM users WHERE id = $1"
+	if !filter.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	return scanSQLUser(sqlConn(ctx, r.db).QueryRowContext(ctx, query, id))
+}
+
+// GetUsersByIDs retrieves the users of ids from the database. The IDs are
+// passed as a JSON array, so that any number of them takes one parameter.
+func (r *sqliteUserRepository) GetUsersByIDs(ctx context.Context, ids []int, filter UserFilter) ([]user.User, error) {
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+	query := "SELECT " + userColumns + " FROM users WHERE id IN (SELECT value FROM json_each($1))"
+	if !filter.IncludeDeleted {
+		query += " AND deleted_at IS NULL"
+	}
+	return r.queryUsers(ctx, query+" ORDER BY id", string(idsJSON))
+}
+
+// ListUsers retrieves a page of users from the database. LIKE ignores the
+// case of ASCII letters only.
+func (r *sqliteUserRepository) ListUsers(ctx context.Context, q UserQuery) ([]user.User, error) {
+	query, args := q.list("LIKE")
+	return r.queryUsers(ctx, query, args...)
+}
+
+// CountUsers counts the users matching q in the database.
+func (r *sqliteUserRepository) CountUsers(ctx context.Context, q UserQuery) (int, error) {
+	query, args := q.count("LIKE")
+	var n int
+	err := sqlConn(ctx, r.db).QueryRowContext(ctx, query, args...).Scan(&n)
+	return n, err
+}
+
+// queryUsers runs a query returning userColumns.
+func (r *sqliteUserRepository) queryUsers(ctx context.Context, query string, args ...any) ([]user.User, error) {
+	rows, err := sqlConn(ctx, r.db).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []user.User{}
+	for rows.Next() {
+		var u user.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	return users, rows.Err()
+}
+
+// CreateUser inserts a new user into the database.
+func (r *sqliteUserRepository) CreateUser(ctx context.Context, req *user.CreateUserRequest) (*user.User, error) {
+	u, err := scanSQLUser(sqlConn(ctx, r.db).QueryRowContext(ctx, "INSERT INTO users (name, email) VALUES ($1, $2) RETURNING "+userColumns, req.Name, req.Email))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	return u, err
+}
+
+// CreateUsers inserts users in a single transaction. Conflicting inserts do
+// nothing, so a taken email does not abort the batch.
+func (r *sqliteUserRepository) CreateUsers(ctx context.Context, reqs []user.CreateUserRequest) ([]*user.User, error) {
+	users := make([]*user.User, len(reqs))
+	err := NewSQLiteTxManager(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		for i := range reqs {
+			u, err := scanSQLUser(sqlConn(ctx, r.db).QueryRowContext(ctx, "INSERT INTO users (name, email) VALUES ($1, $2) ON CONFLICT DO NOTHING RETURNING "+userColumns, reqs[i].Name, reqs[i].Email))
+			if errors.Is(err, ErrUserNotFound) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			users[i] = u
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// StreamUsers steps through the users of a single query, which SQLite
+// evaluates lazily.
+func (r *sqliteUserRepository) StreamUsers(ctx context.Context, filter UserFilter, fn func(u *user.User) error) error {
+	query := "SELECT " + userColumns + " FROM users"
+	if !filter.IncludeDeleted {
+		query += " WHERE deleted_at IS NULL"
+	}
+	rows, err := sqlConn(ctx, r.db).QueryContext(ctx, query+" ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u user.User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt); err != nil {
+			return err
+		}
+		if err := fn(&u); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// UpdateUser replaces the name and email of an active user.
+func (r *sqliteUserRepository) UpdateUser(ctx context.Context, id int, req *user.UpdateUserRequest, expectedVersion int) (*user.User, error) {
+	u, err := scanSQLUser(sqlConn(ctx, r.db).QueryRowContext(ctx, "UPDATE users SET name = $1, email = $2, version = version + 1 WHERE id = $3 AND deleted_at IS NULL AND ($4 = 0 OR version = $4) RETURNING "+userColumns, req.Name, req.Email, id, expectedVersion))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		return nil, r.missingOrMismatch(ctx, id, UserFilter{})
+	}
+	return u, err
+}
+
+// DeleteUser soft-deletes a user.
+func (r *sqliteUserRepository) DeleteUser(ctx context.Context, id int, expectedVersion int) error {
+	res, err := sqlConn(ctx, r.db).ExecContext(ctx, "UPDATE users SET deleted_at = $1, version = version + 1 WHERE id = $2 AND deleted_at IS NULL AND ($3 = 0 OR version = $3)", time.Now().UTC(), id, expectedVersion)
+	if err := requireAffected(res, err); !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	return r.missingOrMismatch(ctx, id, UserFilter{})
+}
+
+// RestoreUser clears the deletion time of a user. Restoring an active user
+// returns it unchanged.
+func (r *sqliteUserRepository) RestoreUser(ctx context.Context, id int) (*user.User, error) {
+	u, err := scanSQLUser(sqlConn(ctx, r.db).QueryRowContext(ctx, "UPDATE users SET deleted_at = NULL, version = version + 1 WHERE id = $1 AND deleted_at IS NOT NULL RETURNING "+userColumns, id))
+	if isUniqueViolation(err) {
+		return nil, ErrEmailTaken
+	}
+	if errors.Is(err, ErrUserNotFound) {
+		return r.GetUser(ctx, id, UserFilter{})
+	}
+	return u, err
+}
+
+// PurgeUser permanently deletes a user from the database.
+func (r *sqliteUserRepository) PurgeUser(ctx context.Context, id int, expectedVersion int) error {
+	res, err := sqlConn(ctx, r.db).ExecContext(ctx, "DELETE FROM users WHERE id = $1 AND ($2 = 0 OR version = $2)", id, expectedVersion)
+	if err := requireAffected(res, err); !errors.Is(err, ErrUserNotFound) {
+		return err
+	}
+	return r.missingOrMismatch(ctx, id, UserFilter{IncludeDeleted: true})
+}
+
+// missingOrMismatch explains why a conditional write changed no rows.
+func (r *sqliteUserRepository) missingOrMismatch(ctx context.Context, id int, filter UserFilter) error {
+	if _, err := r.GetUser(ctx, id, filter); err != nil {
+		return err
+	}
+	return ErrVersionMismatch
+}
+
+// PurgeDeletedUsers permanently deletes users soft-deleted before before.
+func (r *sqliteUserRepository) PurgeDeletedUsers(ctx context.Context, before time.Time) (int64, error) {
+	res, err := sqlConn(ctx, r.db).ExecContext(ctx, "DELETE FROM users WHERE deleted_at < $1", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func scanSQLUser(row *sql.Row) (*user.User, error) {
+	var u user.User
+	err := row.Scan(&u.ID, &u.Name, &u.Email, &u.Version, &u.DeletedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// requireAffected returns ErrUserNotFound when a statement changed no rows.
+func requireAffected(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package storage_test
+
+import (
+	"testing"
+
+	"http-server/storage"
+	"http-server/storage/storagetest"
+)
+
+func TestMemoryUserRepository(t *testing.T) {
+	storagetest.RunUserRepositoryTests(t, func(t *testing.T) storage.UserRepository {
+		return storage.NewMemoryUserRepository()
+	})
+}
+
+func TestSQLiteUserRepository(t *testing.T) {
+	storagetest.RunUserRepositoryTests(t, func(t *testing.T) storage.UserRepository {
+		return storage.NewSQLiteUserRepository(storagetest.OpenSQLite(t))
+	})
+}
+
+// TestPostgresUserRepository runs against the migrated database in
+// TEST_DATABASE_URL. The users table is truncated before every test.
+func TestPostgresUserRepository(t *testing.T) {
+	db := storagetest.ConnectPostgres(t)
+
+	storagetest.RunUserRepositoryTests(t, func(t *testing.T) storage.UserRepository {
+		storagetest.TruncatePostgres(t, db, "users")
+		return storage.NewUserRepository(db)
+	})
+}
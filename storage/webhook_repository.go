@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"context"
+	"http-server/dto/webhook"
+)
+
+// WebhookRepository stores webhook subscriptions and their delivery log.
+type WebhookRepository interface {
+	// GetWebhooks returns every webhook ordered by ID.
+	GetWebhooks(ctx context.Context) ([]webhook.Webhook, error)
+	// GetWebhook returns ErrWebhookNotFound for unknown IDs.
+	GetWebhook(ctx context.Context, id int) (*webhook.Webhook, error)
+	// CreateWebhook stores an active webhook. req.Secret must be set.
+	CreateWebhook(ctx context.Context, req *webhook.CreateWebhookRequest) (*webhook.Webhook, error)
+	// UpdateWebhook replaces the URL, event types and state of a webhook.
+	// Activating it resets its count of consecutive failures.
+	UpdateWebhook(ctx context.Context, id int, req *webhook.UpdateWebhookRequest) (*webhook.Webhook, error)
+	// DeleteWebhook deletes a webhook and its delivery log.
+	DeleteWebhook(ctx context.Context, id int) error
+	// RecordDelivery adds d to the log and updates the count of
+	// consecutive failures of its webhook. A failure bringing the count to
+	// disableAfter disables the webhook; zero never disables it. It returns
+	// whether the webhook was disabled by this delivery.
+	RecordDelivery(ctx context.Context, d *webhook.Delivery, disableAfter int) (bool, error)
+	// GetDeliveries returns the latest limit deliveries of a webhook,
+	// newest first.
+	GetDeliveries(ctx context.Context, webhookID int, limit int) ([]webhook.Delivery, error)
+}
+
+// NewWebhookRepository creates the PostgreSQL WebhookRepository.
+func NewWebhookRepository(db *DB) WebhookRepository {
+	return &webhookRepositoryImpl{db: db}
+}
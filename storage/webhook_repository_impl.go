@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"http-server/dto/webhook"
+
+	"github.com/jackc/pgx/v4"
+)
+
+const (
+	webhookColumns  = "id, url, event_types, secret, active, consecutive_failures, created_at, updated_at"
+	deliveryColumns = "id, webhook_id, event_id::text, event_type, attempt, status_code, error, duration_ms, succeeded, created_at"
+)
+
+// webhookRepositoryImpl is the PostgreSQL implementation of the
+// WebhookRepository. Webhooks are few and read by the delivery jobs right
+// after being changed, so it always uses the primary.
+type webhookRepositoryImpl struct {
+	db *DB
+}
+
+// GetWebhooks retrieves all webhooks from the database.
+func (r *webhookRepositoryImpl) GetWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	rows, err := r.db.writer(ctx).Query(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []webhook.Webhook{}
+	for rows.Next() {
+		w, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+// GetWebhook retrieves a single webhook by ID from the database.
+func (r *webhookRepositoryImpl) GetWebhook(ctx context.Context, id int) (*webhook.Webhook, error) {
+	return scanWebhook(r.db.writer(ctx).QueryRow(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id))
+}
+
+// CreateWebhook inserts a new webhook into the database.
+func (r *webhookRepositoryImpl) CreateWebhook(ctx context.Context, req *webhook.CreateWebhookRequest) (*webhook.Webhook, error) {
+	return scanWebhook(r.db.writer(ctx).QueryRow(ctx, "INSERT INTO webhooks (url, event_types, secret) VALUES ($1, $2, $3) RETURNING "+webhookColumns, req.URL, eventTypes(req.EventTypes), req.Secret))
+}
+
+// UpdateWebhook replaces a webhook.
+func (r *webhookRepositoryImpl) UpdateWebhook(ctx context.Context, id int, req *webhook.UpdateWebhookRequest) (*webhook.Webhook, error) {
+	return scanWebhook(r.db.writer(ctx).QueryRow(ctx, "UPDATE webhooks SET url = $2, event_types = $3, active = $4, consecutive_failures = CASE WHEN $4 AND NOT active THEN 0 ELSE consecutive_failures END, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+webhookColumns, id, req.URL, eventTypes(req.EventTypes), req.Active))
+}
+
+// DeleteWebhook deletes a webhook; its deliveries are deleted by cascade.
+func (r *webhookRepositoryImpl) DeleteWebhook(ctx context.Context, id int) error {
+	tag, err := r.db.writer(ctx).Exec(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// RecordDelivery updates the failure count of the webhook of d and inserts
+// d in a single batch, which runs in an implicit transaction.
+func (r *webhookRepositoryImpl) RecordDelivery(ctx context.Context, d *webhook.Delivery, disableAfter int) (bool, error) {
+	batch := &pgx.Batch{}
+	// Joining the table to itself exposes the state before the update.
+	batch.Queue(`UPDATE webhooks w SET
+		consecutive_failures = CASE WHEN $2 THEN 0 ELSE w.consecutive_failures + 1 END,
+		active = w.active AND ($2 OR $3 = 0 OR w.consecutive_failures + 1 < $3)
+		FROM webhooks old WHERE w.id = $1 AND old.id = w.id
+		RETURNING old.active AND NOT w.active`, d.WebhookID, d.Succeeded, disableAfter)
+	batch.Queue("INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, succeeded) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at",
+		d.WebhookID, d.EventID, d.EventType, d.Attempt, d.StatusCode, d.Error, d.DurationMs, d.Succeeded)
+	results := r.db.writer(ctx).SendBatch(ctx, batch)
+	defer results.Close()
+
+	var disabled bool
+	err := results.QueryRow().Scan(&disabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, ErrWebhookNotFound
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := results.QueryRow().Scan(&d.ID, &d.CreatedAt); err != nil {
+		return false, err
+	}
+	return disabled, results.Close()
+}
+
+// GetDeliveries retrieves the latest deliveries of a webhook.
+func (r *webhookRepositoryImpl) GetDeliveries(ctx context.Context, webhookID int, limit int) ([]webhook.Delivery, error) {
+	rows, err := r.db.writer(ctx).Query(ctx, "SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhook.Delivery{}
+	for rows.Next() {
+		var d webhook.Delivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.DurationMs, &d.Succeeded, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// eventTypes returns types, or an empty slice for nil so that the column
+// is not set to NULL.
+func eventTypes(types []string) []string {
+	if types == nil {
+		return []string{}
+	}
+	return types
+}
+
+func scanWebhook(row pgx.Row) (*webhook.Webhook, error) {
+	var w webhook.Webhook
+	err := row.Scan(&w.ID, &w.URL, &w.EventTypes, &w.Secret, &w.Active, &w.ConsecutiveFailures, &w.CreatedAt, &w.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"http-server/dto/webhook"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// memoryWebhookRepository is an in-memory implementation of the
+// WebhookRepository.
+type memoryWebhookRepository struct {
+	mu             sync.RWMutex
+	nextID         int
+	nextDeliveryID int64
+	webhooks       map[int]webhook.Webhook
+	// deliveries holds the deliveries of each webhook, oldest first.
+	deliveries map[int][]webhook.Delivery
+}
+
+// NewMemoryWebhookRepository creates an empty in-memory WebhookRepository.
+func NewMemoryWebhookRepository() WebhookRepository {
+	return &memoryWebhookRepository{
+		nextID:         1,
+		nextDeliveryID: 1,
+		webhooks:       make(map[int]webhook.Webhook),
+		deliveries:     make(map[int][]webhook.Delivery),
+	}
+}
+
+// GetWebhooks returns all webhooks ordered by ID.
+func (r *memoryWebhookRepository) GetWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	webhooks := make([]webhook.Webhook, 0, len(r.webhooks))
+	for _, w := range r.webhooks {
+		webhooks = append(webhooks, cloneWebhook(w))
+	}
+	sort.Slice(webhooks, func(i, j int) bool { return webhooks[i].ID < webhooks[j].ID })
+	return webhooks, nil
+}
+
+// GetWebhook returns a single webhook by ID.
+func (r *memoryWebhookRepository) GetWebhook(ctx context.Context, id int) (*webhook.Webhook, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	w, ok := r.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	w = cloneWebhook(w)
+	return &w, nil
+}
+
+// CreateWebhook stores a new webhook under the next ID.
+func (r *memoryWebhookRepository) CreateWebhook(ctx context.Context, req *webhook.CreateWebhookRequest) (*webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	w := webhook.Webhook{
+		ID:         r.nextID,
+		URL:        req.URL,
+		EventTypes: slices.Clone(eventTypes(req.EventTypes)),
+		Secret:     req.Secret,
+		Active:     true,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	r.nextID++
+	r.webhooks[w.ID] = w
+	w = cloneWebhook(w)
+	return &w, nil
+}
+
+// UpdateWebhook replaces a webhook.
+func (r *memoryWebhookRepository) UpdateWebhook(ctx context.Context, id int, req *webhook.UpdateWebhookRequest) (*webhook.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.webhooks[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	if req.Active && !w.Active {
+		w.ConsecutiveFailures = 0
+	}
+	w.URL = req.URL
+	w.EventTypes = slices.Clone(eventTypes(req.EventTypes))
+	w.Active = req.Active
+	w.UpdatedAt = time.Now().UTC()
+	r.webhooks[id] = w
+	w = cloneWebhook(w)
+	return &w, nil
+}
+
+// DeleteWebhook removes a webhook and its deliveries.
+func (r *memoryWebhookRepository) DeleteWebhook(ctx context.Context, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.webhooks[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(r.webhooks, id)
+	delete(r.deliveries, id)
+	return nil
+}
+
+// RecordDelivery appends d to the deliveries of its webhook.
+func (r *memoryWebhookRepository) RecordDelivery(ctx context.Context, d *webhook.Delivery, disableAfter int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	w, ok := r.webhooks[d.WebhookID]
+	if !ok {
+		return false, ErrWebhookNotFound
+	}
+	d.ID = r.nextDeliveryID
+	d.CreatedAt = time.Now().UTC()
+	r.nextDeliveryID++
+	r.deliveries[d.WebhookID] = append(r.deliveries[d.WebhookID], *d)
+
+	wasActive := w.Active
+	if d.Succeeded {
+		w.ConsecutiveFailures = 0
+	} else {
+		w.ConsecutiveFailures++
+		if disableAfter > 0 && w.ConsecutiveFailures >= disableAfter {
+			w.Active = false
+		}
+	}
+	r.webhooks[w.ID] = w
+	return wasActive && !w.Active, nil
+}
+
+// GetDeliveries returns the latest deliveries of a webhook.
+func (r *memoryWebhookRepository) GetDeliveries(ctx context.Context, webhookID int, limit int) ([]webhook.Delivery, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	all := r.deliveries[webhookID]
+	deliveries := make([]webhook.Delivery, 0, min(limit, len(all)))
+	for i := len(all) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		deliveries = append(deliveries, all[i])
+	}
+	return deliveries, nil
+}
+
+// cloneWebhook copies w so that callers cannot change the stored event
+// types.
+func cloneWebhook(w webhook.Webhook) webhook.Webhook {
+	w.EventTypes = slices.Clone(w.EventTypes)
+	return w
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"http-server/dto/webhook"
+)
+
+const sqliteDeliveryColumns = "id, webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, succeeded, created_at"
+
+// sqliteWebhookRepository is the SQLite implementation of the
+// WebhookRepository. Event types are stored as a JSON array.
+type sqliteWebhookRepository struct {
+	db *sql.DB
+}
+
+// NewSQLiteWebhookRepository creates a WebhookRepository backed by db, which
+// must have been migrated with the sqlite migrations.
+func NewSQLiteWebhookRepository(db *sql.DB) WebhookRepository {
+	return &sqliteWebhookRepository{db: db}
+}
+
+// GetWebhooks retrieves all webhooks from the database.
+func (r *sqliteWebhookRepository) GetWebhooks(ctx context.Context) ([]webhook.Webhook, error) {
+	rows, err := sqlConn(ctx, r.db).QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []webhook.Webhook{}
+	for rows.Next() {
+		w, err := scanSQLWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, *w)
+	}
+	return webhooks, rows.Err()
+}
+
+// GetWebhook retrieves a single webhook by ID from the database.
+func (r *sqliteWebhookRepository) GetWebhook(ctx context.Context, id int) (*webhook.Webhook, error) {
+	return scanSQLWebhook(sqlConn(ctx, r.db).QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = $1", id))
+}
+
+// CreateWebhook inserts a new webhook into the database.
+func (r *sqliteWebhookRepository) CreateWebhook(ctx context.Context, req *webhook.CreateWebhookRequest) (*webhook.Webhook, error) {
+	types, err := json.Marshal(eventTypes(req.EventTypes))
+	if err != nil {
+		return nil, err
+	}
+	return scanSQLWebhook(sqlConn(ctx, r.db).QueryRowContext(ctx, "INSERT INTO webhooks (url, event_types, secret) VALUES ($1, $2, $3) RETURNING "+webhookColumns, req.URL, string(types), req.Secret))
+}
+
+// UpdateWebhook replaces a webhook.
+func (r *sqliteWebhookRepository) UpdateWebhook(ctx context.Context, id int, req *webhook.UpdateWebhookRequest) (*webhook.Webhook, error) {
+	types, err := json.Marshal(eventTypes(req.EventTypes))
+	if err != nil {
+		return nil, err
+	}
+	return scanSQLWebhook(sqlConn(ctx, r.db).QueryRowContext(ctx, "UPDATE webhooks SET url = $2, event_types = $3, active = $4, consecutive_failures = CASE WHEN $4 AND NOT active THEN 0 ELSE consecutive_failures END, updated_at = CURRENT_TIMESTAMP WHERE id = $1 RETURNING "+webhookColumns, id, req.URL, string(types), req.Active))
+}
+
+// DeleteWebhook deletes a webhook; its deliveries are deleted by cascade.
+func (r *sqliteWebhookRepository) DeleteWebhook(ctx context.Context, id int) error {
+	res, err := sqlConn(ctx, r.db).ExecContext(ctx, "DELETE FROM webhooks WHERE id = $1", id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// RecordDelivery inserts d and updates the failure count of its webhook in
+// a transaction.
+func (r *sqliteWebhookRepository) RecordDelivery(ctx context.Context, d *webhook.Delivery, disableAfter int) (bool, error) {
+	var disabled bool
+	err := NewSQLiteTxManager(r.db).WithinTx(ctx, func(ctx context.Context) error {
+		var wasActive bool
+		err := sqlConn(ctx, r.db).QueryRowContext(ctx, "SELECT active FROM webhooks WHERE id = $1", d.WebhookID).Scan(&wasActive)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWebhookNotFound
+		}
+		if err != nil {
+			return err
+		}
+		err = sqlConn(ctx, r.db).QueryRowContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error, duration_ms, succeeded) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, created_at",
+			d.WebhookID, d.EventID, d.EventType, d.Attempt, d.StatusCode, d.Error, d.DurationMs, d.Succeeded).Scan(&d.ID, &d.CreatedAt)
+		if err != nil {
+			return err
+		}
+		var active bool
+		err = sqlConn(ctx, r.db).QueryRowContext(ctx, `UPDATE webhooks SET
+			consecutive_failures = CASE WHEN $2 THEN 0 ELSE consecutive_failures + 1 END,
+			active = active AND ($2 OR $3 = 0 OR consecutive_failures + 1 < $3)
+			WHERE id = $1 RETURNING active`, d.WebhookID, d.Succeeded, disableAfter).Scan(&active)
+		if err != nil {
+			return err
+		}
+		disabled = wasActive && !active
+		return nil
+	})
+	return disabled, err
+}
+
+// GetDeliveries retrieves the latest deliveries of a webhook.
+func (r *sqliteWebhookRepository) GetDeliveries(ctx context.Context, webhookID int, limit int) ([]webhook.Delivery, error) {
+	rows, err := sqlConn(ctx, r.db).QueryContext(ctx, "SELECT "+sqliteDeliveryColumns+" FROM webhook_deliveries WHERE webhook_id = $1 ORDER BY id DESC LIMIT $2", webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := []webhook.Delivery{}
+	for rows.Next() {
+		var d webhook.Delivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.DurationMs, &d.Succeeded, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// sqlScanner is implemented by both *sql.Row and *sql.Rows.
+type sqlScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSQLWebhook(row sqlScanner) (*webhook.Webhook, error) {
+	var w webhook.Webhook
+	var types string
+	err := row.Scan(&w.ID, &w.URL, &types, &w.Secret, &w.Active, &w.ConsecutiveFailures, &w.CreatedAt, &w.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(types), &w.EventTypes); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
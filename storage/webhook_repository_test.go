@@ -0,0 +1,31 @@
+package storage_test
+
+import (
+	"testing"
+
+	"http-server/storage"
+	"http-server/storage/storagetest"
+)
+
+func TestMemoryWebhookRepository(t *testing.T) {
+	storagetest.RunWebhookRepositoryTests(t, func(t *testing.T) storage.WebhookRepository {
+		return storage.NewMemoryWebhookRepository()
+	})
+}
+
+func TestSQLiteWebhookRepository(t *testing.T) {
+	storagetest.RunWebhookRepositoryTests(t, func(t *testing.T) storage.WebhookRepository {
+		return storage.NewSQLiteWebhookRepository(storagetest.OpenSQLite(t))
+	})
+}
+
+// TestPostgresWebhookRepository runs against the migrated database in
+// TEST_DATABASE_URL. The webhook tables are truncated before every test.
+func TestPostgresWebhookRepository(t *testing.T) {
+	db := storagetest.ConnectPostgres(t)
+
+	storagetest.RunWebhookRepositoryTests(t, func(t *testing.T) storage.WebhookRepository {
+		storagetest.TruncatePostgres(t, db, "webhooks", "webhook_deliveries")
+		return storage.NewWebhookRepository(db)
+	})
+}
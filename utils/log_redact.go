@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+)
+
+// Redaction modes supported by RedactingHandler.
+const (
+	RedactModeMask = "mask"
+	RedactModeHash = "hash"
+	RedactModeOff  = "off"
+)
+
+const redactedValue = "[REDACTED]"
+
+// DefaultRedactKeys are the attribute keys masked when none are configured.
+var DefaultRedactKeys = []string{"password", "token", "authorization", "email"}
+
+// DefaultRedactPatterns are the value patterns masked when none are configured.
+var DefaultRedactPatterns = []string{"jwt", "email"}
+
+// builtinRedactPatterns maps pattern names usable in configuration to their
+// regular expressions. Any other configured pattern is compiled as a regexp.
+var builtinRedactPatterns = map[string]string{
+	"jwt":   `eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`,
+	"email": `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+}
+
+// RedactOptions configures a RedactingHandler.
+type RedactOptions struct {
+	// Keys are attribute keys whose values are always redacted, matched
+	// case-insensitively.
+	Keys []string
+	// Patterns are builtin pattern names ("jwt", "email") or regular
+	// expressions redacted wherever they appear in messages and string values.
+	Patterns []string
+	// Mode is RedactModeMask (default) to replace values with a fixed marker,
+	// or RedactModeHash to replace them with a keyed hash so they can still
+	// be correlated across log lines.
+	Mode string
+	// HashKey is the HMAC key used in hash mode.
+	HashKey string
+}
+
+// RedactingHandler is a slog.Handler that masks sensitive attribute values
+// before passing records on to the wrapped handler.
+type RedactingHandler struct {
+	next     slog.Handler
+	keys     map[string]struct{}
+	patterns []*regexp.Regexp
+	hash     bool
+	hashKey  []byte
+}
+
+// NewRedactingHandler wraps next with a handler that redacts according to
+// opts. It fails on an unknown mode, and in hash mode without a HashKey,
+// since unkeyed hashes of low-entropy values such as emails can be reversed
+// by brute force.
+func NewRedactingHandler(next slog.Handler, opts RedactOptions) (*RedactingHandler, error) {
+	switch opts.Mode {
+	case "", RedactModeMask:
+	case RedactModeHash:
+		if opts.HashKey == "" {
+			return nil, errors.New("hash redaction mode requires a hash key")
+		}
+	default:
+		return nil, fmt.Errorf("unknown redaction mode %q", opts.Mode)
+	}
+
+	h := &RedactingHandler{
+		next:    next,
+		keys:    make(map[string]struct{}, len(opts.Keys)),
+		hash:    opts.Mode == RedactModeHash,
+		hashKey: []byte(opts.HashKey),
+	}
+	for _, k := range opts.Keys {
+		h.keys[strings.ToLower(k)] = struct{}{}
+	}
+	for _, p := range opts.Patterns {
+		expr, ok := builtinRedactPatterns[p]
+		if !ok {
+			expr = p
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", p, err)
+		}
+		h.patterns = append(h.patterns, re)
+	}
+	return h, nil
+}
+
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *RedactingHandler) Handle(ctx context.Context, r slog.Record) error {
+	redacted := slog.NewRecord(r.Time, r.Level, h.redactString(r.Message), r.PC)
+	r.Attrs(func(a slog.Attr) bool {
+		redacted.AddAttrs(h.redactAttr(a))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, a := range attrs {
+		redacted[i] = h.redactAttr(a)
+	}
+	clone := *h
+	clone.next = h.next.WithAttrs(redacted)
+	return &clone
+}
+
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.next = h.next.WithGroup(name)
+	return &clone
+}
+
+func (h *RedactingHandler) redactAttr(a slog.Attr) slog.Attr {
+	a.Value = a.Value.Resolve()
+
+	if _, ok := h.keys[strings.ToLower(a.Key)]; ok {
+		return slog.String(a.Key, h.replace(a.Value.String()))
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindGroup:
+		group := a.Value.Group()
+		redacted := make([]any, len(group))
+		for i, ga := range group {
+			redacted[i] = h.redactAttr(ga)
+		}
+		return slog.Group(a.Key, redacted...)
+	case slog.KindString:
+		return slog.String(a.Key, h.redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, h.redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+func (h *RedactingHandler) redactString(s string) string {
+	for _, re := range h.patterns {
+		s = re.ReplaceAllStringFunc(s, h.replace)
+	}
+	return s
+}
+
+func (h *RedactingHandler) replace(value string) string {
+	if !h.hash {
+		return redactedValue
+	}
+	mac := hmac.New(sha256.New, h.hashKey)
+	mac.Write([]byte(value))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
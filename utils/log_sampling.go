@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var logRecordsDropped = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "log_records_dropped_total",
+		Help: "Total number of log records dropped by sampling.",
+	},
+	[]string{"level"},
+)
+
+func init() {
+	prometheus.MustRegister(logRecordsDropped)
+}
+
+// SamplingHandler is a slog.Handler that lets the first First records with a
+// given level and message through each second, then only every Thereafter-th
+// one. Records at slog.LevelError and above are never dropped.
+type SamplingHandler struct {
+	next    slog.Handler
+	sampler *logSampler
+}
+
+// logSampler holds the per-second counters shared by a SamplingHandler and
+// the handlers derived from it through WithAttrs and WithGroup.
+type logSampler struct {
+	first      uint64
+	thereafter uint64
+	now        func() time.Time
+
+	mu     sync.Mutex
+	second int64
+	counts map[logSampleKey]uint64
+}
+
+type logSampleKey struct {
+	level slog.Level
+	msg   string
+}
+
+// NewSamplingHandler wraps next with a sampling handler. A thereafter of zero
+// drops every record past the first ones in each second.
+func NewSamplingHandler(next slog.Handler, first, thereafter int) *SamplingHandler {
+	return &SamplingHandler{
+		next: next,
+		sampler: &logSampler{
+			first:      uint64(max(first, 0)),
+			thereafter: uint64(max(thereafter, 0)),
+			now:        time.Now,
+			counts:     make(map[logSampleKey]uint64),
+		},
+	}
+}
+
+func (h *SamplingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *SamplingHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level < slog.LevelError && !h.sampler.allow(r.Level, r.Message) {
+		logRecordsDropped.WithLabelValues(r.Level.String()).Inc()
+		return nil
+	}
+	return h.next.Handle(ctx, r)
+}
+
+func (h *SamplingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &SamplingHandler{next: h.next.WithAttrs(attrs), sampler: h.sampler}
+}
+
+func (h *SamplingHandler) WithGroup(name string) slog.Handler {
+	return &SamplingHandler{next: h.next.WithGroup(name), sampler: h.sampler}
+}
+
+func (s *logSampler) allow(level slog.Level, msg string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Counters only live for the current second, which also bounds the map
+	// when messages are built dynamically.
+	if second := s.now().Unix(); second != s.second {
+		s.second = second
+		clear(s.counts)
+	}
+
+	key := logSampleKey{level: level, msg: msg}
+	s.counts[key]++
+	n := s.counts[key]
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
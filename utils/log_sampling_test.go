@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingHandler(t *testing.T) {
+	newLogger := func(first, thereafter int, now *time.Time) (*slog.Logger, *bytes.Buffer) {
+		var buf bytes.Buffer
+		h := NewSamplingHandler(slog.NewJSONHandler(&buf, nil), first, thereafter)
+		h.sampler.now = func() time.Time { return *now }
+		return slog.New(h), &buf
+	}
+	lines := func(buf *bytes.Buffer) int {
+		return strings.Count(buf.String(), "\n")
+	}
+
+	t.Run("should log the first N records then one in M", func(t *testing.T) {
+		// Arrange
+		now := time.Unix(1000, 0)
+		logger, buf := newLogger(2, 3, &now)
+
+		// Act
+		for range 8 {
+			logger.Info("Cache hit for all users")
+		}
+
+		// Assert: records 1, 2, 5 and 8 pass
+		assert.Equal(t, 4, lines(buf))
+	})
+
+	t.Run("should reset counters every second", func(t *testing.T) {
+		// Arrange
+		now := time.Unix(1000, 0)
+		logger, buf := newLogger(1, 0, &now)
+
+		// Act
+		logger.Info("Request")
+		logger.Info("Request")
+		now = now.Add(time.Second)
+		logger.Info("Request")
+
+		// Assert
+		assert.Equal(t, 2, lines(buf))
+	})
+
+	t.Run("should sample messages independently and never drop errors", func(t *testing.T) {
+		// Arrange
+		now := time.Unix(1000, 0)
+		logger, buf := newLogger(1, 0, &now)
+
+		// Act
+		logger.Info("first")
+		logger.Info("second")
+		logger.With("id", 1).Info("second")
+		for range 3 {
+			logger.Error("boom")
+		}
+
+		// Assert
+		assert.Equal(t, 5, lines(buf))
+	})
+}
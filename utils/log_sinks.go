@@ -0,0 +1,143 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"http-server/config"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Log sink types and formats supported by InitLogger.
+const (
+	LogSinkStdout = "stdout"
+	LogSinkFile   = "file"
+
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// LogLineKey is the key of an attribute holding a preformatted log line, such
+// as a combined access log line. Sinks write its value verbatim in place of
+// the record, so that the line still goes through redaction and sampling.
+const LogLineKey = "log_line"
+
+// newSinkHandler creates the handler writing to a single configured sink.
+// The returned closer is nil for sinks that need no cleanup.
+func newSinkHandler(cfg config.LogSinkConfig, level slog.Level) (slog.Handler, io.Closer, error) {
+	var (
+		out    io.Writer
+		closer io.Closer
+	)
+	switch cfg.Type {
+	case "", LogSinkStdout:
+		out = os.Stdout
+	case LogSinkFile:
+		if cfg.Path == "" {
+			return nil, nil, errors.New("file log sink requires a path")
+		}
+		file := &lumberjack.Logger{
+			Filename:   cfg.Path,
+			MaxSize:    cfg.MaxSizeMB,
+			MaxAge:     cfg.MaxAgeDays,
+			MaxBackups: cfg.MaxBackups,
+			Compress:   cfg.Compress,
+		}
+		out, closer = file, file
+	default:
+		return nil, nil, fmt.Errorf("unknown log sink type %q", cfg.Type)
+	}
+
+	opts := &slog.HandlerOptions{Level: level, AddSource: true}
+	switch cfg.Format {
+	case "", LogFormatJSON:
+		return &lineHandler{next: slog.NewJSONHandler(out, opts), out: out}, closer, nil
+	case LogFormatText:
+		return &lineHandler{next: slog.NewTextHandler(out, opts), out: out}, closer, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown log sink format %q", cfg.Format)
+	}
+}
+
+// lineHandler is a slog.Handler writing the LogLineKey attribute of records
+// carrying one to out as is, and passing other records to next.
+type lineHandler struct {
+	next slog.Handler
+	out  io.Writer
+}
+
+func (h *lineHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+func (h *lineHandler) Handle(ctx context.Context, r slog.Record) error {
+	var line string
+	found := false
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == LogLineKey {
+			line, found = a.Value.String(), true
+			return false
+		}
+		return true
+	})
+	if !found {
+		return h.next.Handle(ctx, r)
+	}
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	_, err := io.WriteString(h.out, line)
+	return err
+}
+
+func (h *lineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &lineHandler{next: h.next.WithAttrs(attrs), out: h.out}
+}
+
+func (h *lineHandler) WithGroup(name string) slog.Handler {
+	return &lineHandler{next: h.next.WithGroup(name), out: h.out}
+}
+
+// fanoutHandler is a slog.Handler that passes every record to several handlers.
+type fanoutHandler []slog.Handler
+
+func (h fanoutHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, next := range h {
+		if next.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h fanoutHandler) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, next := range h {
+		if next.Enabled(ctx, r.Level) {
+			errs = append(errs, next.Handle(ctx, r.Clone()))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h fanoutHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, next := range h {
+		handlers[i] = next.WithAttrs(attrs)
+	}
+	return handlers
+}
+
+func (h fanoutHandler) WithGroup(name string) slog.Handler {
+	handlers := make(fanoutHandler, len(h))
+	for i, next := range h {
+		handlers[i] = next.WithGroup(name)
+	}
+	return handlers
+}
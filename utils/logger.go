@@ -1,13 +1,23 @@
 package utils
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log/slog"
-	"os"
+	"sync"
+
+	"http-server/config"
+
+	"github.com/go-chi/chi/v5"
 )
 
 var Logger *slog.Logger
 
-func InitLogger(level string) {
+// InitLogger initializes the global Logger, writing to the sinks configured
+// in cfg (stdout JSON by default). Sensitive values are redacted and records
+// are sampled according to cfg; a nil cfg applies the defaults.
+func InitLogger(level string, cfg *config.LogConfig) error {
 	var logLevel slog.Level
 	switch level {
 	case "debug":
@@ -20,8 +30,127 @@ func InitLogger(level string) {
 		logLevel = slog.LevelInfo
 	}
 
-	Logger = slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
-		Level:     logLevel,
-		AddSource: true,
-	}))
+	if cfg == nil {
+		cfg = &config.LogConfig{}
+	}
+
+	sinks := cfg.Sinks
+	if len(sinks) == 0 {
+		sinks = []config.LogSinkConfig{{Type: LogSinkStdout, Format: LogFormatJSON}}
+	}
+	var (
+		handlers fanoutHandler
+		closers  []io.Closer
+	)
+	for _, sink := range sinks {
+		h, closer, err := newSinkHandler(sink, logLevel)
+		if err != nil {
+			closeAll(closers)
+			return err
+		}
+		handlers = append(handlers, h)
+		if closer != nil {
+			closers = append(closers, closer)
+		}
+	}
+
+	handler := slog.Handler(handlers)
+	if len(handlers) == 1 {
+		handler = handlers[0]
+	}
+
+	if cfg.Redact.Mode != RedactModeOff {
+		opts := RedactOptions{
+			Keys:     cfg.Redact.Keys,
+			Patterns: cfg.Redact.Patterns,
+			Mode:     cfg.Redact.Mode,
+			HashKey:  cfg.Redact.HashKey,
+		}
+		if len(opts.Keys) == 0 {
+			opts.Keys = DefaultRedactKeys
+		}
+		if len(opts.Patterns) == 0 {
+			opts.Patterns = DefaultRedactPatterns
+		}
+		redacting, err := NewRedactingHandler(handler, opts)
+		if err != nil {
+			closeAll(closers)
+			return err
+		}
+		handler = redacting
+	}
+
+	if cfg.Sampling.Enabled {
+		handler = NewSamplingHandler(handler, cfg.Sampling.First, cfg.Sampling.Thereafter)
+	}
+
+	_ = CloseLogger()
+	logClosers = closers
+	Logger = slog.New(handler)
+	return nil
+}
+
+// logClosers are the sinks of the current Logger that need closing.
+var logClosers []io.Closer
+
+// CloseLogger flushes and closes the sinks of the global Logger.
+func CloseLogger() error {
+	err := closeAll(logClosers)
+	logClosers = nil
+	return err
+}
+
+func closeAll(closers []io.Closer) error {
+	var errs []error
+	for _, c := range closers {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
+
+type loggerCtxKey struct{}
+
+// requestLogger holds the request-scoped logger. It is stored by pointer so
+// middleware further down the chain can enrich the logger that the access
+// log, which sits at the top of the chain, ends up using.
+type requestLogger struct {
+	mu     sync.RWMutex
+	logger *slog.Logger
+}
+
+// ContextWithLogger returns a copy of ctx carrying l as the request-scoped logger.
+func ContextWithLogger(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, &requestLogger{logger: l})
+}
+
+// AddLogAttrs enriches the request-scoped logger stored in ctx with args.
+// It is a no-op when ctx carries no request-scoped logger.
+func AddLogAttrs(ctx context.Context, args ...any) {
+	rl, ok := ctx.Value(loggerCtxKey{}).(*requestLogger)
+	if !ok {
+		return
+	}
+	rl.mu.Lock()
+	rl.logger = rl.logger.With(args...)
+	rl.mu.Unlock()
+}
+
+// LoggerFromContext returns the request-scoped logger stored in ctx, falling
+// back to the global Logger. When the request has been routed, the matched
+// route pattern is attached as well.
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	rl, ok := ctx.Value(loggerCtxKey{}).(*requestLogger)
+	if !ok {
+		return Logger
+	}
+	rl.mu.RLock()
+	l := rl.logger
+	rl.mu.RUnlock()
+
+	if rctx := chi.RouteContext(ctx); rctx != nil {
+		if pattern := rctx.RoutePattern(); pattern != "" {
+			l = l.With("route", pattern)
+		}
+	}
+	return l
 }
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"testing"
+
+	"http-server/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitLogger(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, InitLogger("debug", nil)) })
+
+	t.Run("should accept every supported redaction mode", func(t *testing.T) {
+		for _, redact := range []config.RedactConfig{
+			{},
+			{Mode: RedactModeMask},
+			{Mode: RedactModeHash, HashKey: "secret"},
+			{Mode: RedactModeOff},
+		} {
+			// Act
+			err := InitLogger("info", &config.LogConfig{Redact: redact})
+
+			// Assert
+			assert.NoError(t, err, redact.Mode)
+		}
+	})
+
+	t.Run("should fail on hash mode without a key", func(t *testing.T) {
+		// Act
+		err := InitLogger("info", &config.LogConfig{Redact: config.RedactConfig{Mode: RedactModeHash}})
+
+		// Assert
+		assert.ErrorContains(t, err, "hash key")
+	})
+
+	t.Run("should fail on an unknown redaction mode", func(t *testing.T) {
+		// Act
+		err := InitLogger("info", &config.LogConfig{Redact: config.RedactConfig{Mode: "masked"}})
+
+		// Assert
+		assert.ErrorContains(t, err, `unknown redaction mode "masked"`)
+	})
+}
@@ -0,0 +1,54 @@
+package webhooks
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errPrivateAddress is returned when a webhook URL resolves to an address
+// that is not publicly routable.
+var errPrivateAddress = errors.New("address is not publicly routable")
+
+// sharedAddressSpace is the carrier-grade NAT range, which IsPrivate does
+// not cover.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// newTransport returns the transport of webhook deliveries. Unless
+// allowPrivate is set, its dialer refuses loopback, private, link-local and
+// other non-public addresses, so that webhooks cannot reach internal
+// services or cloud metadata endpoints. The check runs on the resolved
+// address of every connection, so it also covers hostnames resolving to
+// such addresses and DNS records changed after the webhook was created.
+func newTransport(allowPrivate bool) *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address)
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialled instead of the webhook, bypassing the check.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// checkAddress returns errPrivateAddress unless the ip:port address is
+// publicly routable.
+func checkAddress(address string) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("invalid address %q: %w", address, err)
+	}
+	ip := addrPort.Addr().Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() ||
+		ip.IsMulticast() || sharedAddressSpace.Contains(ip) || (ip.Is4() && ip.As4()[0] == 0) {
+		return fmt.Errorf("%s: %w", ip, errPrivateAddress)
+	}
+	return nil
+}
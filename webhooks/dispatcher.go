@@ -0,0 +1,169 @@
+// Package webhooks delivers events to the URLs of webhook subscriptions.
+// Each delivery is a job, so failed deliveries are retried with the
+// backoff of the job queue.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/dto/webhook"
+	"http-server/jobs"
+	"http-server/storage"
+	"http-server/utils"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DeliverJob is the name of the jobs delivering an event to a webhook.
+const DeliverJob = "webhooks.deliver"
+
+const (
+	defaultTimeout = 10 * time.Second
+	// maxResponseDrain is how much of a response body is read, so that the
+	// connection can be reused.
+	maxResponseDrain = 64 << 10
+)
+
+// deliveryPayload is the payload of DeliverJob.
+type deliveryPayload struct {
+	WebhookID int         `json:"webhook_id"`
+	Event     event.Event `json:"event"`
+}
+
+// Dispatcher is an events.Sink enqueuing a delivery job for every webhook
+// subscribed to an event, and runs those jobs.
+type Dispatcher struct {
+	repo         storage.WebhookRepository
+	queue        *jobs.Queue
+	client       *http.Client
+	disableAfter int
+}
+
+// NewDispatcher creates a Dispatcher for the webhooks of repo and registers
+// its job with queue.
+func NewDispatcher(repo storage.WebhookRepository, queue *jobs.Queue, cfg *config.WebhooksConfig) *Dispatcher {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	d := &Dispatcher{
+		repo:  repo,
+		queue: queue,
+		client: &http.Client{
+			Transport: newTransport(cfg.AllowPrivateNetworks),
+			Timeout:   timeout,
+			// A redirect is reported as a failure rather than followed
+			// to a URL nobody subscribed.
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		disableAfter: cfg.DisableAfter,
+	}
+	jobs.Register(queue, DeliverJob, d.deliver)
+	return d
+}
+
+// Publish enqueues the deliveries of events to the active webhooks
+// subscribed to them.
+func (d *Dispatcher) Publish(ctx context.Context, events []event.Event) error {
+	webhooks, err := d.repo.GetWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		for _, w := range webhooks {
+			if !w.Active || !w.Subscribes(e.Type) {
+				continue
+			}
+			if _, err := d.queue.Enqueue(ctx, DeliverJob, deliveryPayload{WebhookID: w.ID, Event: e}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// deliver posts an event to a webhook and logs the attempt. Deliveries to
+// webhooks deleted or disabled since the event was published are dropped.
+func (d *Dispatcher) deliver(ctx context.Context, p deliveryPayload) (any, error) {
+	w, err := d.repo.GetWebhook(ctx, p.WebhookID)
+	if errors.Is(err, storage.ErrWebhookNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !w.Active {
+		return nil, nil
+	}
+
+	t0 := time.Now()
+	status, postErr := d.post(ctx, w, p.Event)
+	delivery := &webhook.Delivery{
+		WebhookID:  w.ID,
+		EventID:    p.Event.ID,
+		EventType:  p.Event.Type,
+		Attempt:    jobs.Attempt(ctx),
+		StatusCode: status,
+		DurationMs: int(time.Since(t0).Milliseconds()),
+		Succeeded:  postErr == nil,
+	}
+	result := "success"
+	if postErr != nil {
+		result = "error"
+		delivery.Error = postErr.Error()
+	}
+	deliveriesTotal.WithLabelValues(result).Inc()
+
+	logger := utils.LoggerFromContext(ctx).With("webhook_id", w.ID, "event_id", p.Event.ID)
+	// Log the attempt even when ctx was cancelled by a shutdown.
+	disabled, err := d.repo.RecordDelivery(context.WithoutCancel(ctx), delivery, d.disableAfter)
+	if err != nil {
+		logger.Error("Failed to record webhook delivery", "error", err)
+	}
+	if disabled {
+		logger.Warn("Webhook disabled after failed deliveries", "failures", d.disableAfter)
+		return nil, jobs.Permanent(postErr)
+	}
+	if postErr != nil {
+		return nil, postErr
+	}
+	return map[string]int{"status_code": status}, nil
+}
+
+// post sends the signed event to the URL of w and returns the response
+// status, or 0 when no response was received. Statuses other than 2xx are
+// errors.
+func (d *Dispatcher) post(ctx context.Context, w *webhook.Webhook, e event.Event) (int, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, jobs.Permanent(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, jobs.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, time.Now(), body))
+	req.Header.Set(EventIDHeader, e.ID)
+	req.Header.Set(EventTypeHeader, e.Type)
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseDrain))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,295 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http-server/config"
+	"http-server/dto/event"
+	"http-server/dto/webhook"
+	"http-server/jobs"
+	"http-server/storage"
+	"http-server/storage/storagetest"
+	"http-server/utils"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Initialize logger for tests
+	if err := utils.InitLogger("debug", nil); err != nil {
+		panic(err)
+	}
+	// Run tests
+	os.Exit(m.Run())
+}
+
+// receiver is an httptest server recording the events it accepts, after
+// checking their signature.
+type receiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	events []event.Event
+	// status returns the response status of the given request, counted
+	// from 1.
+	status func(n int32) int
+	calls  atomic.Int32
+}
+
+func newReceiver(t *testing.T, secret string, status func(n int32) int) *receiver {
+	t.Helper()
+	rcv := &receiver{status: status}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := rcv.calls.Add(1)
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		if err := Verify(secret, r.Header.Get(SignatureHeader), body, time.Minute, time.Now()); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var e event.Event
+		require.NoError(t, json.Unmarshal(body, &e))
+		assert.Equal(t, e.ID, r.Header.Get(EventIDHeader))
+		assert.Equal(t, e.Type, r.Header.Get(EventTypeHeader))
+		status := rcv.status(n)
+		if status < 300 {
+			rcv.mu.Lock()
+			rcv.events = append(rcv.events, e)
+			rcv.mu.Unlock()
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (rcv *receiver) received() []event.Event {
+	rcv.mu.Lock()
+	defer rcv.mu.Unlock()
+	return append([]event.Event(nil), rcv.events...)
+}
+
+// newTestDispatcher returns a Dispatcher whose jobs run on a started pool.
+// Receivers listen on loopback, so cfg must allow private networks to reach
+// them.
+func newTestDispatcher(t *testing.T, repo storage.WebhookRepository, jobsCfg config.JobsConfig, cfg config.WebhooksConfig) (*Dispatcher, *jobs.Queue) {
+	t.Helper()
+	rdb := storagetest.NewRedisClient(t)
+	jobsCfg.PollInterval = 5 * time.Millisecond
+	jobsCfg.BackoffBase = time.Millisecond
+	queue := jobs.NewQueue(rdb, &jobsCfg)
+	d := NewDispatcher(repo, queue, &cfg)
+	pool := jobs.NewPool(queue, 2)
+	pool.Start()
+	t.Cleanup(func() { _ = pool.Shutdown(context.Background()) })
+	return d, queue
+}
+
+func newEvent(t *testing.T, eventType string) event.Event {
+	t.Helper()
+	e, err := event.New(eventType, map[string]int{"id": 1})
+	require.NoError(t, err)
+	return e
+}
+
+func TestDispatcher(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should deliver subscribed events signed with the webhook secret", func(t *testing.T) {
+		// Arrange
+		rcv := newReceiver(t, "secret", func(int32) int { return http.StatusNoContent })
+		repo := storage.NewMemoryWebhookRepository()
+		hook, err := repo.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: rcv.URL, EventTypes: []string{event.TypeUserCreated}, Secret: "secret"})
+		require.NoError(t, err)
+		d, _ := newTestDispatcher(t, repo, config.JobsConfig{}, config.WebhooksConfig{AllowPrivateNetworks: true})
+		created, updated := newEvent(t, event.TypeUserCreated), newEvent(t, event.TypeUserUpdated)
+
+		// Act
+		err = d.Publish(ctx, []event.Event{created, updated})
+
+		// Assert
+		require.NoError(t, err)
+		var deliveries []webhook.Delivery
+		require.Eventually(t, func() bool {
+			deliveries, err = repo.GetDeliveries(ctx, hook.ID, 10)
+			return err == nil && len(deliveries) == 1
+		}, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, []string{created.ID}, eventIDs(rcv.received()))
+		assert.Equal(t, created.ID, deliveries[0].EventID)
+		assert.Equal(t, http.StatusNoContent, deliveries[0].StatusCode)
+		assert.Equal(t, 1, deliveries[0].Attempt)
+		assert.True(t, deliveries[0].Succeeded)
+	})
+
+	t.Run("should retry failed deliveries and log every attempt", func(t *testing.T) {
+		// Arrange
+		rcv := newReceiver(t, "secret", func(n int32) int {
+			if n == 1 {
+				return http.StatusServiceUnavailable
+			}
+			return http.StatusOK
+		})
+		repo := storage.NewMemoryWebhookRepository()
+		hook, err := repo.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: rcv.URL, Secret: "secret"})
+		require.NoError(t, err)
+		d, _ := newTestDispatcher(t, repo, config.JobsConfig{}, config.WebhooksConfig{DisableAfter: 3, AllowPrivateNetworks: true})
+		e := newEvent(t, event.TypeUserDeleted)
+
+		// Act
+		err = d.Publish(ctx, []event.Event{e})
+
+		// Assert
+		require.NoError(t, err)
+		var deliveries []webhook.Delivery
+		require.Eventually(t, func() bool {
+			deliveries, err = repo.GetDeliveries(ctx, hook.ID, 10)
+			return err == nil && len(deliveries) == 2
+		}, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, 2, deliveries[0].Attempt)
+		assert.True(t, deliveries[0].Succeeded)
+		assert.Equal(t, 1, deliveries[1].Attempt)
+		assert.Equal(t, http.StatusServiceUnavailable, deliveries[1].StatusCode)
+		assert.Equal(t, "unexpected status 503", deliveries[1].Error)
+		assert.Equal(t, []string{e.ID}, eventIDs(rcv.received()))
+		got, err := repo.GetWebhook(ctx, hook.ID)
+		require.NoError(t, err)
+		assert.True(t, got.Active)
+		assert.Zero(t, got.ConsecutiveFailures)
+	})
+
+	t.Run("should disable webhooks failing too many times in a row", func(t *testing.T) {
+		// Arrange
+		rcv := newReceiver(t, "secret", func(int32) int { return http.StatusInternalServerError })
+		repo := storage.NewMemoryWebhookRepository()
+		hook, err := repo.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: rcv.URL, Secret: "secret"})
+		require.NoError(t, err)
+		d, queue := newTestDispatcher(t, repo, config.JobsConfig{MaxAttempts: 10}, config.WebhooksConfig{DisableAfter: 2, AllowPrivateNetworks: true})
+
+		// Act
+		err = d.Publish(ctx, []event.Event{newEvent(t, event.TypeUserCreated)})
+
+		// Assert
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			got, err := repo.GetWebhook(ctx, hook.ID)
+			return err == nil && !got.Active
+		}, 5*time.Second, 5*time.Millisecond)
+		queued, err := queue.Enqueue(ctx, DeliverJob, deliveryPayload{WebhookID: hook.ID, Event: newEvent(t, event.TypeUserCreated)})
+		require.NoError(t, err)
+		require.Eventually(t, func() bool {
+			job, err := queue.Get(ctx, queued.ID)
+			return err == nil && job.Status == jobs.StatusSucceeded
+		}, 5*time.Second, 5*time.Millisecond)
+		assert.Equal(t, int32(2), rcv.calls.Load())
+	})
+
+	t.Run("should drop deliveries to webhooks disabled or deleted since publishing", func(t *testing.T) {
+		// Arrange
+		rcv := newReceiver(t, "secret", func(int32) int { return http.StatusOK })
+		repo := storage.NewMemoryWebhookRepository()
+		hook, err := repo.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: rcv.URL, Secret: "secret"})
+		require.NoError(t, err)
+		_, err = repo.UpdateWebhook(ctx, hook.ID, &webhook.UpdateWebhookRequest{URL: rcv.URL, Active: false})
+		require.NoError(t, err)
+		d, _ := newTestDispatcher(t, repo, config.JobsConfig{}, config.WebhooksConfig{AllowPrivateNetworks: true})
+		e := newEvent(t, event.TypeUserCreated)
+
+		// Act
+		_, errDisabled := d.deliver(ctx, deliveryPayload{WebhookID: hook.ID, Event: e})
+		_, errDeleted := d.deliver(ctx, deliveryPayload{WebhookID: hook.ID + 1, Event: e})
+
+		// Assert
+		assert.NoError(t, errDisabled)
+		assert.NoError(t, errDeleted)
+		assert.Zero(t, rcv.calls.Load())
+		deliveries, err := repo.GetDeliveries(ctx, hook.ID, 10)
+		require.NoError(t, err)
+		assert.Empty(t, deliveries)
+	})
+}
+
+func TestDispatcherPrivateNetworks(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("should refuse to deliver to private addresses, after resolving hostnames", func(t *testing.T) {
+		for name, host := range map[string]string{"IP": "127.0.0.1", "hostname": "localhost"} {
+			t.Run(name, func(t *testing.T) {
+				// Arrange
+				rcv := newReceiver(t, "secret", func(int32) int { return http.StatusOK })
+				u, err := url.Parse(rcv.URL)
+				require.NoError(t, err)
+				u.Host = net.JoinHostPort(host, u.Port())
+				repo := storage.NewMemoryWebhookRepository()
+				hook, err := repo.CreateWebhook(ctx, &webhook.CreateWebhookRequest{URL: u.String(), Secret: "secret"})
+				require.NoError(t, err)
+				d, _ := newTestDispatcher(t, repo, config.JobsConfig{}, config.WebhooksConfig{})
+
+				// Act
+				_, err = d.deliver(ctx, deliveryPayload{WebhookID: hook.ID, Event: newEvent(t, event.TypeUserCreated)})
+
+				// Assert
+				assert.ErrorIs(t, err, errPrivateAddress)
+				assert.Zero(t, rcv.calls.Load())
+				deliveries, err := repo.GetDeliveries(ctx, hook.ID, 10)
+				require.NoError(t, err)
+				require.Len(t, deliveries, 1)
+				assert.Contains(t, deliveries[0].Error, "not publicly routable")
+			})
+		}
+	})
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		public  bool
+	}{
+		{address: "93.184.216.34:443", public: true},
+		{address: "[2606:2800:220:1:248:1893:25c8:1946]:443", public: true},
+		{address: "127.0.0.1:80"},
+		{address: "[::1]:80"},
+		{address: "10.1.2.3:80"},
+		{address: "172.16.0.1:80"},
+		{address: "192.168.1.1:80"},
+		{address: "169.254.169.254:80"},
+		{address: "[fe80::1]:80"},
+		{address: "[fd00::1]:80"},
+		{address: "[::ffff:127.0.0.1]:80"},
+		{address: "0.0.0.0:80"},
+		{address: "0.1.2.3:80"},
+		{address: "100.64.0.1:80"},
+		{address: "224.0.0.1:80"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			// Act
+			err := checkAddress(tt.address)
+
+			// Assert
+			if tt.public {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, errPrivateAddress)
+			}
+		})
+	}
+}
+
+func eventIDs(events []event.Event) []string {
+	ids := make([]string, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
@@ -0,0 +1,15 @@
+package webhooks
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var deliveriesTotal = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Total number of webhook delivery attempts made by this instance.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(deliveriesTotal)
+}
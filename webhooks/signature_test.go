@@ -0,0 +1,57 @@
+package webhooks
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	now := time.Unix(1700000000, 0)
+
+	t.Run("should verify signatures it made", func(t *testing.T) {
+		// Arrange
+		header := Sign("secret", now, body)
+
+		// Act
+		err := Verify("secret", header, body, 5*time.Minute, now.Add(time.Minute))
+
+		// Assert
+		assert.NoError(t, err)
+		assert.Regexp(t, `^t=1700000000,v1=[0-9a-f]{64}$`, header)
+	})
+
+	t.Run("should reject other bodies and secrets", func(t *testing.T) {
+		// Arrange
+		header := Sign("secret", now, body)
+
+		// Act
+		errBody := Verify("secret", header, []byte(`{"id":"2"}`), 5*time.Minute, now)
+		errSecret := Verify("other", header, body, 5*time.Minute, now)
+
+		// Assert
+		assert.ErrorIs(t, errBody, ErrInvalidSignature)
+		assert.ErrorIs(t, errSecret, ErrInvalidSignature)
+	})
+
+	t.Run("should reject signatures outside the tolerance", func(t *testing.T) {
+		// Arrange
+		header := Sign("secret", now, body)
+
+		// Act
+		err := Verify("secret", header, body, 5*time.Minute, now.Add(6*time.Minute))
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+
+	t.Run("should reject malformed headers", func(t *testing.T) {
+		// Act
+		err := Verify("secret", "v1=abc", body, 5*time.Minute, now)
+
+		// Assert
+		assert.ErrorIs(t, err, ErrInvalidSignature)
+	})
+}